@@ -0,0 +1,362 @@
+package godex
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// ExternalClasses returns the descriptors of classes that are referenced
+// by method ids, field ids or instructions, but not defined in this dex.
+// This is the external API the dex depends on.
+func (d *DEX) ExternalClasses() []string {
+	referenced := map[uint32]bool{}
+	for _, m := range d.Methods {
+		referenced[uint32(m.ClassIdx)] = true
+	}
+	for _, f := range d.Fields {
+		referenced[uint32(f.ClassIdx)] = true
+	}
+
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		for _, typeIdx := range m.referencedTypes() {
+			referenced[typeIdx] = true
+		}
+		return nil
+	})
+
+	for _, c := range d.Classes {
+		delete(referenced, c.ClassIdx)
+	}
+
+	external := map[string]bool{}
+	for typeIdx := range referenced {
+		if int(typeIdx) >= len(d.Types) {
+			continue
+		}
+
+		descriptor := strings.TrimLeft(d.Types[typeIdx].String(), "[")
+		if strings.HasPrefix(descriptor, "L") {
+			external[descriptor] = true
+		}
+	}
+
+	// array types referencing locally defined classes
+	for _, c := range d.Classes {
+		if int(c.ClassIdx) >= len(d.Types) {
+			continue
+		}
+
+		delete(external, d.Types[c.ClassIdx].String())
+	}
+
+	classes := []string{}
+	for descriptor := range external {
+		classes = append(classes, descriptor)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// ClassesInPackage returns the classes defined in the package prefix or
+// its subpackages. The prefix is either a java package name, eg.
+// "com.evil", or a descriptor prefix, eg. "Lcom/evil/"; a trailing
+// separator is optional.
+func (d *DEX) ClassesInPackage(prefix string) []*ClassDefItem {
+	if strings.Contains(prefix, ".") || !strings.HasPrefix(prefix, "L") {
+		prefix = "L" + strings.Replace(prefix, ".", "/", -1)
+	}
+
+	// Lcom/evil must not match Lcom/evilcorp/
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	classes := []*ClassDefItem{}
+	for i := range d.Classes {
+		c := &d.Classes[i]
+		if int(c.ClassIdx) < len(d.Types) && strings.HasPrefix(d.Types[c.ClassIdx].String(), prefix) {
+			classes = append(classes, c)
+		}
+	}
+	return classes
+}
+
+// referencedTypes returns the type indices used by the method's
+// instructions. Undecodable code is skipped.
+func (m *EncodedMethod) referencedTypes() []uint32 {
+	insns, _ := m.Instructions()
+
+	types := []uint32{}
+	for _, di := range insns {
+		for _, operand := range di.Operands {
+			if o, ok := operand.(TypeIndexOperand); ok {
+				types = append(types, o.Index)
+			}
+		}
+	}
+	return types
+}
+
+// invokedMethods returns the method indices invoked by the method's
+// instructions. Undecodable code is skipped.
+func (m *EncodedMethod) invokedMethods() []uint32 {
+	insns, _ := m.Instructions()
+
+	methods := []uint32{}
+	for _, di := range insns {
+		for _, operand := range di.Operands {
+			if o, ok := operand.(MethodIndexOperand); ok {
+				methods = append(methods, o.Index)
+			}
+		}
+	}
+	return methods
+}
+
+// ReferencedClasses returns the sorted descriptors of the classes the
+// method's code refers to: types of new-instance, check-cast, const-class
+// and the like, and the classes owning invoked methods and accessed
+// fields. Array types refer to their element class, primitives are left
+// out.
+func (m *EncodedMethod) ReferencedClasses() ([]string, error) {
+	insns, err := m.Instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	d := m.dex
+	referenced := map[string]bool{}
+	add := func(typeIdx uint32) {
+		if int(typeIdx) >= len(d.Types) {
+			return
+		}
+
+		descriptor := strings.TrimLeft(d.Types[typeIdx].String(), "[")
+		if strings.HasPrefix(descriptor, "L") {
+			referenced[descriptor] = true
+		}
+	}
+
+	for _, di := range insns {
+		for _, operand := range di.Operands {
+			switch o := operand.(type) {
+			case TypeIndexOperand:
+				add(o.Index)
+			case MethodIndexOperand:
+				if int(o.Index) < len(d.Methods) {
+					add(uint32(d.Methods[o.Index].ClassIdx))
+				}
+			case FieldIndexOperand:
+				if int(o.Index) < len(d.Fields) {
+					add(uint32(d.Fields[o.Index].ClassIdx))
+				}
+			}
+		}
+	}
+
+	classes := []string{}
+	for descriptor := range referenced {
+		classes = append(classes, descriptor)
+	}
+	sort.Strings(classes)
+	return classes, nil
+}
+
+// ReferencedMethods returns the distinct methods invoked by the methods of
+// the class, in method index order.
+func (c *ClassDefItem) ReferencedMethods() ([]*MethodIdItem, error) {
+	d := c.dex
+
+	referenced := map[uint32]bool{}
+	for _, methods := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+		for i := range methods {
+			insns, err := methods[i].Instructions()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, di := range insns {
+				for _, operand := range di.Operands {
+					o, ok := operand.(MethodIndexOperand)
+					if !ok {
+						continue
+					}
+
+					if int(o.Index) >= len(d.Methods) {
+						return nil, &IndexError{Kind: "method", Index: o.Index, Max: len(d.Methods)}
+					}
+					referenced[o.Index] = true
+				}
+			}
+		}
+	}
+
+	indices := []uint32{}
+	for idx := range referenced {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	methods := make([]*MethodIdItem, len(indices))
+	for i, idx := range indices {
+		methods[i] = &d.Methods[idx]
+	}
+	return methods, nil
+}
+
+// matchesAPI reports whether the method id matches one of apis. An api is
+// either a class descriptor, matching all its methods, a class descriptor
+// and method name joined by "->", or that followed by the method
+// descriptor, eg. "Ljava/lang/String;->valueOf(I)Ljava/lang/String;".
+func matchesAPI(method *MethodIdItem, apis []string) bool {
+	class := method.Class()
+	name := class + "->" + method.Name()
+	for _, api := range apis {
+		if api == class || api == name {
+			return true
+		}
+
+		if strings.HasPrefix(api, name+"(") {
+			descriptor, err := method.dex.Prototypes[method.ProtoIdx].descriptor()
+			if err == nil && api == name+descriptor {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MethodsCalling returns the methods invoking any of apis, see matchesAPI
+// for their syntax.
+func (d *DEX) MethodsCalling(apis []string) []MethodRef {
+	return d.FindMethods(func(c *ClassDefItem, m *EncodedMethod) bool {
+		for _, methodIdx := range m.invokedMethods() {
+			if int(methodIdx) < len(d.Methods) && matchesAPI(&d.Methods[methodIdx], apis) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// DynamicCodeLoaderAPIs are the APIs flagged by DynamicCodeLoaders.
+var DynamicCodeLoaderAPIs = []string{
+	"Ldalvik/system/DexClassLoader;",
+	"Ldalvik/system/PathClassLoader;",
+	"Ldalvik/system/InMemoryDexClassLoader;",
+	"Ldalvik/system/DexFile;",
+	"Ljava/lang/System;->load",
+	"Ljava/lang/System;->loadLibrary",
+	"Ljava/lang/Runtime;->load",
+	"Ljava/lang/Runtime;->loadLibrary",
+}
+
+// DynamicCodeLoaders returns the methods that load code at runtime, using
+// any of DynamicCodeLoaderAPIs. This is typical for packed or staged
+// malware.
+func (d *DEX) DynamicCodeLoaders() []MethodRef {
+	return d.MethodsCalling(DynamicCodeLoaderAPIs)
+}
+
+// BridgeMethods returns the methods flagged ACC_BRIDGE, the shims the
+// compiler generates for covariant returns and generics, which
+// decompilers usually hide.
+func (d *DEX) BridgeMethods() []MethodRef {
+	return d.FindMethods(func(_ *ClassDefItem, m *EncodedMethod) bool {
+		return m.IsBridge()
+	})
+}
+
+// OpcodeSet returns the distinct opcodes used by the methods of the class.
+// Switch and array payloads are data, not instructions, and are left out.
+func (c *ClassDefItem) OpcodeSet() (map[byte]bool, error) {
+	opcodes := map[byte]bool{}
+	for _, methods := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+		for i := range methods {
+			insns, err := methods[i].Instructions()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, di := range insns {
+				if di.Format == "" {
+					continue
+				}
+				opcodes[di.Opcode] = true
+			}
+		}
+	}
+	return opcodes, nil
+}
+
+// UserMethods counts the defined methods that are written by the
+// developer, leaving out synthetic and bridge methods.
+func (d *DEX) UserMethods() int {
+	count := 0
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		if !m.IsSynthetic() && !m.IsBridge() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// UserFields counts the defined fields that are not synthetic, eg. the
+// this$0 reference of inner classes.
+func (d *DEX) UserFields() int {
+	count := 0
+	for _, c := range d.Classes {
+		for _, fields := range [][]EncodedField{c.ClassData.StaticFields, c.ClassData.InstanceFields} {
+			for _, f := range fields {
+				if !f.AccessFlags.Has(ACC_SYNTHETIC) {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// LargestMethods returns the n methods with the most code units, largest
+// first. Generated or packed code often shows up as oversized methods.
+// Methods without code, or whose code_item is out of bounds, are left out.
+func (d *DEX) LargestMethods(n int) []MethodRef {
+	type sized struct {
+		ref  MethodRef
+		size uint32
+	}
+
+	methods := []sized{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		if size, ok := d.insnsSize(m.CodeOffset); ok {
+			methods = append(methods, sized{MethodRef{Class: c, Method: m}, size})
+		}
+		return nil
+	})
+
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].size > methods[j].size })
+
+	if n < 0 {
+		n = 0
+	}
+	if n > len(methods) {
+		n = len(methods)
+	}
+
+	refs := make([]MethodRef, n)
+	for i := range refs {
+		refs[i] = methods[i].ref
+	}
+	return refs
+}
+
+// insnsSize reads the insns_size of the code_item at off without decoding
+// the rest of it.
+func (d *DEX) insnsSize(off uint64) (uint32, bool) {
+	if off == 0 || off+16 > uint64(len(d.b)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(d.b[off+12:]), true
+}
@@ -0,0 +1,331 @@
+package godex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExternalClasses(t *testing.T) {
+	b := testHelloDEX()
+	c := b.classes[0]
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "log", "V"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, outs: 2, insns: []uint16{
+				0x001a, uint16(b.str("tag")), // const-string v0, "tag"
+				0x2071, uint16(b.method("Landroid/util/Log;", "d", "I", "Ljava/lang/String;", "Ljava/lang/String;")), 0x0000, // invoke-static {v0, v0}
+				0x0022, uint16(b.typ("Lcom/example/Hello;")), // new-instance v0, Hello
+				0x0022, uint16(b.typ("Ljava/lang/StringBuilder;")), // new-instance v0, StringBuilder
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{"Landroid/util/Log;", "Ljava/lang/Object;", "Ljava/lang/StringBuilder;"}
+	if classes := dex.ExternalClasses(); !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+	// a class with an invalid class_idx defines nothing
+	dex.Classes[0].ClassIdx = 999
+	want = []string{"Landroid/util/Log;", "Lcom/example/Hello;", "Ljava/lang/Object;", "Ljava/lang/StringBuilder;"}
+	if classes := dex.ExternalClasses(); !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+}
+
+func TestFindMethods(t *testing.T) {
+	b := testHelloDEX()
+	c := b.class("Lcom/example/World;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{idx: b.method("Lcom/example/World;", "<init>", "V"), flags: ACC_PUBLIC | ACC_CONSTRUCTOR, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+		{idx: b.method("Lcom/example/World;", "spin", "V"), flags: ACC_PRIVATE, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	refs := dex.FindMethods(func(c *ClassDefItem, m *EncodedMethod) bool {
+		return m.Method.Name() == "<init>"
+	})
+
+	if len(refs) != 2 {
+		t.Fatalf("Test failed %d %d", len(refs), 2)
+	}
+
+	for i, class := range []string{"Lcom/example/Hello;", "Lcom/example/World;"} {
+		if refs[i].Method.Method.Class() != class || refs[i].Class.ClassIdx != uint32(refs[i].Method.Method.ClassIdx) {
+			t.Errorf("Test failed %s %s", refs[i].Method.Method.Class(), class)
+		}
+	}
+}
+
+func TestDynamicCodeLoaders(t *testing.T) {
+	b := testHelloDEX()
+	loader := b.typ("Ldalvik/system/DexClassLoader;")
+	init := b.method("Ldalvik/system/DexClassLoader;", "<init>", "V", "Ljava/lang/String;", "Ljava/lang/String;", "Ljava/lang/String;", "Ljava/lang/ClassLoader;")
+
+	c := b.classes[0]
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "load", "V", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 4, ins: 2, outs: 4, insns: []uint16{
+				0x0022, uint16(loader), // new-instance v0, DexClassLoader
+				0x0112,                       // const/4 v1, 0
+				0x4070, uint16(init), 0x1310, // invoke-direct {v0, v3, v1, v1}, DexClassLoader.<init>
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	refs := dex.DynamicCodeLoaders()
+	if len(refs) != 1 || refs[0].Method.Method.Name() != "load" {
+		t.Errorf("Test failed %v %s", refs, "load")
+	}
+}
+
+func TestBridgeMethods(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Name;", "Ljava/lang/Object;")
+	compareTo := b.method("Lcom/example/Name;", "compareTo", "I", "Lcom/example/Name;")
+	bridge := b.method("Lcom/example/Name;", "compareTo", "I", "Ljava/lang/Object;")
+	c.virtualMethods = []testMethod{
+		{idx: compareTo, flags: ACC_PUBLIC, code: &testCode{registers: 3, ins: 2, insns: []uint16{
+			0x0012, // const/4 v0, 0
+			0x000f, // return v0
+		}}},
+		{idx: bridge, flags: ACC_PUBLIC | ACC_BRIDGE | ACC_SYNTHETIC, code: &testCode{registers: 3, ins: 2, outs: 2, insns: []uint16{
+			0x021f, uint16(b.typ("Lcom/example/Name;")), // check-cast v2, Name
+			0x206e, uint16(compareTo), 0x0021, // invoke-virtual {v1, v2}, Name.compareTo
+			0x000a, // move-result v0
+			0x000f, // return v0
+		}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	refs := dex.BridgeMethods()
+	if len(refs) != 1 || refs[0].Method.MethodIdx != bridge {
+		t.Errorf("Test failed %v %d", refs, bridge)
+	}
+}
+
+func TestOpcodeSet(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Math;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Math;", "add", "I", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 2, insns: []uint16{
+				0x0090, 0x0201, // add-int v0, v1, v2
+				0x000f, // return v0
+			}},
+		},
+	}
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Math;", "nothing", "V"),
+			flags: ACC_PUBLIC,
+			code:  &testCode{registers: 1, ins: 1, insns: []uint16{0x0000, 0x000e}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	opcodes, err := dex.Classes[0].OpcodeSet()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[byte]bool{0x90: true, 0x0f: true, 0x00: true, 0x0e: true}
+	if !reflect.DeepEqual(opcodes, want) {
+		t.Errorf("Test failed %v %v", opcodes, want)
+	}
+}
+
+func TestUserMembers(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Outer$Inner;", "Ljava/lang/Object;")
+	c.instanceFields = []testField{
+		{idx: b.field("Lcom/example/Outer$Inner;", "Lcom/example/Outer;", "this$0"), flags: ACC_FINAL | ACC_SYNTHETIC},
+		{idx: b.field("Lcom/example/Outer$Inner;", "I", "count"), flags: ACC_PRIVATE},
+	}
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Outer$Inner;", "access$000", "I"), flags: ACC_STATIC | ACC_SYNTHETIC, code: &testCode{registers: 1, insns: []uint16{0x0012, 0x000f}}},
+		{idx: b.method("Lcom/example/Outer$Inner;", "run", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if count := dex.UserMethods(); count != 1 {
+		t.Errorf("Test failed %d %d", count, 1)
+	}
+
+	if count := dex.UserFields(); count != 1 {
+		t.Errorf("Test failed %d %d", count, 1)
+	}
+}
+
+func TestReferencedClasses(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Factory;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Factory;", "make", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, outs: 1, insns: []uint16{
+				0x0022, uint16(b.typ("Lcom/example/Engine;")), // new-instance v0, Engine
+				0x1070, uint16(b.method("Lcom/example/Engine;", "<init>", "V")), 0x0000, // invoke-direct {v0}
+				0x0022, uint16(b.typ("Lcom/example/Wheel;")), // new-instance v0, Wheel
+				0x1070, uint16(b.method("Lcom/example/Wheel;", "<init>", "V")), 0x0000, // invoke-direct {v0}
+				0x0022, uint16(b.typ("Lcom/example/Engine;")), // new-instance v0, Engine
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	classes, err := dex.Classes[0].ClassData.DirectMethods[0].ReferencedClasses()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{"Lcom/example/Engine;", "Lcom/example/Wheel;"}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+}
+
+func TestReferencedMethods(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Log;", "Ljava/lang/Object;")
+	init := b.method("Ljava/lang/StringBuilder;", "<init>", "V")
+	appendString := b.method("Ljava/lang/StringBuilder;", "append", "Ljava/lang/StringBuilder;", "Ljava/lang/String;")
+	println := b.method("Ljava/io/PrintStream;", "println", "V", "Ljava/lang/String;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Log;", "log", "V", "Ljava/io/PrintStream;", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 2, outs: 2, insns: []uint16{
+				0x0022, uint16(b.typ("Ljava/lang/StringBuilder;")), // new-instance v0, StringBuilder
+				0x1070, uint16(init), 0x0000, // invoke-direct {v0}, StringBuilder.<init>
+				0x206e, uint16(appendString), 0x0020, // invoke-virtual {v0, v2}, StringBuilder.append
+				0x206e, uint16(appendString), 0x0020, // invoke-virtual {v0, v2}, StringBuilder.append
+				0x206e, uint16(println), 0x0021, // invoke-virtual {v1, v2}, PrintStream.println
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	methods, err := dex.Classes[0].ReferencedMethods()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	names := []string{}
+	for _, m := range methods {
+		names = append(names, m.Class()+"->"+m.Name())
+	}
+
+	want := []string{"Ljava/lang/StringBuilder;-><init>", "Ljava/lang/StringBuilder;->append", "Ljava/io/PrintStream;->println"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Test failed %v %v", names, want)
+	}
+}
+
+func TestLargestMethods(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Sizes;", "Ljava/lang/Object;")
+	for _, m := range []struct {
+		name string
+		size int
+	}{{"small", 1}, {"large", 9}, {"medium", 4}, {"tiny", 0}} {
+		insns := make([]uint16, m.size)
+		for i := range insns {
+			insns[i] = 0x000e // return-void
+		}
+
+		method := testMethod{idx: b.method("Lcom/example/Sizes;", m.name, "V"), flags: ACC_PUBLIC | ACC_STATIC}
+		if m.size > 0 {
+			method.code = &testCode{insns: insns}
+		}
+		c.directMethods = append(c.directMethods, method)
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	names := []string{}
+	for _, ref := range dex.LargestMethods(2) {
+		names = append(names, ref.Method.Method.Name())
+	}
+
+	if want := []string{"large", "medium"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Test failed %v %v", names, want)
+	}
+
+	if refs := dex.LargestMethods(10); len(refs) != 3 {
+		t.Errorf("Test failed %d %d", len(refs), 3)
+	}
+}
+
+func TestClassesInPackage(t *testing.T) {
+	b := &testDex{}
+	for _, name := range []string{"Lcom/evil/A;", "Lcom/evil/net/B;", "Lcom/evilcorp/C;", "Lcom/example/D;"} {
+		b.class(name, "Ljava/lang/Object;")
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, prefix := range []string{"Lcom/evil/", "Lcom/evil", "com.evil", "com.evil.", "com/evil"} {
+		names := []string{}
+		for _, c := range dex.ClassesInPackage(prefix) {
+			names = append(names, dex.Types[c.ClassIdx].String())
+		}
+
+		if want := []string{"Lcom/evil/A;", "Lcom/evil/net/B;"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Test failed %s %v %v", prefix, names, want)
+		}
+	}
+
+	if classes := dex.ClassesInPackage("org.example"); len(classes) != 0 {
+		t.Errorf("Test failed %d %d", len(classes), 0)
+	}
+}
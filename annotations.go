@@ -0,0 +1,329 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type AnnotationsDirectoryItem struct {
+	ClassAnnotationsOffset  uint32             `pack:"uint"`
+	FieldsSize              uint32             `pack:"uint"`
+	AnnotatedMethodsSize    uint32             `pack:"uint"`
+	AnnotatedParametersSize uint32             `pack:"uint"`
+	FieldAnnotations        []MemberAnnotation `pack:"-"`
+	MethodAnnotations       []MemberAnnotation `pack:"-"`
+	ParameterAnnotations    []MemberAnnotation `pack:"-"`
+}
+
+// MemberAnnotation links a field or method index to its annotations. For
+// parameter annotations the offset points to an annotation_set_ref_list,
+// otherwise to an annotation_set_item.
+type MemberAnnotation struct {
+	Idx               uint32 `pack:"uint"`
+	AnnotationsOffset uint32 `pack:"uint"`
+}
+
+type AnnotationElement struct {
+	dex     *DEX
+	NameIdx uint32
+	Value   EncodedValue
+}
+
+func (e *AnnotationElement) Name() string {
+	return e.dex.string(e.NameIdx)
+}
+
+const (
+	VISIBILITY_BUILD   = 0x00
+	VISIBILITY_RUNTIME = 0x01
+	VISIBILITY_SYSTEM  = 0x02
+)
+
+type Visibility byte
+
+func (v Visibility) String() string {
+	switch v {
+	case VISIBILITY_BUILD:
+		return "build"
+	case VISIBILITY_RUNTIME:
+		return "runtime"
+	case VISIBILITY_SYSTEM:
+		return "system"
+	}
+	return "UNKNOWN"
+}
+
+type Annotation struct {
+	dex *DEX
+	// Visibility is only set for annotation items, annotations nested in
+	// encoded values have none.
+	Visibility Visibility
+	TypeIdx    uint32
+	Values     []AnnotationElement
+	// Elements holds the decoded element values by name, see
+	// EncodedValue.Decode for their Go types.
+	Elements map[string]interface{}
+}
+
+// Type returns the type descriptor of the annotation.
+func (a *Annotation) Type() string {
+	return a.dex.Types[a.TypeIdx].String()
+}
+
+func (d *DEX) readAnnotationsDirectory(off uint32) (*AnnotationsDirectoryItem, error) {
+	if uint64(off)+16 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid annotations directory offset %x", off)
+	}
+
+	dir := AnnotationsDirectoryItem{}
+	if _, err := Unpack(d.b[off:], &dir); err != nil {
+		return nil, err
+	}
+
+	count := uint64(dir.FieldsSize) + uint64(dir.AnnotatedMethodsSize) + uint64(dir.AnnotatedParametersSize)
+	if uint64(off)+16+count*8 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid annotations directory size at %x", off)
+	}
+
+	items := make([]MemberAnnotation, count)
+	for i := range items {
+		if _, err := Unpack(d.b[uint64(off)+16+uint64(i)*8:], &items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	dir.FieldAnnotations = items[:dir.FieldsSize]
+	dir.MethodAnnotations = items[dir.FieldsSize : dir.FieldsSize+dir.AnnotatedMethodsSize]
+	dir.ParameterAnnotations = items[dir.FieldsSize+dir.AnnotatedMethodsSize:]
+	return &dir, nil
+}
+
+// readUints reads the uint sized list prefixed by its size at off, as used
+// by annotation_set_item and annotation_set_ref_list.
+func (d *DEX) readUints(off uint32) ([]uint32, error) {
+	if uint64(off)+4 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid list offset %x", off)
+	}
+
+	size := binary.LittleEndian.Uint32(d.b[off:])
+	if uint64(off)+4+uint64(size)*4 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid list size %d at %x", size, off)
+	}
+
+	values := make([]uint32, size)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(d.b[off+4+uint32(i)*4:])
+	}
+	return values, nil
+}
+
+func (d *DEX) readAnnotationSet(off uint32) ([]Annotation, error) {
+	offsets, err := d.readUints(off)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]Annotation, len(offsets))
+	for i, annotationOff := range offsets {
+		// annotation_item, the visibility byte precedes the annotation
+		if uint64(annotationOff)+1 > uint64(len(d.b)) {
+			return nil, fmt.Errorf("Invalid annotation offset %x", annotationOff)
+		}
+
+		annotation, _, err := d.readEncodedAnnotation(d.b[annotationOff+1:], DEFAULT_MAX_DEPTH)
+		if err != nil {
+			return nil, err
+		}
+		annotation.Visibility = Visibility(d.b[annotationOff])
+		annotations[i] = annotation
+	}
+	return annotations, nil
+}
+
+// readAnnotationSetRefList reads the annotation sets of each parameter.
+// Parameters without annotations have an empty set.
+func (d *DEX) readAnnotationSetRefList(off uint32) ([][]Annotation, error) {
+	offsets, err := d.readUints(off)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([][]Annotation, len(offsets))
+	for i, setOff := range offsets {
+		if setOff == 0 {
+			continue
+		}
+
+		if sets[i], err = d.readAnnotationSet(setOff); err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+// readEncodedAnnotation reads the encoded_annotation at the start of b,
+// its values may nest at most depth levels.
+func (d *DEX) readEncodedAnnotation(b []byte, depth int) (Annotation, int, error) {
+	annotation := Annotation{dex: d, Elements: map[string]interface{}{}}
+
+	typeIdx, offset, err := readUleb128(b)
+	if err != nil {
+		return annotation, 0, err
+	}
+
+	if int(typeIdx) >= len(d.Types) {
+		return annotation, 0, fmt.Errorf("Invalid annotation type %d", typeIdx)
+	}
+	annotation.TypeIdx = typeIdx
+
+	size, length, err := readUleb128(b[offset:])
+	if err != nil {
+		return annotation, 0, err
+	}
+	offset += length
+
+	for i := uint32(0); i < size; i++ {
+		element := AnnotationElement{dex: d}
+
+		if element.NameIdx, length, err = readUleb128(b[offset:]); err != nil {
+			return annotation, 0, err
+		}
+		if int64(element.NameIdx) >= int64(d.StringCount()) {
+			return annotation, 0, fmt.Errorf("Invalid annotation element name %d", element.NameIdx)
+		}
+		offset += length
+
+		value, valueLength, err := d.readEncodedValue(b[offset:], depth)
+		if err != nil {
+			return annotation, 0, err
+		}
+		element.Value = value
+		offset += uint32(valueLength)
+
+		if annotation.Elements[element.Name()], err = value.decode(depth); err != nil {
+			return annotation, 0, err
+		}
+
+		annotation.Values = append(annotation.Values, element)
+	}
+
+	return annotation, int(offset), nil
+}
+
+// annotationsDirectory returns the class's annotations directory, or nil
+// when the class has no annotations.
+func (m *ClassDefItem) annotationsDirectory() (*AnnotationsDirectoryItem, error) {
+	if m.AnnotationsOffset == 0 {
+		return nil, nil
+	}
+	return m.dex.readAnnotationsDirectory(m.AnnotationsOffset)
+}
+
+// Annotations returns the annotations on the class itself.
+func (m *ClassDefItem) Annotations() ([]Annotation, error) {
+	dir, err := m.annotationsDirectory()
+	if err != nil || dir == nil || dir.ClassAnnotationsOffset == 0 {
+		return nil, err
+	}
+	return m.dex.readAnnotationSet(dir.ClassAnnotationsOffset)
+}
+
+// RuntimeAnnotations returns the class annotations that are visible at
+// runtime.
+func (m *ClassDefItem) RuntimeAnnotations() ([]Annotation, error) {
+	annotations, err := m.Annotations()
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := []Annotation{}
+	for _, annotation := range annotations {
+		if annotation.Visibility == VISIBILITY_RUNTIME {
+			runtime = append(runtime, annotation)
+		}
+	}
+	return runtime, nil
+}
+
+// ParameterAnnotations returns the annotations of each of the method's
+// parameters, indexed by parameter position. It returns nil when no
+// parameter is annotated.
+func (m *EncodedMethod) ParameterAnnotations() ([][]Annotation, error) {
+	dir, err := m.dex.Classes[m.classIdx].annotationsDirectory()
+	if err != nil || dir == nil {
+		return nil, err
+	}
+
+	for _, item := range dir.ParameterAnnotations {
+		if item.Idx == m.MethodIdx {
+			return m.dex.readAnnotationSetRefList(item.AnnotationsOffset)
+		}
+	}
+	return nil, nil
+}
+
+// Annotations returns the annotations on the field, or nil when it has
+// none.
+func (f *EncodedField) Annotations() ([]Annotation, error) {
+	dir, err := f.dex.Classes[f.classIdx].annotationsDirectory()
+	if err != nil || dir == nil {
+		return nil, err
+	}
+
+	for _, item := range dir.FieldAnnotations {
+		if item.Idx == f.FieldIdx {
+			return f.dex.readAnnotationSet(item.AnnotationsOffset)
+		}
+	}
+	return nil, nil
+}
+
+// DuplicateAnnotationSets returns how many annotation sets have the same
+// content as an earlier set. dx and d8 store every set once, duplicates
+// suggest the file was not built by the standard tools. Sets that fail to
+// parse are not counted.
+func (d *DEX) DuplicateAnnotationSets() int {
+	off, size, ok := d.SectionOffset(TYPE_ANNOTATION_SET_ITEM)
+	if !ok {
+		return 0
+	}
+
+	seen := map[string]bool{}
+	duplicates := 0
+	for i := uint32(0); i < size; i++ {
+		offsets, err := d.readUints(off)
+		if err != nil {
+			break
+		}
+		off += 4 + uint32(len(offsets))*4
+
+		content, err := d.annotationSetContent(offsets)
+		if err != nil {
+			continue
+		}
+
+		if seen[content] {
+			duplicates++
+		}
+		seen[content] = true
+	}
+	return duplicates
+}
+
+// annotationSetContent returns the concatenated annotation_items of a set,
+// they are self delimiting so equal content means equal sets.
+func (d *DEX) annotationSetContent(offsets []uint32) (string, error) {
+	content := []byte{}
+	for _, annotationOff := range offsets {
+		if uint64(annotationOff)+1 > uint64(len(d.b)) {
+			return "", fmt.Errorf("Invalid annotation offset %x", annotationOff)
+		}
+
+		_, length, err := d.readEncodedAnnotation(d.b[annotationOff+1:], DEFAULT_MAX_DEPTH)
+		if err != nil {
+			return "", err
+		}
+		content = append(content, d.b[annotationOff:annotationOff+1+uint32(length)]...)
+	}
+	return string(content), nil
+}
@@ -0,0 +1,187 @@
+package godex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParameterAnnotations(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Greeter;", "Ljava/lang/Object;")
+
+	greet := b.method("Lcom/example/Greeter;", "greet", "V", "Ljava/lang/String;", "Ljava/lang/String;")
+	c.virtualMethods = []testMethod{
+		{idx: greet, flags: ACC_PUBLIC, code: &testCode{registers: 3, ins: 3, insns: []uint16{0x000e}}},
+	}
+	c.annotations = &testAnnotations{
+		parameters: []testParameterAnnotations{
+			{idx: greet, sets: [][]testAnnotation{
+				nil,
+				{{visibility: 0x02, typ: b.typ("Landroidx/annotation/Nullable;")}},
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	params, err := dex.Classes[0].ClassData.VirtualMethods[0].ParameterAnnotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(params) != 2 {
+		t.Fatalf("Test failed %d %d", len(params), 2)
+	}
+
+	if len(params[0]) != 0 {
+		t.Errorf("Test failed %d %d", len(params[0]), 0)
+	}
+
+	if len(params[1]) != 1 || params[1][0].Type() != "Landroidx/annotation/Nullable;" {
+		t.Errorf("Test failed %v %s", params[1], "Landroidx/annotation/Nullable;")
+	}
+}
+
+func TestRuntimeAnnotations(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Service;", "Ljava/lang/Object;")
+	c.annotations = &testAnnotations{
+		class: []testAnnotation{
+			{visibility: VISIBILITY_BUILD, typ: b.typ("Lcom/example/Generated;")},
+			{visibility: VISIBILITY_RUNTIME, typ: b.typ("Lcom/example/Exported;")},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	annotations, err := dex.Classes[0].Annotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(annotations) != 2 || annotations[0].Visibility != VISIBILITY_BUILD || annotations[1].Visibility != VISIBILITY_RUNTIME {
+		t.Fatalf("Test failed %v", annotations)
+	}
+
+	runtime, err := dex.Classes[0].RuntimeAnnotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(runtime) != 1 || runtime[0].Type() != "Lcom/example/Exported;" {
+		t.Errorf("Test failed %v %s", runtime, "Lcom/example/Exported;")
+	}
+}
+
+func TestFieldAnnotations(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/User;", "Ljava/lang/Object;")
+	name := b.field("Lcom/example/User;", "Ljava/lang/String;", "name")
+	id := b.field("Lcom/example/User;", "I", "id")
+	c.instanceFields = []testField{
+		{idx: name, flags: ACC_PRIVATE},
+		{idx: id, flags: ACC_PRIVATE},
+	}
+	c.annotations = &testAnnotations{
+		fields: []testMemberAnnotations{
+			{idx: name, set: []testAnnotation{
+				{visibility: VISIBILITY_RUNTIME, typ: b.typ("Lcom/google/gson/annotations/SerializedName;"), elements: []testElement{
+					{name: b.str("value"), value: []byte{VALUE_STRING, byte(b.str("user_name"))}},
+				}},
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	fields := dex.Classes[0].ClassData.InstanceFields
+	annotations, err := fields[0].Annotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(annotations) != 1 {
+		t.Fatalf("Test failed %d %d", len(annotations), 1)
+	}
+
+	if typ := annotations[0].Type(); typ != "Lcom/google/gson/annotations/SerializedName;" {
+		t.Errorf("Test failed %s %s", typ, "Lcom/google/gson/annotations/SerializedName;")
+	}
+
+	if v, _ := annotations[0].Values[0].Value.Decode(); v != "user_name" {
+		t.Errorf("Test failed %v %v", v, "user_name")
+	}
+
+	if annotations, err := fields[1].Annotations(); err != nil || len(annotations) != 0 {
+		t.Errorf("Test failed %v %v", annotations, err)
+	}
+}
+
+func TestAnnotationElements(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Config;", "Ljava/lang/Object;")
+	c.annotations = &testAnnotations{
+		class: []testAnnotation{
+			{visibility: VISIBILITY_RUNTIME, typ: b.typ("Lcom/example/Settings;"), elements: []testElement{
+				{name: b.str("name"), value: []byte{VALUE_STRING, byte(b.str("config"))}},
+				{name: b.str("ports"), value: []byte{VALUE_ARRAY, 0x02, VALUE_INT, 0x50, 0x20 | VALUE_INT, 0x2c, 0x01}},
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	annotations, err := dex.Classes[0].Annotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[string]interface{}{
+		"name":  "config",
+		"ports": []interface{}{int64(80), int64(300)},
+	}
+	if !reflect.DeepEqual(annotations[0].Elements, want) {
+		t.Errorf("Test failed %v %v", annotations[0].Elements, want)
+	}
+}
+
+func TestDuplicateAnnotationSets(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Pair;", "Ljava/lang/Object;")
+	c.instanceFields = []testField{
+		{idx: b.field("Lcom/example/Pair;", "I", "first"), flags: ACC_PRIVATE},
+		{idx: b.field("Lcom/example/Pair;", "I", "second"), flags: ACC_PRIVATE},
+		{idx: b.field("Lcom/example/Pair;", "I", "third"), flags: ACC_PRIVATE},
+	}
+
+	keep := b.typ("Lcom/example/Keep;")
+	c.annotations = &testAnnotations{
+		class: []testAnnotation{{visibility: VISIBILITY_BUILD, typ: keep}},
+		fields: []testMemberAnnotations{
+			{idx: 0, set: []testAnnotation{{visibility: VISIBILITY_RUNTIME, typ: keep}}},
+			{idx: 1, set: []testAnnotation{{visibility: VISIBILITY_RUNTIME, typ: keep}}},
+			{idx: 2, set: []testAnnotation{{visibility: VISIBILITY_RUNTIME, typ: b.typ("Lcom/example/Other;")}}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if got := dex.DuplicateAnnotationSets(); got != 1 {
+		t.Errorf("Test failed %v %v", got, 1)
+	}
+}
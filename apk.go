@@ -0,0 +1,75 @@
+package godex
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var classesDexPattern = regexp.MustCompile(`^classes([0-9]*)\.dex$`)
+
+// EachDexInAPK parses the classes.dex, classes2.dex, ... entries of the
+// apk at path in order and calls fn with each. Only one dex is held at a
+// time, so memory stays bounded for apps with many dex files. Iteration
+// stops at the first error.
+func EachDexInAPK(path string, fn func(*DEX) error) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	type entry struct {
+		n    int
+		file *zip.File
+	}
+
+	entries := []entry{}
+	for _, f := range r.File {
+		m := classesDexPattern.FindStringSubmatch(f.Name)
+		if m == nil {
+			continue
+		}
+
+		// classes.dex is the first, the others are numbered from 2
+		n := 1
+		if m[1] != "" {
+			if n, err = strconv.Atoi(m[1]); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, entry{n, f})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].n < entries[j].n })
+
+	for _, e := range entries {
+		if err := eachDexEntry(e.file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eachDexEntry(f *zip.File, fn func(*DEX) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	dex, err := ParseAt(b, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %s", f.Name, err)
+	}
+	return fn(dex)
+}
@@ -0,0 +1,52 @@
+package godex
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEachDexInAPK(t *testing.T) {
+	second := &testDex{}
+	second.class("Lcom/example/Second;", "Ljava/lang/Object;")
+
+	path := filepath.Join(t.TempDir(), "app.apk")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	w := zip.NewWriter(file)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"classes2.dex", second.build()},
+		{"AndroidManifest.xml", []byte{0x03, 0x00}},
+		{"classes.dex", testHelloDEX().build()},
+	} {
+		f, err := w.Create(entry.name)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		f.Write(entry.data)
+	}
+	w.Close()
+	file.Close()
+
+	visited := []string{}
+	err = EachDexInAPK(path, func(dex *DEX) error {
+		visited = append(visited, dex.Types[dex.Classes[0].ClassIdx].String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{"Lcom/example/Hello;", "Lcom/example/Second;"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("Test failed %v %v", visited, want)
+	}
+}
@@ -0,0 +1,645 @@
+package godex
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/adler32"
+	"sort"
+	"unicode/utf16"
+)
+
+// testDex assembles small, well formed dex files for tests. Pools are kept
+// in insertion order; use the str, typ, proto, field and method helpers to
+// intern entries and get their indices back.
+type testDex struct {
+	strings []string
+	types   []uint32
+	protos  []testProto
+	fields  []testFieldId
+	methods []testMethodId
+	classes []*testClass
+	link    []byte
+	// hidden is written to the data section without any reference to it
+	hidden []byte
+}
+
+type testProto struct {
+	shorty uint32
+	ret    uint32
+	params []uint16
+}
+
+type testFieldId struct {
+	class uint16
+	typ   uint16
+	name  uint32
+}
+
+type testMethodId struct {
+	class uint16
+	proto uint16
+	name  uint32
+}
+
+type testClass struct {
+	class          uint32
+	flags          uint32
+	super          uint32
+	interfaces     []uint16
+	source         uint32
+	staticFields   []testField
+	instanceFields []testField
+	directMethods  []testMethod
+	virtualMethods []testMethod
+	// raw encoded_array, nil when the class has no static values
+	staticValues []byte
+	annotations  *testAnnotations
+}
+
+type testAnnotation struct {
+	visibility byte
+	typ        uint16
+	elements   []testElement
+}
+
+type testElement struct {
+	name uint32
+	// raw encoded_value
+	value []byte
+}
+
+// testAnnotations is a class's annotations directory; members must be
+// listed in increasing index order.
+type testAnnotations struct {
+	class      []testAnnotation
+	fields     []testMemberAnnotations
+	methods    []testMemberAnnotations
+	parameters []testParameterAnnotations
+}
+
+type testMemberAnnotations struct {
+	idx uint32
+	set []testAnnotation
+}
+
+type testParameterAnnotations struct {
+	idx uint32
+	// one set per parameter, nil for parameters without annotations
+	sets [][]testAnnotation
+}
+
+type testField struct {
+	idx   uint32
+	flags uint32
+}
+
+type testMethod struct {
+	idx   uint32
+	flags uint32
+	code  *testCode
+}
+
+type testCode struct {
+	registers uint16
+	ins       uint16
+	outs      uint16
+	insns     []uint16
+	tries     []testTry
+	handlers  []testHandler
+}
+
+type testTry struct {
+	start uint32
+	count uint16
+	// index into handlers
+	handler int
+}
+
+type testHandler struct {
+	// type index and address pairs
+	catches     [][2]uint32
+	catchAll    uint32
+	hasCatchAll bool
+}
+
+func (t *testDex) str(s string) uint32 {
+	for i, v := range t.strings {
+		if v == s {
+			return uint32(i)
+		}
+	}
+	t.strings = append(t.strings, s)
+	return uint32(len(t.strings) - 1)
+}
+
+func (t *testDex) typ(descriptor string) uint16 {
+	idx := t.str(descriptor)
+	for i, v := range t.types {
+		if v == idx {
+			return uint16(i)
+		}
+	}
+	t.types = append(t.types, idx)
+	return uint16(len(t.types) - 1)
+}
+
+func shortyOf(descriptor string) string {
+	if descriptor[0] == '[' {
+		return "L"
+	}
+	return descriptor[:1]
+}
+
+func (t *testDex) proto(ret string, params ...string) uint16 {
+	shorty := shortyOf(ret)
+	p := testProto{ret: uint32(t.typ(ret))}
+	for _, param := range params {
+		shorty += shortyOf(param)
+		p.params = append(p.params, t.typ(param))
+	}
+	p.shorty = t.str(shorty)
+
+	for i, v := range t.protos {
+		if v.shorty == p.shorty && v.ret == p.ret && equalUint16s(v.params, p.params) {
+			return uint16(i)
+		}
+	}
+	t.protos = append(t.protos, p)
+	return uint16(len(t.protos) - 1)
+}
+
+func equalUint16s(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *testDex) field(class, typ, name string) uint32 {
+	f := testFieldId{class: t.typ(class), typ: t.typ(typ), name: t.str(name)}
+	for i, v := range t.fields {
+		if v == f {
+			return uint32(i)
+		}
+	}
+	t.fields = append(t.fields, f)
+	return uint32(len(t.fields) - 1)
+}
+
+func (t *testDex) method(class, name, ret string, params ...string) uint32 {
+	m := testMethodId{class: t.typ(class), proto: t.proto(ret, params...), name: t.str(name)}
+	for i, v := range t.methods {
+		if v == m {
+			return uint32(i)
+		}
+	}
+	t.methods = append(t.methods, m)
+	return uint32(len(t.methods) - 1)
+}
+
+// class adds a public class extending super, which may be empty for none.
+func (t *testDex) class(descriptor, super string) *testClass {
+	c := &testClass{
+		class:  uint32(t.typ(descriptor)),
+		flags:  ACC_PUBLIC,
+		super:  NO_INDEX,
+		source: t.str("Test.java"),
+	}
+	if super != "" {
+		c.super = uint32(t.typ(super))
+	}
+	t.classes = append(t.classes, c)
+	return c
+}
+
+func putUleb(b []byte, v uint32) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func putSleb(b []byte, v int32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+type testSection struct {
+	kind  uint16
+	count uint32
+	off   uint32
+}
+
+type testWriter struct {
+	base     uint32
+	data     []byte
+	sections []testSection
+}
+
+func (w *testWriter) off() uint32 {
+	return w.base + uint32(len(w.data))
+}
+
+func (w *testWriter) align() {
+	for len(w.data)%4 != 0 {
+		w.data = append(w.data, 0)
+	}
+}
+
+// item records an item of the given map type at the current offset.
+func (w *testWriter) item(kind uint16) uint32 {
+	if kind != 0x2002 && kind != 0x2000 && kind != 0x2004 && kind != 0x2005 {
+		w.align()
+	}
+
+	off := w.off()
+	if n := len(w.sections); n > 0 && w.sections[n-1].kind == kind {
+		w.sections[n-1].count++
+	} else {
+		w.sections = append(w.sections, testSection{kind: kind, count: 1, off: off})
+	}
+	return off
+}
+
+func (w *testWriter) u16(v uint16) {
+	w.data = binary.LittleEndian.AppendUint16(w.data, v)
+}
+
+func (w *testWriter) u32(v uint32) {
+	w.data = binary.LittleEndian.AppendUint32(w.data, v)
+}
+
+func (w *testWriter) uleb(v uint32) {
+	w.data = putUleb(w.data, v)
+}
+
+func (w *testWriter) typeList(types []uint16) uint32 {
+	if len(types) == 0 {
+		return 0
+	}
+	off := w.item(0x1001)
+	w.u32(uint32(len(types)))
+	for _, t := range types {
+		w.u16(t)
+	}
+	return off
+}
+
+func (w *testWriter) code(c *testCode) uint32 {
+	off := w.item(0x2001)
+	w.u16(c.registers)
+	w.u16(c.ins)
+	w.u16(c.outs)
+	w.u16(uint16(len(c.tries)))
+	w.u32(0)
+	w.u32(uint32(len(c.insns)))
+	for _, insn := range c.insns {
+		w.u16(insn)
+	}
+
+	if len(c.tries) == 0 {
+		return off
+	}
+
+	if len(c.insns)%2 != 0 {
+		w.u16(0)
+	}
+
+	// encoded_catch_handler_list, tries refer to handlers by offset
+	list := putUleb(nil, uint32(len(c.handlers)))
+	offsets := make([]uint16, len(c.handlers))
+	for i, h := range c.handlers {
+		offsets[i] = uint16(len(list))
+
+		size := int32(len(h.catches))
+		if h.hasCatchAll {
+			size = -size
+		}
+		list = putSleb(list, size)
+
+		for _, catch := range h.catches {
+			list = putUleb(list, catch[0])
+			list = putUleb(list, catch[1])
+		}
+
+		if h.hasCatchAll {
+			list = putUleb(list, h.catchAll)
+		}
+	}
+
+	for _, try := range c.tries {
+		w.u32(try.start)
+		w.u16(try.count)
+		w.u16(offsets[try.handler])
+	}
+	w.data = append(w.data, list...)
+	return off
+}
+
+func encodedFields(w *testWriter, fields []testField) {
+	prev := uint32(0)
+	for _, f := range fields {
+		w.uleb(f.idx - prev)
+		w.uleb(f.flags)
+		prev = f.idx
+	}
+}
+
+func encodedMethods(w *testWriter, methods []testMethod, codeOffs map[*testCode]uint32) {
+	prev := uint32(0)
+	for _, m := range methods {
+		w.uleb(m.idx - prev)
+		w.uleb(m.flags)
+		w.uleb(codeOffs[m.code])
+		prev = m.idx
+	}
+}
+
+// sets returns all annotation sets of the directory in a stable order.
+func (a *testAnnotations) sets() [][]testAnnotation {
+	sets := [][]testAnnotation{a.class}
+	for _, f := range a.fields {
+		sets = append(sets, f.set)
+	}
+	for _, m := range a.methods {
+		sets = append(sets, m.set)
+	}
+	for _, p := range a.parameters {
+		sets = append(sets, p.sets...)
+	}
+	return sets
+}
+
+// annotations writes all annotation items, then sets, then ref lists and
+// finally the directories, so each map section is contiguous.
+func (w *testWriter) annotations(classes []*testClass) []uint32 {
+	items := map[*testAnnotation]uint32{}
+	for _, c := range classes {
+		if c.annotations == nil {
+			continue
+		}
+		for _, set := range c.annotations.sets() {
+			for i := range set {
+				a := &set[i]
+				items[a] = w.item(0x2004)
+				w.data = append(w.data, a.visibility)
+				w.uleb(uint32(a.typ))
+				w.uleb(uint32(len(a.elements)))
+				for _, e := range a.elements {
+					w.uleb(e.name)
+					w.data = append(w.data, e.value...)
+				}
+			}
+		}
+	}
+
+	sets := map[*testAnnotation]uint32{}
+	setOff := func(set []testAnnotation) uint32 {
+		if len(set) == 0 {
+			return 0
+		}
+		return sets[&set[0]]
+	}
+	for _, c := range classes {
+		if c.annotations == nil {
+			continue
+		}
+		for _, set := range c.annotations.sets() {
+			if len(set) == 0 {
+				continue
+			}
+			sets[&set[0]] = w.item(0x1003)
+			w.u32(uint32(len(set)))
+			for i := range set {
+				w.u32(items[&set[i]])
+			}
+		}
+	}
+
+	refLists := map[*testParameterAnnotations]uint32{}
+	for _, c := range classes {
+		if c.annotations == nil {
+			continue
+		}
+		for i := range c.annotations.parameters {
+			p := &c.annotations.parameters[i]
+			refLists[p] = w.item(0x1002)
+			w.u32(uint32(len(p.sets)))
+			for _, set := range p.sets {
+				w.u32(setOff(set))
+			}
+		}
+	}
+
+	dirs := make([]uint32, len(classes))
+	for i, c := range classes {
+		a := c.annotations
+		if a == nil {
+			continue
+		}
+		dirs[i] = w.item(0x2006)
+		w.u32(setOff(a.class))
+		w.u32(uint32(len(a.fields)))
+		w.u32(uint32(len(a.methods)))
+		w.u32(uint32(len(a.parameters)))
+		for _, f := range a.fields {
+			w.u32(f.idx)
+			w.u32(setOff(f.set))
+		}
+		for _, m := range a.methods {
+			w.u32(m.idx)
+			w.u32(setOff(m.set))
+		}
+		for j := range a.parameters {
+			w.u32(a.parameters[j].idx)
+			w.u32(refLists[&a.parameters[j]])
+		}
+	}
+	return dirs
+}
+
+func (t *testDex) build() []byte {
+	const headerSize = 0x70
+
+	stringIdsOff := uint32(headerSize)
+	typeIdsOff := stringIdsOff + 4*uint32(len(t.strings))
+	protoIdsOff := typeIdsOff + 4*uint32(len(t.types))
+	fieldIdsOff := protoIdsOff + 12*uint32(len(t.protos))
+	methodIdsOff := fieldIdsOff + 8*uint32(len(t.fields))
+	classDefsOff := methodIdsOff + 8*uint32(len(t.methods))
+	dataOff := classDefsOff + 32*uint32(len(t.classes))
+
+	w := &testWriter{base: dataOff}
+
+	protoParams := make([]uint32, len(t.protos))
+	for i, p := range t.protos {
+		protoParams[i] = w.typeList(p.params)
+	}
+
+	interfaces := make([]uint32, len(t.classes))
+	for i, c := range t.classes {
+		interfaces[i] = w.typeList(c.interfaces)
+	}
+
+	stringData := make([]uint32, len(t.strings))
+	for i, s := range t.strings {
+		stringData[i] = w.item(0x2002)
+		w.uleb(uint32(len(utf16.Encode([]rune(s)))))
+		w.data = append(w.data, s...)
+		w.data = append(w.data, 0)
+	}
+
+	codeOffs := map[*testCode]uint32{nil: 0}
+	for _, c := range t.classes {
+		for _, methods := range [][]testMethod{c.directMethods, c.virtualMethods} {
+			for _, m := range methods {
+				if _, ok := codeOffs[m.code]; !ok {
+					codeOffs[m.code] = w.code(m.code)
+				}
+			}
+		}
+	}
+
+	classData := make([]uint32, len(t.classes))
+	for i, c := range t.classes {
+		if len(c.staticFields)+len(c.instanceFields)+len(c.directMethods)+len(c.virtualMethods) == 0 {
+			continue
+		}
+
+		classData[i] = w.item(0x2000)
+		w.uleb(uint32(len(c.staticFields)))
+		w.uleb(uint32(len(c.instanceFields)))
+		w.uleb(uint32(len(c.directMethods)))
+		w.uleb(uint32(len(c.virtualMethods)))
+		encodedFields(w, c.staticFields)
+		encodedFields(w, c.instanceFields)
+		encodedMethods(w, c.directMethods, codeOffs)
+		encodedMethods(w, c.virtualMethods, codeOffs)
+	}
+
+	staticValues := make([]uint32, len(t.classes))
+	for i, c := range t.classes {
+		if c.staticValues == nil {
+			continue
+		}
+		staticValues[i] = w.item(0x2005)
+		w.data = append(w.data, c.staticValues...)
+	}
+
+	w.data = append(w.data, t.hidden...)
+
+	annotations := w.annotations(t.classes)
+
+	sections := []testSection{
+		{0x0000, 1, 0},
+		{0x0001, uint32(len(t.strings)), stringIdsOff},
+		{0x0002, uint32(len(t.types)), typeIdsOff},
+		{0x0003, uint32(len(t.protos)), protoIdsOff},
+		{0x0004, uint32(len(t.fields)), fieldIdsOff},
+		{0x0005, uint32(len(t.methods)), methodIdsOff},
+		{0x0006, uint32(len(t.classes)), classDefsOff},
+	}
+	sections = append(sections, w.sections...)
+
+	mapOff := w.item(0x1000)
+	sections = append(sections, testSection{0x1000, 1, mapOff})
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].off < sections[j].off })
+
+	var items []testSection
+	for _, s := range sections {
+		if s.count > 0 {
+			items = append(items, s)
+		}
+	}
+	w.u32(uint32(len(items)))
+	for _, s := range items {
+		w.u16(s.kind)
+		w.u16(0)
+		w.u32(s.count)
+		w.u32(s.off)
+	}
+
+	dataSize := uint32(len(w.data))
+
+	b := make([]byte, dataOff, int(dataOff)+len(w.data)+len(t.link))
+	b = append(b, w.data...)
+
+	linkOff := uint32(0)
+	if len(t.link) > 0 {
+		linkOff = uint32(len(b))
+		b = append(b, t.link...)
+	}
+
+	copy(b, DEX_FILE_MAGIC)
+	le := binary.LittleEndian
+	le.PutUint32(b[32:], uint32(len(b)))
+	le.PutUint32(b[36:], headerSize)
+	le.PutUint32(b[40:], ENDIAN_CONSTANT)
+	le.PutUint32(b[44:], uint32(len(t.link)))
+	le.PutUint32(b[48:], linkOff)
+	le.PutUint32(b[52:], mapOff)
+
+	counts := []uint32{
+		uint32(len(t.strings)), stringIdsOff,
+		uint32(len(t.types)), typeIdsOff,
+		uint32(len(t.protos)), protoIdsOff,
+		uint32(len(t.fields)), fieldIdsOff,
+		uint32(len(t.methods)), methodIdsOff,
+		uint32(len(t.classes)), classDefsOff,
+		dataSize, dataOff,
+	}
+	for i, v := range counts {
+		if v == 0 || i%2 == 1 && counts[i-1] == 0 {
+			continue
+		}
+		le.PutUint32(b[56+4*i:], v)
+	}
+
+	for i := range t.strings {
+		le.PutUint32(b[stringIdsOff+4*uint32(i):], stringData[i])
+	}
+	for i, v := range t.types {
+		le.PutUint32(b[typeIdsOff+4*uint32(i):], v)
+	}
+	for i, p := range t.protos {
+		o := protoIdsOff + 12*uint32(i)
+		le.PutUint32(b[o:], p.shorty)
+		le.PutUint32(b[o+4:], p.ret)
+		le.PutUint32(b[o+8:], protoParams[i])
+	}
+	for i, f := range t.fields {
+		o := fieldIdsOff + 8*uint32(i)
+		le.PutUint16(b[o:], f.class)
+		le.PutUint16(b[o+2:], f.typ)
+		le.PutUint32(b[o+4:], f.name)
+	}
+	for i, m := range t.methods {
+		o := methodIdsOff + 8*uint32(i)
+		le.PutUint16(b[o:], m.class)
+		le.PutUint16(b[o+2:], m.proto)
+		le.PutUint32(b[o+4:], m.name)
+	}
+	for i, c := range t.classes {
+		o := classDefsOff + 32*uint32(i)
+		for j, v := range []uint32{c.class, c.flags, c.super, interfaces[i], c.source, annotations[i], classData[i], staticValues[i]} {
+			le.PutUint32(b[o+4*uint32(j):], v)
+		}
+	}
+
+	sum := sha1.Sum(b[32:])
+	copy(b[12:32], sum[:])
+	le.PutUint32(b[8:], adler32.Checksum(b[12:]))
+	return b
+}
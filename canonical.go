@@ -0,0 +1,1063 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// canonical rebuilds a dex with its pools in canonical order. The maps
+// translate old pool indices to new ones.
+type canonical struct {
+	d *DEX
+	b []byte
+
+	strings   []string
+	stringMap []uint32
+	types     []uint32
+	typeMap   []uint32
+	protos    []canonicalProto
+	protoMap  []uint32
+	fields    [][]uint32
+	fieldMap  []uint32
+	methods   [][]uint32
+	methodMap []uint32
+
+	// data sections in the order they are written
+	sections []MapItem
+	// offsets of shared items, keyed by item type and content
+	shared map[string]uint32
+}
+
+type canonicalProto struct {
+	shorty uint32
+	ret    uint32
+	params []uint32
+}
+
+// Canonicalize rebuilds the dex with the string, type, proto, field and
+// method ids sorted as the format requires, duplicates merged and all
+// references renumbered. Items in the data section are written in a fixed
+// order and identical type lists, annotations and static values are
+// shared, so files with the same content canonicalize to the same bytes.
+// Link data is dropped. Files with call sites, method handles or hidden
+// api data are not supported.
+func (d *DEX) Canonicalize() ([]byte, error) {
+	for _, item := range d.Map {
+		switch item.Type {
+		case TYPE_CALL_SITE_ID_ITEM, TYPE_METHOD_HANDLE_ITEM, TYPE_HIDDENAPI_CLASS_DATA_ITEM:
+			return nil, fmt.Errorf("Canonicalize does not support map item type %x", item.Type)
+		}
+	}
+
+	c := &canonical{d: d, shared: map[string]uint32{}}
+	if err := c.sortPools(); err != nil {
+		return nil, err
+	}
+	return c.write()
+}
+
+// canonicalOrder sorts keys, returning the old index of each unique key in
+// order and the new index of every old one.
+func canonicalOrder(keys [][]uint32) ([]int, []uint32) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return compareUint32s(keys[order[i]], keys[order[j]]) < 0 })
+
+	unique := []int{}
+	mapping := make([]uint32, len(keys))
+	for _, old := range order {
+		if len(unique) == 0 || compareUint32s(keys[unique[len(unique)-1]], keys[old]) != 0 {
+			unique = append(unique, old)
+		}
+		mapping[old] = uint32(len(unique) - 1)
+	}
+	return unique, mapping
+}
+
+func (c *canonical) sortPools() error {
+	d := c.d
+
+	old := make([]string, d.StringCount())
+	keys := make([][]uint32, len(old))
+	for i := range old {
+		s, err := d.StringAt(uint32(i))
+		if err != nil {
+			return err
+		}
+		old[i] = s
+
+		for _, unit := range utf16.Encode([]rune(s)) {
+			keys[i] = append(keys[i], uint32(unit))
+		}
+	}
+
+	var order []int
+	order, c.stringMap = canonicalOrder(keys)
+	for _, i := range order {
+		c.strings = append(c.strings, old[i])
+	}
+
+	keys = make([][]uint32, len(d.Types))
+	for i, t := range d.Types {
+		descriptor, err := c.index("string", t.DescriptorIdx)
+		if err != nil {
+			return err
+		}
+		keys[i] = []uint32{descriptor}
+	}
+
+	order, c.typeMap = canonicalOrder(keys)
+	for _, i := range order {
+		c.types = append(c.types, keys[i][0])
+	}
+
+	protos := make([]canonicalProto, len(d.Prototypes))
+	keys = make([][]uint32, len(d.Prototypes))
+	for i, p := range d.Prototypes {
+		params, err := d.readTypeList(p.ParametersOffset)
+		if err != nil {
+			return err
+		}
+
+		proto := &protos[i]
+		if proto.shorty, err = c.index("string", p.ShortyIdx); err != nil {
+			return err
+		}
+		if proto.ret, err = c.index("type", p.ReturnTypeIdx); err != nil {
+			return err
+		}
+		for _, param := range params {
+			typeIdx, err := c.index("type", uint32(param))
+			if err != nil {
+				return err
+			}
+			proto.params = append(proto.params, typeIdx)
+		}
+		keys[i] = append([]uint32{proto.ret}, proto.params...)
+	}
+
+	order, c.protoMap = canonicalOrder(keys)
+	for _, i := range order {
+		c.protos = append(c.protos, protos[i])
+	}
+
+	// fields and methods sort by class, name and type or proto, they are
+	// written in the order class, type or proto, name
+	keys = make([][]uint32, len(d.Fields))
+	for i, f := range d.Fields {
+		key, err := c.indices([]string{"type", "string", "type"}, []uint32{uint32(f.ClassIdx), f.NameIdx, uint32(f.TypeIdx)})
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	order, c.fieldMap = canonicalOrder(keys)
+	for _, i := range order {
+		c.fields = append(c.fields, keys[i])
+	}
+
+	keys = make([][]uint32, len(d.Methods))
+	for i, m := range d.Methods {
+		key, err := c.indices([]string{"type", "string", "proto"}, []uint32{uint32(m.ClassIdx), m.NameIdx, uint32(m.ProtoIdx)})
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	order, c.methodMap = canonicalOrder(keys)
+	for _, i := range order {
+		c.methods = append(c.methods, keys[i])
+	}
+	return nil
+}
+
+// index returns the new index of pool index idx, kind is named as in the
+// instruction syntax.
+func (c *canonical) index(kind string, idx uint32) (uint32, error) {
+	var mapping []uint32
+	switch kind {
+	case "string":
+		mapping = c.stringMap
+	case "type":
+		mapping = c.typeMap
+	case "proto":
+		mapping = c.protoMap
+	case "field":
+		mapping = c.fieldMap
+	case "meth":
+		mapping = c.methodMap
+	default:
+		return 0, fmt.Errorf("Canonicalize does not support %s indices", kind)
+	}
+
+	if int64(idx) >= int64(len(mapping)) {
+		return 0, &IndexError{Kind: kind, Index: idx, Max: len(mapping)}
+	}
+	return mapping[idx], nil
+}
+
+func (c *canonical) indices(kinds []string, idx []uint32) ([]uint32, error) {
+	mapped := make([]uint32, len(idx))
+	for i := range idx {
+		var err error
+		if mapped[i], err = c.index(kinds[i], idx[i]); err != nil {
+			return nil, err
+		}
+	}
+	return mapped, nil
+}
+
+// optionalIndex is index for references that may be NO_INDEX.
+func (c *canonical) optionalIndex(kind string, idx uint32) (uint32, error) {
+	if idx == NO_INDEX {
+		return NO_INDEX, nil
+	}
+	return c.index(kind, idx)
+}
+
+// item starts an item of itemType at the next multiple of align and
+// returns its offset.
+func (c *canonical) item(itemType uint16, align int) uint32 {
+	for len(c.b)%align != 0 {
+		c.b = append(c.b, 0x00)
+	}
+
+	off := uint32(len(c.b))
+	if n := len(c.sections); n == 0 || c.sections[n-1].Type != itemType {
+		c.sections = append(c.sections, MapItem{Type: itemType, Offset: off})
+	}
+	c.sections[len(c.sections)-1].Size++
+	return off
+}
+
+// share writes content as an item of itemType, unless an identical item
+// was written before, and returns its offset.
+func (c *canonical) share(itemType uint16, align int, content []byte) uint32 {
+	key := string([]byte{byte(itemType >> 8), byte(itemType)}) + string(content)
+	if off, ok := c.shared[key]; ok {
+		return off
+	}
+
+	off := c.item(itemType, align)
+	c.b = append(c.b, content...)
+	c.shared[key] = off
+	return off
+}
+
+func (c *canonical) write() ([]byte, error) {
+	d := c.d
+	le := binary.LittleEndian
+
+	stringIds := uint32(0x70)
+	typeIds := stringIds + uint32(len(c.strings))*4
+	protoIds := typeIds + uint32(len(c.types))*4
+	fieldIds := protoIds + uint32(len(c.protos))*12
+	methodIds := fieldIds + uint32(len(c.fields))*8
+	classDefs := methodIds + uint32(len(c.methods))*8
+	dataOff := classDefs + uint32(len(d.Classes))*32
+
+	c.b = make([]byte, dataOff)
+
+	for i, s := range c.strings {
+		le.PutUint32(c.b[stringIds+uint32(i)*4:], c.item(TYPE_STRING_DATA_ITEM, 1))
+		c.b = appendStringData(c.b, s)
+	}
+
+	for i, t := range c.types {
+		le.PutUint32(c.b[typeIds+uint32(i)*4:], t)
+	}
+
+	for i, p := range c.protos {
+		o := protoIds + uint32(i)*12
+		le.PutUint32(c.b[o:], p.shorty)
+		le.PutUint32(c.b[o+4:], p.ret)
+		le.PutUint32(c.b[o+8:], c.typeList(p.params))
+	}
+
+	for i, f := range c.fields {
+		o := fieldIds + uint32(i)*8
+		le.PutUint16(c.b[o:], uint16(f[0]))
+		le.PutUint16(c.b[o+2:], uint16(f[2]))
+		le.PutUint32(c.b[o+4:], f[1])
+	}
+
+	for i, m := range c.methods {
+		o := methodIds + uint32(i)*8
+		le.PutUint16(c.b[o:], uint16(m[0]))
+		le.PutUint16(c.b[o+2:], uint16(m[2]))
+		le.PutUint32(c.b[o+4:], m[1])
+	}
+
+	classes := make([][8]uint32, len(d.Classes))
+	for i := range d.Classes {
+		def := &classes[i]
+		cls := &d.Classes[i]
+
+		var err error
+		if def[0], err = c.index("type", cls.ClassIdx); err != nil {
+			return nil, err
+		}
+		def[1] = uint32(cls.AccessFlags)
+		if def[2], err = c.optionalIndex("type", cls.SuperclassIdx); err != nil {
+			return nil, err
+		}
+		if def[4], err = c.optionalIndex("string", cls.SourceFileIdx); err != nil {
+			return nil, err
+		}
+
+		interfaces, err := d.readTypeList(cls.InterfacesOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		mapped := make([]uint32, len(interfaces))
+		for j, typeIdx := range interfaces {
+			if mapped[j], err = c.index("type", uint32(typeIdx)); err != nil {
+				return nil, err
+			}
+		}
+		def[3] = c.typeList(mapped)
+	}
+
+	directories, err := c.annotations()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := c.codeItems()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range d.Classes {
+		classes[i][5] = directories[i]
+		if classes[i][6], err = c.classData(&d.Classes[i], codes); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range d.Classes {
+		if classes[i][7], err = c.staticValues(&d.Classes[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, def := range classes {
+		for j, v := range def {
+			le.PutUint32(c.b[classDefs+uint32(i)*32+uint32(j)*4:], v)
+		}
+	}
+
+	mapOff := c.item(TYPE_MAP_LIST, 4)
+	ids := []MapItem{
+		{Type: TYPE_HEADER_ITEM, Size: 1, Offset: 0},
+		{Type: TYPE_STRING_ID_ITEM, Size: uint32(len(c.strings)), Offset: stringIds},
+		{Type: TYPE_TYPE_ID_ITEM, Size: uint32(len(c.types)), Offset: typeIds},
+		{Type: TYPE_PROTO_ID_ITEM, Size: uint32(len(c.protos)), Offset: protoIds},
+		{Type: TYPE_FIELD_ID_ITEM, Size: uint32(len(c.fields)), Offset: fieldIds},
+		{Type: TYPE_METHOD_ID_ITEM, Size: uint32(len(c.methods)), Offset: methodIds},
+		{Type: TYPE_CLASS_DEF_ITEM, Size: uint32(len(d.Classes)), Offset: classDefs},
+	}
+
+	items := []MapItem{}
+	for _, item := range append(ids, c.sections...) {
+		if item.Size > 0 {
+			items = append(items, item)
+		}
+	}
+
+	c.b = le.AppendUint32(c.b, uint32(len(items)))
+	for _, item := range items {
+		c.b = le.AppendUint16(c.b, item.Type)
+		c.b = le.AppendUint16(c.b, 0)
+		c.b = le.AppendUint32(c.b, item.Size)
+		c.b = le.AppendUint32(c.b, item.Offset)
+	}
+
+	b := c.b
+	copy(b, d.header.Magic[:])
+	le.PutUint32(b[32:], uint32(len(b)))
+	le.PutUint32(b[36:], 0x70)
+	le.PutUint32(b[40:], ENDIAN_CONSTANT)
+	le.PutUint32(b[52:], mapOff)
+
+	for i, section := range []MapItem{ids[1], ids[2], ids[3], ids[4], ids[5], ids[6], {Size: uint32(len(b)) - dataOff, Offset: dataOff}} {
+		if section.Size == 0 {
+			continue
+		}
+		le.PutUint32(b[56+i*8:], section.Size)
+		le.PutUint32(b[60+i*8:], section.Offset)
+	}
+
+	rehash(b)
+	return b, nil
+}
+
+// typeList writes a type_list, empty lists have offset 0.
+func (c *canonical) typeList(types []uint32) uint32 {
+	if len(types) == 0 {
+		return 0
+	}
+
+	le := binary.LittleEndian
+	content := le.AppendUint32(nil, uint32(len(types)))
+	for _, t := range types {
+		content = le.AppendUint16(content, uint16(t))
+	}
+	return c.share(TYPE_TYPE_LIST, 4, content)
+}
+
+// annotations writes the annotation items, sets, set ref lists and
+// directories of all classes, returning the new directory offset of each
+// class.
+func (c *canonical) annotations() ([]uint32, error) {
+	d := c.d
+	le := binary.LittleEndian
+
+	dirs := make([]*AnnotationsDirectoryItem, len(d.Classes))
+	sets := []uint32{}
+	refLists := []uint32{}
+	for i := range d.Classes {
+		dir, err := d.Classes[i].annotationsDirectory()
+		if err != nil {
+			return nil, err
+		}
+
+		if dir == nil {
+			continue
+		}
+		dirs[i] = dir
+
+		if dir.ClassAnnotationsOffset != 0 {
+			sets = append(sets, dir.ClassAnnotationsOffset)
+		}
+		for _, items := range [][]MemberAnnotation{dir.FieldAnnotations, dir.MethodAnnotations} {
+			for _, item := range items {
+				sets = append(sets, item.AnnotationsOffset)
+			}
+		}
+		for _, item := range dir.ParameterAnnotations {
+			refList, err := d.readUints(item.AnnotationsOffset)
+			if err != nil {
+				return nil, err
+			}
+
+			refLists = append(refLists, item.AnnotationsOffset)
+			for _, set := range refList {
+				if set != 0 {
+					sets = append(sets, set)
+				}
+			}
+		}
+	}
+
+	type annotationItem struct {
+		off     uint32
+		typeIdx uint32
+	}
+
+	items := map[uint32]annotationItem{}
+	for _, set := range sets {
+		offsets, err := d.readUints(set)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, off := range offsets {
+			if _, ok := items[off]; ok {
+				continue
+			}
+
+			if uint64(off)+1 > uint64(len(d.b)) {
+				return nil, fmt.Errorf("Invalid annotation offset %x", off)
+			}
+
+			content, typeIdx, err := c.encodedAnnotation([]byte{d.b[off]}, d.b[off+1:])
+			if err != nil {
+				return nil, err
+			}
+			items[off] = annotationItem{c.share(TYPE_ANNOTATION_ITEM, 1, content), typeIdx}
+		}
+	}
+
+	setOffs := map[uint32]uint32{0: 0}
+	for _, set := range sets {
+		if _, ok := setOffs[set]; ok {
+			continue
+		}
+
+		offsets, _ := d.readUints(set)
+		annotations := make([]annotationItem, len(offsets))
+		for i, off := range offsets {
+			annotations[i] = items[off]
+		}
+		sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].typeIdx < annotations[j].typeIdx })
+
+		content := le.AppendUint32(nil, uint32(len(annotations)))
+		for _, a := range annotations {
+			content = le.AppendUint32(content, a.off)
+		}
+		setOffs[set] = c.share(TYPE_ANNOTATION_SET_ITEM, 4, content)
+	}
+
+	refListOffs := map[uint32]uint32{}
+	for _, refList := range refLists {
+		if _, ok := refListOffs[refList]; ok {
+			continue
+		}
+
+		offsets, _ := d.readUints(refList)
+		content := le.AppendUint32(nil, uint32(len(offsets)))
+		for _, off := range offsets {
+			content = le.AppendUint32(content, setOffs[off])
+		}
+		refListOffs[refList] = c.share(TYPE_ANNOTATION_SET_REF_LIST, 4, content)
+	}
+
+	offs := make([]uint32, len(d.Classes))
+	for i, dir := range dirs {
+		if dir == nil {
+			continue
+		}
+
+		members := func(kind string, items []MemberAnnotation, offsets map[uint32]uint32) ([]byte, error) {
+			mapped := make([][2]uint32, len(items))
+			for j, item := range items {
+				idx, err := c.index(kind, item.Idx)
+				if err != nil {
+					return nil, err
+				}
+				mapped[j] = [2]uint32{idx, offsets[item.AnnotationsOffset]}
+			}
+			sort.SliceStable(mapped, func(a, b int) bool { return mapped[a][0] < mapped[b][0] })
+
+			b := []byte{}
+			for _, item := range mapped {
+				b = le.AppendUint32(b, item[0])
+				b = le.AppendUint32(b, item[1])
+			}
+			return b, nil
+		}
+
+		content := le.AppendUint32(nil, setOffs[dir.ClassAnnotationsOffset])
+		content = le.AppendUint32(content, uint32(len(dir.FieldAnnotations)))
+		content = le.AppendUint32(content, uint32(len(dir.MethodAnnotations)))
+		content = le.AppendUint32(content, uint32(len(dir.ParameterAnnotations)))
+
+		for _, list := range []struct {
+			kind    string
+			items   []MemberAnnotation
+			offsets map[uint32]uint32
+		}{
+			{"field", dir.FieldAnnotations, setOffs},
+			{"meth", dir.MethodAnnotations, setOffs},
+			{"meth", dir.ParameterAnnotations, refListOffs},
+		} {
+			b, err := members(list.kind, list.items, list.offsets)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, b...)
+		}
+		offs[i] = c.share(TYPE_ANNOTATIONS_DIRECTORY_ITEM, 4, content)
+	}
+	return offs, nil
+}
+
+// encodedAnnotation appends the encoded_annotation at the start of data to
+// b with its indices renumbered and its elements sorted by name. It also
+// returns the new type of the annotation.
+func (c *canonical) encodedAnnotation(b []byte, data []byte) ([]byte, uint32, error) {
+	annotation, _, err := c.d.readEncodedAnnotation(data, DEFAULT_MAX_DEPTH)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	typeIdx, err := c.index("type", annotation.TypeIdx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type element struct {
+		name  uint32
+		value EncodedValue
+	}
+
+	elements := make([]element, len(annotation.Values))
+	for i, e := range annotation.Values {
+		if elements[i].name, err = c.index("string", e.NameIdx); err != nil {
+			return nil, 0, err
+		}
+		elements[i].value = e.Value
+	}
+	sort.SliceStable(elements, func(i, j int) bool { return elements[i].name < elements[j].name })
+
+	b = appendUleb128(b, uint64(typeIdx))
+	b = appendUleb128(b, uint64(len(elements)))
+	for _, e := range elements {
+		b = appendUleb128(b, uint64(e.name))
+		if b, err = c.encodedValue(b, e.value); err != nil {
+			return nil, 0, err
+		}
+	}
+	return b, typeIdx, nil
+}
+
+// encodedValue appends ev to b with its indices renumbered.
+func (c *canonical) encodedValue(b []byte, ev EncodedValue) ([]byte, error) {
+	kind := ""
+	switch ev.ValueType {
+	case VALUE_STRING:
+		kind = "string"
+	case VALUE_TYPE:
+		kind = "type"
+	case VALUE_FIELD, VALUE_ENUM:
+		kind = "field"
+	case VALUE_METHOD:
+		kind = "meth"
+	case VALUE_METHOD_TYPE:
+		kind = "proto"
+	case VALUE_METHOD_HANDLE:
+		return nil, fmt.Errorf("Canonicalize does not support method handle values")
+	case VALUE_ARRAY:
+		values, _, err := c.d.readEncodedArray(ev.Data, DEFAULT_MAX_DEPTH)
+		if err != nil {
+			return nil, err
+		}
+		return c.encodedArray(append(b, VALUE_ARRAY), values)
+	case VALUE_ANNOTATION:
+		b, _, err := c.encodedAnnotation(append(b, VALUE_ANNOTATION), ev.Data)
+		return b, err
+	default:
+		return append(append(b, ev.Arg<<5|byte(ev.ValueType)), ev.Data...), nil
+	}
+
+	idx, err := c.index(kind, uint32(zeroExtend(ev.Data)))
+	if err != nil {
+		return nil, err
+	}
+
+	// the index in as few bytes as possible
+	data := binary.LittleEndian.AppendUint32(nil, idx)
+	size := 4
+	for size > 1 && data[size-1] == 0 {
+		size--
+	}
+	return append(append(b, byte(size-1)<<5|byte(ev.ValueType)), data[:size]...), nil
+}
+
+func (c *canonical) encodedArray(b []byte, values []EncodedValue) ([]byte, error) {
+	b = appendUleb128(b, uint64(len(values)))
+	for _, ev := range values {
+		var err error
+		if b, err = c.encodedValue(b, ev); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// codeItems writes the debug info and code items of all methods, returning
+// the new offsets keyed by the old code offset.
+func (c *canonical) codeItems() (map[uint64]uint32, error) {
+	d := c.d
+
+	methods := []*EncodedMethod{}
+	d.EachMethod(func(_ *ClassDefItem, m *EncodedMethod) error {
+		if m.CodeOffset != 0 {
+			methods = append(methods, m)
+		}
+		return nil
+	})
+
+	debugInfos := map[uint32]uint32{0: 0}
+	for _, m := range methods {
+		code, err := m.Code()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := debugInfos[code.DebugInfoOffset]; ok {
+			continue
+		}
+
+		if code.DebugInfoOffset >= uint32(len(d.b)) {
+			return nil, fmt.Errorf("Invalid debug info offset %x", code.DebugInfoOffset)
+		}
+
+		content, err := c.debugInfo(d.b[code.DebugInfoOffset:])
+		if err != nil {
+			return nil, err
+		}
+		debugInfos[code.DebugInfoOffset] = c.item(TYPE_DEBUG_INFO_ITEM, 1)
+		c.b = append(c.b, content...)
+	}
+
+	codes := map[uint64]uint32{}
+	for _, m := range methods {
+		if _, ok := codes[m.CodeOffset]; ok {
+			continue
+		}
+
+		code, err := m.Code()
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := c.codeItem(code, debugInfos[code.DebugInfoOffset])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", m.Method.String(), err)
+		}
+		codes[m.CodeOffset] = c.item(TYPE_CODE_ITEM, 4)
+		c.b = append(c.b, content...)
+	}
+	return codes, nil
+}
+
+// codeItem encodes code with the indices in its instructions and catch
+// handlers renumbered.
+func (c *canonical) codeItem(code *CodeItem, debugInfo uint32) ([]byte, error) {
+	le := binary.LittleEndian
+
+	b := le.AppendUint16(nil, code.RegistersSize)
+	b = le.AppendUint16(b, code.InsSize)
+	b = le.AppendUint16(b, code.OutsSize)
+	b = le.AppendUint16(b, code.TriesSize)
+	b = le.AppendUint32(b, debugInfo)
+	b = le.AppendUint32(b, code.InsnsSize)
+
+	insns := append([]byte{}, code.Insns...)
+	for offset := 0; offset < len(insns); {
+		di, err := c.d.decodeInstruction(insns, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.instruction(insns[offset:offset+di.Length], di); err != nil {
+			return nil, err
+		}
+		offset += di.Length
+	}
+	b = append(b, insns...)
+
+	if len(code.Tries) == 0 {
+		return b, nil
+	}
+
+	if code.InsnsSize%2 != 0 {
+		b = le.AppendUint16(b, 0)
+	}
+
+	offsets := []uint32{}
+	handlers := map[uint32]CatchHandler{}
+	for _, try := range code.Tries {
+		if _, ok := handlers[uint32(try.HandlerOffset)]; !ok {
+			offsets = append(offsets, uint32(try.HandlerOffset))
+		}
+		handlers[uint32(try.HandlerOffset)] = try.Handler
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	list := appendUleb128(nil, uint64(len(offsets)))
+	moved := map[uint32]uint32{}
+	for _, off := range offsets {
+		moved[off] = uint32(len(list))
+
+		handler := handlers[off]
+		size := int64(len(handler.Handlers))
+		if handler.CatchAll != nil {
+			size = -size
+		}
+
+		list = appendSleb128(list, size)
+		for _, pair := range handler.Handlers {
+			typeIdx, err := c.index("type", pair.TypeIdx)
+			if err != nil {
+				return nil, err
+			}
+			list = appendUleb128(list, uint64(typeIdx))
+			list = appendUleb128(list, uint64(pair.Addr))
+		}
+
+		if handler.CatchAll != nil {
+			list = appendUleb128(list, uint64(*handler.CatchAll))
+		}
+	}
+
+	for _, try := range code.Tries {
+		if moved[uint32(try.HandlerOffset)] > 0xffff {
+			return nil, fmt.Errorf("Catch handler offset overflow")
+		}
+
+		b = le.AppendUint32(b, try.StartAddr)
+		b = le.AppendUint16(b, try.InsnCount)
+		b = le.AppendUint16(b, uint16(moved[uint32(try.HandlerOffset)]))
+	}
+	return append(b, list...), nil
+}
+
+// instruction renumbers the pool indices of the instruction insn in place.
+func (c *canonical) instruction(insn []byte, di DecodedInstruction) error {
+	instruction, ok := instructions[di.Opcode]
+	if !ok || di.Format == "" {
+		// payloads
+		return nil
+	}
+
+	le := binary.LittleEndian
+	kinds := indexKinds(instruction)
+	for i, kind := range kinds {
+		// the index follows the first code unit, the proto of 45cc and
+		// 4rcc the registers
+		pos := 2
+		if i == 1 {
+			pos = 6
+		}
+
+		if instruction.Format == "31c" {
+			idx, err := c.index(kind, le.Uint32(insn[pos:]))
+			if err != nil {
+				return err
+			}
+			le.PutUint32(insn[pos:], idx)
+			continue
+		}
+
+		idx, err := c.index(kind, uint32(le.Uint16(insn[pos:])))
+		if err != nil {
+			return err
+		}
+
+		if idx > 0xffff {
+			return fmt.Errorf("Index %s@%d of %s at %x overflows", kind, idx, di.Name, di.Offset)
+		}
+		le.PutUint16(insn[pos:], uint16(idx))
+	}
+	return nil
+}
+
+// debugInfo encodes the debug_info_item at the start of b with its string
+// and type indices renumbered.
+func (c *canonical) debugInfo(b []byte) ([]byte, error) {
+	out := []byte{}
+	offset := uint32(0)
+
+	// copy copies n leb128 values as they are
+	copyLeb := func(n int) error {
+		for i := 0; i < n; i++ {
+			_, length, err := readUleb128(b[offset:])
+			if err != nil {
+				return err
+			}
+			out = append(out, b[offset:offset+length]...)
+			offset += length
+		}
+		return nil
+	}
+
+	// index renumbers a uleb128p1 index, which is NO_INDEX encoded as 0
+	index := func(kind string) error {
+		value, length, err := readUleb128(b[offset:])
+		if err != nil {
+			return err
+		}
+		offset += length
+
+		if value != 0 {
+			if value, err = c.index(kind, value-1); err != nil {
+				return err
+			}
+			value++
+		}
+		out = appendUleb128(out, uint64(value))
+		return nil
+	}
+
+	// line_start
+	if err := copyLeb(1); err != nil {
+		return nil, err
+	}
+
+	parameters, length, err := readUleb128(b[offset:])
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, b[offset:offset+length]...)
+	offset += length
+
+	for i := uint32(0); i < parameters; i++ {
+		if err := index("string"); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if int(offset) >= len(b) {
+			return nil, fmt.Errorf("Unterminated debug info")
+		}
+
+		opcode := b[offset]
+		out = append(out, opcode)
+		offset++
+
+		switch opcode {
+		case 0x00: // DBG_END_SEQUENCE
+			return out, nil
+		case 0x01, 0x02, 0x05, 0x06: // DBG_ADVANCE_PC, DBG_ADVANCE_LINE, DBG_END_LOCAL, DBG_RESTART_LOCAL
+			err = copyLeb(1)
+		case 0x03, 0x04: // DBG_START_LOCAL, DBG_START_LOCAL_EXTENDED
+			if err = copyLeb(1); err == nil {
+				err = index("string")
+			}
+			if err == nil {
+				err = index("type")
+			}
+			if err == nil && opcode == 0x04 {
+				err = index("string")
+			}
+		case 0x09: // DBG_SET_FILE
+			err = index("string")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// classData writes the class_data_item of cls with its members renumbered
+// and sorted.
+func (c *canonical) classData(cls *ClassDefItem, codes map[uint64]uint32) (uint32, error) {
+	if c.classDataOffset(cls) == 0 {
+		return 0, nil
+	}
+
+	data := ClassDataItem{}
+	for _, list := range []struct {
+		from []EncodedField
+		to   *[]EncodedField
+	}{
+		{cls.ClassData.StaticFields, &data.StaticFields},
+		{cls.ClassData.InstanceFields, &data.InstanceFields},
+	} {
+		for _, f := range list.from {
+			idx, err := c.index("field", f.FieldIdx)
+			if err != nil {
+				return 0, err
+			}
+			f.FieldIdx = idx
+			*list.to = append(*list.to, f)
+		}
+	}
+
+	for _, list := range []struct {
+		from []EncodedMethod
+		to   *[]EncodedMethod
+	}{
+		{cls.ClassData.DirectMethods, &data.DirectMethods},
+		{cls.ClassData.VirtualMethods, &data.VirtualMethods},
+	} {
+		for _, m := range list.from {
+			idx, err := c.index("meth", m.MethodIdx)
+			if err != nil {
+				return 0, err
+			}
+			m.MethodIdx = idx
+			m.CodeOffset = uint64(codes[m.CodeOffset])
+			*list.to = append(*list.to, m)
+		}
+	}
+
+	off := c.item(TYPE_CLASS_DATA_ITEM, 1)
+	c.b = append(c.b, data.Pack()...)
+	return off, nil
+}
+
+func (c *canonical) classDataOffset(cls *ClassDefItem) uint32 {
+	return c.rawClassDef(cls, 24)
+}
+
+// rawClassDef reads the uint at offset off of the class_def_item of cls.
+func (c *canonical) rawClassDef(cls *ClassDefItem, off uint32) uint32 {
+	return binary.LittleEndian.Uint32(c.d.b[cls.offset+off:])
+}
+
+// staticValues writes the static values of cls in the new order of its
+// static fields. Fields that now precede a field with a value, but had no
+// value before, get the default value of their type.
+func (c *canonical) staticValues(cls *ClassDefItem) (uint32, error) {
+	if len(cls.StaticValues) == 0 {
+		return 0, nil
+	}
+
+	type static struct {
+		idx   uint32
+		value *EncodedValue
+		typ   string
+	}
+
+	fields := make([]static, len(cls.ClassData.StaticFields))
+	for i, f := range cls.ClassData.StaticFields {
+		idx, err := c.index("field", f.FieldIdx)
+		if err != nil {
+			return 0, err
+		}
+
+		fields[i] = static{idx: idx, typ: f.Field.Type()}
+		if i < len(cls.StaticValues) {
+			fields[i].value = &cls.StaticValues[i]
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].idx < fields[j].idx })
+
+	last := 0
+	for i, f := range fields {
+		if f.value != nil {
+			last = i + 1
+		}
+	}
+
+	b := appendUleb128(nil, uint64(last))
+	for _, f := range fields[:last] {
+		if f.value == nil {
+			b = append(b, defaultValue(f.typ)...)
+			continue
+		}
+
+		var err error
+		if b, err = c.encodedValue(b, *f.value); err != nil {
+			return 0, err
+		}
+	}
+	return c.share(TYPE_ENCODED_ARRAY_ITEM, 1, b), nil
+}
+
+// defaultValue returns the encoded zero value of a field of type
+// descriptor.
+func defaultValue(descriptor string) []byte {
+	switch descriptor {
+	case "Z":
+		return []byte{VALUE_BOOLEAN}
+	case "B":
+		return []byte{VALUE_BYTE, 0}
+	case "S":
+		return []byte{VALUE_SHORT, 0}
+	case "C":
+		return []byte{VALUE_CHAR, 0}
+	case "I":
+		return []byte{VALUE_INT, 0}
+	case "J":
+		return []byte{VALUE_LONG, 0}
+	case "F":
+		return []byte{VALUE_FLOAT, 0}
+	case "D":
+		return []byte{VALUE_DOUBLE, 0}
+	}
+	return []byte{VALUE_NULL}
+}
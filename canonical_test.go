@@ -0,0 +1,136 @@
+package godex
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testUnsortedDEX returns a dex whose pools are in insertion order, with
+// static values, an annotation and a catch handler referring to them.
+func testUnsortedDEX() *testDex {
+	b := &testDex{}
+	c := b.class("Lcom/example/Z;", "Ljava/lang/Object;")
+	c.staticFields = []testField{
+		{idx: b.field("Lcom/example/Z;", "Ljava/lang/String;", "name"), flags: ACC_STATIC},
+		{idx: b.field("Lcom/example/Z;", "I", "count"), flags: ACC_STATIC},
+	}
+	c.staticValues = []byte{0x02, VALUE_STRING, byte(b.str("hello")), VALUE_INT, 7}
+	c.annotations = &testAnnotations{
+		class: []testAnnotation{
+			{visibility: VISIBILITY_RUNTIME, typ: b.typ("Lcom/example/Note;"), elements: []testElement{
+				{name: b.str("value"), value: []byte{VALUE_STRING, byte(b.str("note"))}},
+				{name: b.str("id"), value: []byte{VALUE_INT, 1}},
+			}},
+		},
+	}
+	exception := b.typ("Ljava/lang/Exception;")
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Z;", "run", "V"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x001a, uint16(b.str("abc")), // const-string v0, "abc"
+				0x000e, // return-void
+				0x000d, // move-exception v0
+				0x0027, // throw v0
+			}, tries: []testTry{
+				{start: 0, count: 2, handler: 0},
+			}, handlers: []testHandler{
+				{catches: [][2]uint32{{uint32(exception), 3}}},
+			}},
+		},
+	}
+	return b
+}
+
+func TestCanonicalize(t *testing.T) {
+	dex, err := ParseAt(testUnsortedDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if errs := dex.Verify(); len(errs) == 0 {
+		t.Fatalf("expected the test dex to be unsorted")
+	}
+
+	b, err := dex.Canonicalize()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	canonical, err := ParseAt(b, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if errs := canonical.Verify(); len(errs) != 0 {
+		t.Errorf("Test failed %v %v", errs, []error{})
+	}
+
+	class := canonical.Classes[0]
+	if name := canonical.Types[class.ClassIdx].String(); name != "Lcom/example/Z;" {
+		t.Errorf("Test failed %s %s", name, "Lcom/example/Z;")
+	}
+
+	// static values follow their fields, now count before name
+	want := map[string]interface{}{"count": int64(7), "name": "hello"}
+	for i := range class.ClassData.StaticFields {
+		f := &class.ClassData.StaticFields[i]
+		ev, ok := f.StaticValue()
+		if !ok {
+			t.Fatalf("Test failed %s %v", f.Field.String(), ok)
+		}
+
+		v, err := ev.Decode()
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if v != want[f.Field.String()] {
+			t.Errorf("Test failed %v %v", v, want[f.Field.String()])
+		}
+	}
+
+	annotations, err := class.Annotations()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(annotations) != 1 || annotations[0].Elements["value"] != "note" || annotations[0].Elements["id"] != int64(1) {
+		t.Errorf("Test failed %v", annotations)
+	}
+
+	m := &class.ClassData.VirtualMethods[0]
+	insns, err := m.Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	operand, ok := insns[0].Operands[1].(StringIndexOperand)
+	if !ok {
+		t.Fatalf("Test failed %#v", insns[0].Operands)
+	}
+
+	if s, _ := canonical.StringAt(operand.Index); s != "abc" {
+		t.Errorf("Test failed %s %s", s, "abc")
+	}
+
+	code, err := m.Code()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	handler := code.Tries[0].Handler
+	if len(handler.Handlers) != 1 || canonical.Types[handler.Handlers[0].TypeIdx].String() != "Ljava/lang/Exception;" || handler.Handlers[0].Addr != 3 {
+		t.Errorf("Test failed %#v", handler)
+	}
+
+	again, err := canonical.Canonicalize()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !bytes.Equal(again, b) {
+		t.Errorf("expected canonicalizing twice to give the same bytes")
+	}
+}
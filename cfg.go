@@ -0,0 +1,414 @@
+package godex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BasicBlock is a run of instructions that is only entered at the first
+// and left after the last.
+type BasicBlock struct {
+	// byte offsets of the first instruction and past the last one
+	Start uint32
+	End   uint32
+
+	Instructions []DecodedInstruction
+	// indices of the blocks control may flow to, or come from
+	Successors   []int
+	Predecessors []int
+}
+
+// CFG is the control flow graph of a method, its entry is block 0.
+// Exception handlers are successors of every block of their try.
+type CFG struct {
+	Blocks []BasicBlock
+}
+
+// CFG builds the control flow graph of the method's code, it returns nil
+// for methods without code. Switch and array payloads are data and are
+// not part of any block.
+func (m *EncodedMethod) CFG() (*CFG, error) {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return nil, err
+	}
+
+	insns, err := m.Instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	executable := map[uint32]bool{}
+	for _, di := range insns {
+		executable[di.Offset] = di.Format != ""
+	}
+
+	// successors of each instruction, by byte offset
+	successors := map[uint32][]uint32{}
+	leaders := map[uint32]bool{0: true}
+	for _, di := range insns {
+		if di.Format == "" {
+			continue
+		}
+
+		next := di.Offset + uint32(di.Length)
+		targets, falls, err := flowTargets(code.Insns, di)
+		if err != nil {
+			return nil, err
+		}
+
+		// falling into a payload or off the end has no successor
+		if falls && executable[next] {
+			successors[di.Offset] = append(successors[di.Offset], next)
+		}
+		successors[di.Offset] = append(successors[di.Offset], targets...)
+
+		for _, target := range targets {
+			leaders[target] = true
+		}
+
+		if len(targets) > 0 || !falls {
+			leaders[next] = true
+		}
+	}
+
+	for _, try := range code.Tries {
+		leaders[try.StartAddr*2] = true
+		leaders[(try.StartAddr+uint32(try.InsnCount))*2] = true
+		for _, handler := range tryHandlers(try) {
+			leaders[handler] = true
+		}
+	}
+
+	cfg := &CFG{}
+	blockAt := map[uint32]int{}
+	for _, di := range insns {
+		if di.Format == "" {
+			continue
+		}
+
+		last := len(cfg.Blocks) - 1
+		if leaders[di.Offset] || last == -1 || cfg.Blocks[last].End != di.Offset {
+			blockAt[di.Offset] = len(cfg.Blocks)
+			cfg.Blocks = append(cfg.Blocks, BasicBlock{Start: di.Offset})
+			last++
+		}
+
+		block := &cfg.Blocks[last]
+		block.Instructions = append(block.Instructions, di)
+		block.End = di.Offset + uint32(di.Length)
+	}
+
+	edge := func(from int, to uint32) error {
+		target, ok := blockAt[to]
+		if !ok {
+			return fmt.Errorf("Invalid branch target %x", to)
+		}
+
+		for _, s := range cfg.Blocks[from].Successors {
+			if s == target {
+				return nil
+			}
+		}
+
+		cfg.Blocks[from].Successors = append(cfg.Blocks[from].Successors, target)
+		cfg.Blocks[target].Predecessors = append(cfg.Blocks[target].Predecessors, from)
+		return nil
+	}
+
+	for i := range cfg.Blocks {
+		block := &cfg.Blocks[i]
+		last := block.Instructions[len(block.Instructions)-1]
+		for _, to := range successors[last.Offset] {
+			if err := edge(i, to); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, try := range code.Tries {
+			if block.Start < try.StartAddr*2 || block.Start >= (try.StartAddr+uint32(try.InsnCount))*2 {
+				continue
+			}
+
+			for _, handler := range tryHandlers(try) {
+				if err := edge(i, handler); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// tryHandlers returns the byte offsets of the handlers of the try.
+func tryHandlers(try TryItem) []uint32 {
+	handlers := []uint32{}
+	for _, pair := range try.Handler.Handlers {
+		handlers = append(handlers, pair.Addr*2)
+	}
+
+	if try.Handler.CatchAll != nil {
+		handlers = append(handlers, *try.Handler.CatchAll*2)
+	}
+	return handlers
+}
+
+// flowTargets returns the byte offsets di may branch to, and whether
+// execution may continue with the next instruction.
+func flowTargets(code []byte, di DecodedInstruction) ([]uint32, bool, error) {
+	switch {
+	case strings.HasPrefix(di.Name, "return"), di.Name == "throw":
+		return nil, false, nil
+	case strings.HasPrefix(di.Name, "goto"):
+		target, _ := branchTarget(di)
+		return []uint32{target}, false, nil
+	case strings.HasPrefix(di.Name, "if-"):
+		target, _ := branchTarget(di)
+		return []uint32{target}, true, nil
+	case di.Name == "packed-switch", di.Name == "sparse-switch":
+		targets, err := switchTargets(code, di)
+		return targets, true, err
+	}
+	return nil, true, nil
+}
+
+// switchTargets returns the byte offsets of the cases of a switch.
+func switchTargets(code []byte, di DecodedInstruction) ([]uint32, error) {
+	cases, err := switchCases(code, di)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]uint32, len(cases))
+	for i, c := range cases {
+		targets[i] = c.Target
+	}
+	return targets, nil
+}
+
+// reversePostorder returns the blocks reachable from the entry in reverse
+// postorder.
+func (cfg *CFG) reversePostorder() []int {
+	visited := make([]bool, len(cfg.Blocks))
+	order := []int{}
+
+	var visit func(int)
+	visit = func(b int) {
+		visited[b] = true
+		for _, s := range cfg.Blocks[b].Successors {
+			if !visited[s] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+
+	if len(cfg.Blocks) > 0 {
+		visit(0)
+	}
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// Dominators returns the immediate dominator of every block reachable
+// from the entry, using the iterative algorithm of Cooper, Harvey and
+// Kennedy. The entry block and unreachable blocks are absent.
+func (cfg *CFG) Dominators() map[int]int {
+	order := cfg.reversePostorder()
+
+	rank := make([]int, len(cfg.Blocks))
+	for i, b := range order {
+		rank[b] = i
+	}
+
+	idom := map[int]int{}
+	if len(order) == 0 {
+		return idom
+	}
+	idom[order[0]] = order[0]
+
+	intersect := func(a, b int) int {
+		for a != b {
+			for rank[a] > rank[b] {
+				a = idom[a]
+			}
+			for rank[b] > rank[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range order[1:] {
+			dom := -1
+			for _, p := range cfg.Blocks[b].Predecessors {
+				if _, ok := idom[p]; !ok {
+					continue
+				}
+
+				if dom == -1 {
+					dom = p
+				} else {
+					dom = intersect(p, dom)
+				}
+			}
+
+			if d, ok := idom[b]; !ok || d != dom {
+				idom[b] = dom
+				changed = true
+			}
+		}
+	}
+
+	delete(idom, order[0])
+	return idom
+}
+
+// dominates reports whether block a dominates block b.
+func dominates(idom map[int]int, a, b int) bool {
+	for {
+		if a == b {
+			return true
+		}
+
+		d, ok := idom[b]
+		if !ok {
+			return false
+		}
+		b = d
+	}
+}
+
+// Loop is a natural loop, Header dominates all blocks of Body, which
+// includes the header itself.
+type Loop struct {
+	Header int
+	Body   []int
+}
+
+// NaturalLoops finds the loops formed by back edges, edges to a block
+// that dominates their source. Back edges to the same header form one
+// loop. Loops are ordered by header.
+func (cfg *CFG) NaturalLoops() []Loop {
+	idom := cfg.Dominators()
+
+	bodies := map[int]map[int]bool{}
+	for b := range cfg.Blocks {
+		for _, s := range cfg.Blocks[b].Successors {
+			if !dominates(idom, s, b) {
+				continue
+			}
+
+			// walk back from the latch until the header
+			body := bodies[s]
+			if body == nil {
+				body = map[int]bool{s: true}
+				bodies[s] = body
+			}
+
+			stack := []int{b}
+			for len(stack) > 0 {
+				n := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if body[n] {
+					continue
+				}
+
+				body[n] = true
+				stack = append(stack, cfg.Blocks[n].Predecessors...)
+			}
+		}
+	}
+
+	loops := []Loop{}
+	for header, body := range bodies {
+		loop := Loop{Header: header}
+		for b := range body {
+			loop.Body = append(loop.Body, b)
+		}
+		sort.Ints(loop.Body)
+		loops = append(loops, loop)
+	}
+
+	sort.Slice(loops, func(i, j int) bool { return loops[i].Header < loops[j].Header })
+	return loops
+}
+
+// CyclomaticComplexity returns edges - nodes + 2 of the method's control
+// flow graph, counting only the blocks reachable from the entry. Methods
+// without code have complexity 0.
+func (m *EncodedMethod) CyclomaticComplexity() (int, error) {
+	cfg, err := m.CFG()
+	if err != nil || cfg == nil {
+		return 0, err
+	}
+
+	nodes := cfg.reversePostorder()
+
+	edges := 0
+	for _, b := range nodes {
+		edges += len(cfg.Blocks[b].Successors)
+	}
+	return edges - len(nodes) + 2, nil
+}
+
+// UnreachableInstructions returns the byte offsets of the instructions
+// that cannot be reached from the method entry or from an exception
+// handler, eg. junk injected after a return. Payloads are data and are
+// not reported. Methods without code have none.
+func (m *EncodedMethod) UnreachableInstructions() ([]uint32, error) {
+	cfg, err := m.CFG()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+
+	code, err := m.Code()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := map[uint32]bool{0: true}
+	for _, try := range code.Tries {
+		for _, handler := range tryHandlers(try) {
+			roots[handler] = true
+		}
+	}
+
+	reachable := make([]bool, len(cfg.Blocks))
+	stack := []int{}
+	for i := range cfg.Blocks {
+		if roots[cfg.Blocks[i].Start] {
+			reachable[i] = true
+			stack = append(stack, i)
+		}
+	}
+
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, s := range cfg.Blocks[b].Successors {
+			if !reachable[s] {
+				reachable[s] = true
+				stack = append(stack, s)
+			}
+		}
+	}
+
+	offsets := []uint32{}
+	for i := range cfg.Blocks {
+		if reachable[i] {
+			continue
+		}
+
+		for _, di := range cfg.Blocks[i].Instructions {
+			offsets = append(offsets, di.Offset)
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,164 @@
+package godex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNaturalLoops(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Loop;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Loop;", "count", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x1035, 0x0005, // if-ge v0, v1, +5
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0xfc28, // goto -4
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg, err := dex.Classes[0].ClassData.DirectMethods[0].CFG()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(cfg.Blocks) != 4 {
+		t.Fatalf("Test failed %d %d", len(cfg.Blocks), 4)
+	}
+
+	if want := map[int]int{1: 0, 2: 1, 3: 1}; !reflect.DeepEqual(cfg.Dominators(), want) {
+		t.Errorf("Test failed %v %v", cfg.Dominators(), want)
+	}
+
+	if want := []Loop{{Header: 1, Body: []int{1, 2}}}; !reflect.DeepEqual(cfg.NaturalLoops(), want) {
+		t.Errorf("Test failed %v %v", cfg.NaturalLoops(), want)
+	}
+}
+
+func TestCFGSwitch(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Switch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Switch;", "pick", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x012b, 0x0008, 0x0000, // packed-switch v1, +8
+				0x0012,         // const/4 v0, 0
+				0x000f,         // return v0
+				0x1012,         // const/4 v0, 1
+				0x000f,         // return v0
+				0x0000,         // nop, aligns the payload
+				0x0100, 0x0001, // packed-switch-payload, 1 entry
+				0x0000, 0x0000, // first key
+				0x0005, 0x0000, // target
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg, err := dex.Classes[0].ClassData.DirectMethods[0].CFG()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the nop is unreachable and the payload is not a block
+	if len(cfg.Blocks) != 4 {
+		t.Fatalf("Test failed %d %d", len(cfg.Blocks), 4)
+	}
+
+	if want := []int{1, 2}; !reflect.DeepEqual(cfg.Blocks[0].Successors, want) {
+		t.Errorf("Test failed %v %v", cfg.Blocks[0].Successors, want)
+	}
+
+	if loops := cfg.NaturalLoops(); len(loops) != 0 {
+		t.Errorf("Test failed %v %v", loops, []Loop{})
+	}
+}
+
+func TestCyclomaticComplexity(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Branch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Branch;", "straight", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, insns: []uint16{
+				0x1012, // const/4 v0, 1
+				0x000f, // return v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Branch;", "abs", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x003b, 0x0003, // if-gez v0, +3
+				0x007b, // neg-int v0, v0
+				0x000f, // return v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for i, want := range []int{1, 2} {
+		m := &dex.Classes[0].ClassData.DirectMethods[i]
+		if complexity, err := m.CyclomaticComplexity(); err != nil || complexity != want {
+			t.Errorf("Test failed %s %d %d", m.Method.Name(), complexity, want)
+		}
+	}
+}
+
+func TestUnreachableInstructions(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Junk;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Junk;", "run", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x000e,         // return-void
+				0x1012,         // const/4 v0, 1
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0x000d, // move-exception v0
+				0x000e, // return-void
+			}, tries: []testTry{
+				{start: 0, count: 2, handler: 0},
+			}, handlers: []testHandler{
+				{catchAll: 5, hasCatchAll: true},
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	offsets, err := dex.Classes[0].ClassData.DirectMethods[0].UnreachableInstructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := []uint32{4, 6}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("Test failed %v %v", offsets, want)
+	}
+}
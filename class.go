@@ -0,0 +1,188 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Class is a class definition with its names resolved.
+type Class struct {
+	*ClassDefItem
+	Descriptor string
+	// Superclass is empty for java.lang.Object
+	Superclass string
+}
+
+// ParseClass parses the header and id pools but only the class definition
+// of descriptor, eg. "Lcom/example/Hello;". The other classes are skipped,
+// which makes inspecting one class of a large dex file cheap: the
+// descriptor is found by a binary search of the sorted string pool.
+// Afterwards Classes holds that class only.
+func (dex *DEX) ParseClass(descriptor string) (*Class, error) {
+	if err := dex.readIds(); err != nil {
+		return nil, err
+	}
+
+	typeIdx := -1
+	if stringIdx, ok := dex.searchString(descriptor); ok {
+		for i, t := range dex.Types {
+			if t.DescriptorIdx == uint32(stringIdx) {
+				typeIdx = i
+				break
+			}
+		}
+	}
+
+	if typeIdx == -1 {
+		return nil, fmt.Errorf("Class %s not found", descriptor)
+	}
+
+	header := dex.header
+	if err := dex.checkSection("class defs", header.ClassDefsOffset, header.ClassDefsSize, 32); err != nil {
+		return nil, err
+	}
+
+	for i := uint32(0); i < header.ClassDefsSize; i++ {
+		s := header.ClassDefsOffset + 32*i
+		if binary.LittleEndian.Uint32(dex.b[s:]) != uint32(typeIdx) {
+			continue
+		}
+
+		dex.definedFields = nil
+		class, err := dex.readClass(s, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		dex.Classes = []ClassDefItem{class}
+		return dex.resolveClass(&dex.Classes[0])
+	}
+
+	return nil, fmt.Errorf("Class %s not found", descriptor)
+}
+
+func (dex *DEX) resolveClass(c *ClassDefItem) (*Class, error) {
+	name, err := dex.TypeAt(c.ClassIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	class := &Class{
+		ClassDefItem: c,
+		Descriptor:   name.String(),
+	}
+
+	if c.SuperclassIdx != NO_INDEX {
+		super, err := dex.TypeAt(c.SuperclassIdx)
+		if err != nil {
+			return nil, err
+		}
+		class.Superclass = super.String()
+	}
+	return class, nil
+}
+
+// Method is a method definition with its names resolved. Its
+// instructions are only decoded when Instructions is called.
+type Method struct {
+	*EncodedMethod
+	// Class is the descriptor of the defining class
+	Class string
+	Name  string
+	// Parameters and ReturnType are type descriptors, eg. "I" or
+	// "Ljava/lang/String;"
+	Parameters []string
+	ReturnType string
+	// Virtual is set for methods in the virtual list of the class data,
+	// direct methods are static, private or constructors
+	Virtual bool
+}
+
+// MethodsResolved returns the methods of the class, direct methods
+// first, with their names resolved. The parameters of methods whose
+// prototype cannot be read are left empty.
+func (c *ClassDefItem) MethodsResolved() []Method {
+	methods := []Method{}
+	for j, encoded := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+		for i := range encoded {
+			method := c.dex.resolveMethod(&encoded[i])
+			method.Virtual = j == 1
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// DirectMethodsResolved returns the direct methods of the class, its
+// static, private and constructor methods, with their names resolved. Use
+// MethodsResolved for the virtual methods as well.
+func (c *ClassDefItem) DirectMethodsResolved() []Method {
+	methods := []Method{}
+	for i := range c.ClassData.DirectMethods {
+		methods = append(methods, c.dex.resolveMethod(&c.ClassData.DirectMethods[i]))
+	}
+	return methods
+}
+
+// Field is a field definition with its names resolved.
+type Field struct {
+	*EncodedField
+	// Class is the descriptor of the defining class
+	Class string
+	Name  string
+	// Type is a type descriptor, eg. "I"
+	Type string
+	// Static is set for fields in the static list of the class data
+	Static bool
+}
+
+// DirectFields returns the fields declared by the class, static fields
+// first, with their names resolved. Inherited fields are not included.
+func (c *ClassDefItem) DirectFields() []Field {
+	fields := []Field{}
+	for j, encoded := range [][]EncodedField{c.ClassData.StaticFields, c.ClassData.InstanceFields} {
+		for i := range encoded {
+			f := &encoded[i]
+			fields = append(fields, Field{
+				EncodedField: f,
+				Class:        f.Field.Class(),
+				Name:         f.Field.String(),
+				Type:         f.Field.Type(),
+				Static:       j == 0,
+			})
+		}
+	}
+	return fields
+}
+
+func (dex *DEX) resolveMethod(m *EncodedMethod) Method {
+	method := Method{
+		EncodedMethod: m,
+		Class:         m.Method.Class(),
+		Name:          m.Method.Name(),
+	}
+
+	if int(m.Method.ProtoIdx) >= len(dex.Prototypes) {
+		return method
+	}
+
+	proto := &dex.Prototypes[m.Method.ProtoIdx]
+	if int(proto.ReturnTypeIdx) < len(dex.Types) {
+		method.ReturnType = dex.Types[proto.ReturnTypeIdx].String()
+	}
+
+	params, err := dex.readTypeList(proto.ParametersOffset)
+	if err != nil {
+		return method
+	}
+
+	method.Parameters = []string{}
+	for _, typeIdx := range params {
+		if int(typeIdx) >= len(dex.Types) {
+			method.Parameters = nil
+			break
+		}
+		method.Parameters = append(method.Parameters, dex.Types[typeIdx].String())
+	}
+	return method
+}
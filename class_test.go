@@ -0,0 +1,199 @@
+package godex
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testManyClassesDEX returns a dex with n classes, each with a method. The
+// string pool is sorted, as ParseClass requires.
+func testManyClassesDEX(n int) []byte {
+	t := &testDex{}
+	for i := 0; i < n; i++ {
+		t.typ(fmt.Sprintf("Lcom/example/C%04d;", i))
+	}
+	t.typ("Ljava/lang/Object;")
+	t.str("Test.java")
+	t.proto("V")
+	t.str("run")
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("Lcom/example/C%04d;", i)
+		c := t.class(name, "Ljava/lang/Object;")
+		c.directMethods = []testMethod{
+			{
+				idx:   t.method(name, "run", "V"),
+				flags: ACC_PUBLIC | ACC_STATIC,
+				code:  &testCode{registers: 0, insns: []uint16{0x000e}},
+			},
+		}
+	}
+	return t.build()
+}
+
+func TestParseClass(t *testing.T) {
+	dex := NewDEX(testManyClassesDEX(50))
+
+	class, err := dex.ParseClass("Lcom/example/C0042;")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if dex.stringIndex != nil {
+		t.Errorf("Test failed %d %d", len(dex.stringIndex), 0)
+	}
+
+	if err := dex.VerifyStringOrder(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if want := dex.header.ClassDefsOffset + 42*32; class.offset != want {
+		t.Errorf("Test failed %x %x", class.offset, want)
+	}
+
+	if class.Descriptor != "Lcom/example/C0042;" {
+		t.Errorf("Test failed %s %s", class.Descriptor, "Lcom/example/C0042;")
+	}
+
+	if class.Superclass != "Ljava/lang/Object;" {
+		t.Errorf("Test failed %s %s", class.Superclass, "Ljava/lang/Object;")
+	}
+
+	if len(dex.Classes) != 1 {
+		t.Errorf("Test failed %d %d", len(dex.Classes), 1)
+	}
+
+	if name := class.ClassData.DirectMethods[0].Method.Name(); name != "run" {
+		t.Errorf("Test failed %s %s", name, "run")
+	}
+
+	if count, err := class.ClassData.DirectMethods[0].InstructionCount(); err != nil || count != 1 {
+		t.Errorf("Test failed %d %d", count, 1)
+	}
+
+	if _, err := NewDEX(testManyClassesDEX(2)).ParseClass("Lcom/example/Missing;"); err == nil {
+		t.Errorf("expected error for missing class")
+	}
+}
+
+func TestParseClassInvalidSuperclass(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Orphan;", "").super = 999
+
+	_, err := NewDEX(b.build()).ParseClass("Lcom/example/Orphan;")
+	if _, ok := err.(*IndexError); !ok {
+		t.Errorf("Test failed %v %s", err, "Invalid type index")
+	}
+}
+
+func TestMethodsResolved(t *testing.T) {
+	b := testHelloDEX()
+	c := b.classes[0]
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "greet", "Ljava/lang/String;", "I", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC | ACC_FINAL,
+			code: &testCode{registers: 3, ins: 3, insns: []uint16{
+				0x0211, // return-object v2
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	methods := dex.Classes[0].MethodsResolved()
+	if len(methods) != 2 {
+		t.Fatalf("Test failed %d %d", len(methods), 2)
+	}
+
+	if methods[0].Name != "<init>" || len(methods[0].Parameters) != 0 || methods[0].ReturnType != "V" {
+		t.Errorf("Test failed %s %v %s", methods[0].Name, methods[0].Parameters, methods[0].ReturnType)
+	}
+
+	m := methods[1]
+	if m.Class != "Lcom/example/Hello;" || m.Name != "greet" || m.ReturnType != "Ljava/lang/String;" {
+		t.Errorf("Test failed %s %s %s", m.Class, m.Name, m.ReturnType)
+	}
+
+	if want := []string{"I", "Ljava/lang/String;"}; !reflect.DeepEqual(m.Parameters, want) {
+		t.Errorf("Test failed %v %v", m.Parameters, want)
+	}
+
+	if m.AccessFlags != ACC_PUBLIC|ACC_FINAL {
+		t.Errorf("Test failed %s %s", m.AccessFlags, AccessFlags(ACC_PUBLIC|ACC_FINAL))
+	}
+
+	insns, err := m.Instructions()
+	if err != nil || len(insns) != 1 || insns[0].Name != "return-object" {
+		t.Errorf("Test failed %v %v", insns, err)
+	}
+}
+
+func TestDirectMembers(t *testing.T) {
+	b := testHelloDEX()
+	c := b.classes[0]
+	c.staticFields = []testField{
+		{idx: b.field("Lcom/example/Hello;", "Ljava/lang/String;", "TAG"), flags: ACC_STATIC | ACC_FINAL},
+	}
+	c.instanceFields = []testField{
+		{idx: b.field("Lcom/example/Hello;", "I", "count"), flags: ACC_PRIVATE},
+		{idx: b.field("Lcom/example/Hello;", "J", "total"), flags: ACC_PRIVATE},
+	}
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Hello;", "run", "V"), flags: ACC_PUBLIC | ACC_ABSTRACT},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	class := &dex.Classes[0]
+
+	fields := class.DirectFields()
+	if len(fields) != 3 {
+		t.Fatalf("Test failed %d %d", len(fields), 3)
+	}
+
+	for i, want := range []struct {
+		name   string
+		typ    string
+		static bool
+	}{
+		{"TAG", "Ljava/lang/String;", true},
+		{"count", "I", false},
+		{"total", "J", false},
+	} {
+		f := fields[i]
+		if f.Name != want.name || f.Type != want.typ || f.Static != want.static || f.Class != "Lcom/example/Hello;" {
+			t.Errorf("Test failed %s %s %v %s", f.Name, f.Type, f.Static, f.Class)
+		}
+	}
+
+	methods := class.DirectMethodsResolved()
+	if len(methods) != 1 || methods[0].Name != "<init>" || methods[0].Virtual {
+		t.Errorf("Test failed %v", methods)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	buf := testManyClassesDEX(1000)
+	for i := 0; i < b.N; i++ {
+		if err := NewDEX(buf).Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseClass(b *testing.B) {
+	buf := testManyClassesDEX(1000)
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDEX(buf).ParseClass("Lcom/example/C0500;"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,875 @@
+package godex
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Identifiers of the pseudo-instructions that hold switch and array
+// payloads. They are encoded as a nop with a nonzero high byte.
+const (
+	PACKED_SWITCH_PAYLOAD   = 0x0100
+	SPARSE_SWITCH_PAYLOAD   = 0x0200
+	FILL_ARRAY_DATA_PAYLOAD = 0x0300
+)
+
+type CodeItem struct {
+	RegistersSize   uint16    `pack:"ushort"`
+	InsSize         uint16    `pack:"ushort"`
+	OutsSize        uint16    `pack:"ushort"`
+	TriesSize       uint16    `pack:"ushort"`
+	DebugInfoOffset uint32    `pack:"uint"`
+	InsnsSize       uint32    `pack:"uint"`
+	Insns           []byte    `pack:"-"`
+	Tries           []TryItem `pack:"-"`
+
+	// bytes of the whole code_item, up to the end of the handlers
+	size int `pack:"-"`
+}
+
+// TryItem is a range of code, in code units, covered by exception
+// handlers.
+type TryItem struct {
+	StartAddr     uint32       `pack:"uint"`
+	InsnCount     uint16       `pack:"ushort"`
+	HandlerOffset uint16       `pack:"ushort"`
+	Handler       CatchHandler `pack:"-"`
+}
+
+// CatchHandler lists the typed catch clauses of a try, in order, and the
+// address of its catch-all clause (eg. finally) if it has one.
+type CatchHandler struct {
+	Handlers []TypeAddrPair
+	CatchAll *uint32
+}
+
+type TypeAddrPair struct {
+	TypeIdx uint32
+	Addr    uint32
+}
+
+// Code returns the code item of the method, or nil for abstract and
+// native methods which have no code. Offsets that are not 4 byte aligned
+// or point outside the data section are rejected.
+func (m *EncodedMethod) Code() (*CodeItem, error) {
+	if m.CodeOffset == 0 {
+		return nil, nil
+	}
+
+	offset := m.CodeOffset
+	if offset+16 > uint64(len(m.dex.b)) {
+		return nil, fmt.Errorf("Invalid code offset %x", offset)
+	}
+
+	// code items are 4 byte aligned in the data section
+	header := m.dex.header
+	if offset%4 != 0 {
+		return nil, fmt.Errorf("Misaligned code offset %x", offset)
+	}
+
+	if offset < uint64(header.DataOffset) || offset+16 > uint64(header.DataOffset)+uint64(header.DataSize) {
+		return nil, fmt.Errorf("Code offset %x outside of the data section", offset)
+	}
+
+	code := CodeItem{}
+	if _, err := Unpack(m.dex.b[offset:], &code); err != nil {
+		return nil, err
+	}
+
+	end := offset + 16 + uint64(code.InsnsSize)*2
+	if end > uint64(len(m.dex.b)) {
+		return nil, fmt.Errorf("Invalid code size %d at %x", code.InsnsSize, offset)
+	}
+
+	code.Insns = m.dex.b[offset+16 : end]
+	code.size = int(end - offset)
+
+	if code.TriesSize == 0 {
+		return &code, nil
+	}
+
+	// tries are 4 byte aligned, the handler list follows them
+	tries := (end + 3) &^ 3
+	list := tries + uint64(code.TriesSize)*8
+	if list > uint64(len(m.dex.b)) {
+		return nil, fmt.Errorf("Invalid tries size %d at %x", code.TriesSize, offset)
+	}
+
+	handlers, length, err := readCatchHandlers(m.dex.b[list:])
+	if err != nil {
+		return nil, err
+	}
+	code.size = int(list + uint64(length) - offset)
+
+	code.Tries = make([]TryItem, code.TriesSize)
+	for i := range code.Tries {
+		try := &code.Tries[i]
+		if _, err := Unpack(m.dex.b[tries+uint64(i)*8:], try); err != nil {
+			return nil, err
+		}
+
+		handler, ok := handlers[uint32(try.HandlerOffset)]
+		if !ok {
+			return nil, fmt.Errorf("Invalid handler offset %x at %x", try.HandlerOffset, offset)
+		}
+		try.Handler = handler
+	}
+	return &code, nil
+}
+
+// CodeHex returns the bytes of the method's whole code_item, from its
+// header to the end of the catch handlers, in hex. Methods without code
+// return an empty string.
+func (m *EncodedMethod) CodeHex() (string, error) {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return "", err
+	}
+	return hex.EncodeToString(m.dex.b[m.CodeOffset : m.CodeOffset+uint64(code.size)]), nil
+}
+
+// readCatchHandlers reads the encoded_catch_handler_list at the start of b,
+// returning the handlers by their offset in the list and its length.
+func readCatchHandlers(b []byte) (map[uint32]CatchHandler, int, error) {
+	size, offset, err := readUleb128(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	read := func() (uint32, error) {
+		value, length, err := readUleb128(b[offset:])
+		offset += length
+		return value, err
+	}
+
+	handlers := map[uint32]CatchHandler{}
+	for i := uint32(0); i < size; i++ {
+		start := offset
+
+		// a size of 0 or less is followed by a catch-all clause
+		count, length, err := readSleb128(b[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += length
+
+		// negated in 64 bits, -MinInt32 does not fit
+		catchAll := count <= 0
+		n := int64(count)
+		if n < 0 {
+			n = -n
+		}
+
+		// each pair takes at least two bytes
+		if n*2 > int64(len(b)-int(offset)) {
+			return nil, 0, fmt.Errorf("Invalid catch handler size %d", count)
+		}
+
+		handler := CatchHandler{Handlers: make([]TypeAddrPair, n)}
+		for j := range handler.Handlers {
+			pair := &handler.Handlers[j]
+			if pair.TypeIdx, err = read(); err != nil {
+				return nil, 0, err
+			}
+			if pair.Addr, err = read(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if catchAll {
+			addr, err := read()
+			if err != nil {
+				return nil, 0, err
+			}
+			handler.CatchAll = &addr
+		}
+
+		handlers[start] = handler
+	}
+	return handlers, int(offset), nil
+}
+
+type DecodedInstruction struct {
+	// byte offset of the instruction within the method's code
+	Offset uint32
+	Opcode byte
+	Name   string
+	Format string
+	// length in bytes, including operands
+	Length   int
+	Operands []Operand
+	// Comment is written after the instruction by the disassembler, eg.
+	// by a DisassembleOptions.Rewriter
+	Comment string
+	// Raw holds the bytes of the instruction, opcode and operands. It
+	// refers to the method's code, copy it before modifying.
+	Raw []byte
+}
+
+func (di DecodedInstruction) String() string {
+	operands := make([]string, len(di.Operands))
+	for i, operand := range di.Operands {
+		operands[i] = operand.String()
+	}
+
+	if len(operands) == 0 {
+		return di.Name
+	}
+	return di.Name + " " + strings.Join(operands, ", ")
+}
+
+// Operand is one of the typed operands below.
+type Operand interface {
+	String() string
+}
+
+type RegisterOperand struct {
+	Register uint16
+}
+
+func (o RegisterOperand) String() string {
+	return fmt.Sprintf("v%d", o.Register)
+}
+
+type LiteralOperand struct {
+	Value int64
+}
+
+func (o LiteralOperand) String() string {
+	return fmt.Sprintf("#%d", o.Value)
+}
+
+type StringIndexOperand struct {
+	Index uint32
+}
+
+func (o StringIndexOperand) String() string {
+	return fmt.Sprintf("string@%d", o.Index)
+}
+
+type TypeIndexOperand struct {
+	Index uint32
+}
+
+func (o TypeIndexOperand) String() string {
+	return fmt.Sprintf("type@%d", o.Index)
+}
+
+type MethodIndexOperand struct {
+	Index uint32
+}
+
+func (o MethodIndexOperand) String() string {
+	return fmt.Sprintf("method@%d", o.Index)
+}
+
+type FieldIndexOperand struct {
+	Index uint32
+}
+
+func (o FieldIndexOperand) String() string {
+	return fmt.Sprintf("field@%d", o.Index)
+}
+
+// IndexOperand references the less common pools: proto, call_site and
+// method_handle.
+type IndexOperand struct {
+	Kind  string
+	Index uint32
+}
+
+func (o IndexOperand) String() string {
+	return fmt.Sprintf("%s@%d", o.Kind, o.Index)
+}
+
+// BranchOperand is a branch target relative to the instruction, in 16-bit
+// code units.
+type BranchOperand struct {
+	Offset int32
+}
+
+func (o BranchOperand) String() string {
+	return fmt.Sprintf("%+d", o.Offset)
+}
+
+// DisassembleError reports an invalid opcode at a byte offset within the
+// method's code.
+type DisassembleError struct {
+	Offset int
+	Opcode byte
+}
+
+func (e *DisassembleError) Error() string {
+	return fmt.Sprintf("Invalid opcode %x at %x", e.Opcode, e.Offset)
+}
+
+// OperandDecoder decodes an instruction with an opcode the dex format
+// does not define, eg. of a custom VM. insn starts at the instruction and
+// runs to the end of the code. It returns the instruction with its Name,
+// Length in bytes and Operands set.
+type OperandDecoder func(insn []byte) (DecodedInstruction, error)
+
+// RegisterOpcodeHandler registers fn to decode opcode in the code of this
+// dex. Handlers are only consulted for opcodes the format does not define,
+// which otherwise fail with a DisassembleError.
+func (d *DEX) RegisterOpcodeHandler(opcode byte, fn OperandDecoder) {
+	if d.opcodeHandlers == nil {
+		d.opcodeHandlers = map[byte]OperandDecoder{}
+	}
+	d.opcodeHandlers[opcode] = fn
+}
+
+// opcodeHandler returns the registered handler for the undefined opcode of
+// the instruction at offset.
+func (d *DEX) opcodeHandler(code []byte, offset int) (OperandDecoder, bool) {
+	if offset < 0 || offset >= len(code) {
+		return nil, false
+	}
+
+	if _, ok := instructions[code[offset]]; ok {
+		return nil, false
+	}
+
+	fn, ok := d.opcodeHandlers[code[offset]]
+	return fn, ok
+}
+
+// decodeInstruction is decodeInstruction consulting the registered opcode
+// handlers.
+func (d *DEX) decodeInstruction(code []byte, offset int) (DecodedInstruction, error) {
+	fn, ok := d.opcodeHandler(code, offset)
+	if !ok {
+		return decodeInstruction(code, offset)
+	}
+
+	di, err := fn(code[offset:])
+	if err != nil {
+		return di, err
+	}
+
+	if di.Length <= 0 || di.Length%2 != 0 || offset+di.Length > len(code) {
+		return di, fmt.Errorf("Invalid length %d of opcode %x at %x", di.Length, code[offset], offset)
+	}
+
+	di.Offset = uint32(offset)
+	di.Opcode = code[offset]
+	di.Raw = code[offset : offset+di.Length : offset+di.Length]
+	return di, nil
+}
+
+// instructionLength is InstructionLength consulting the registered opcode
+// handlers.
+func (d *DEX) instructionLength(code []byte, offset int) (int, error) {
+	if _, ok := d.opcodeHandler(code, offset); !ok {
+		return InstructionLength(code, offset)
+	}
+
+	di, err := d.decodeInstruction(code, offset)
+	return di.Length, err
+}
+
+// InstructionLength returns the length in bytes of the instruction at
+// offset in code, including the variable length switch and array data
+// payloads. It lets tools step through bytecode without decoding it.
+func InstructionLength(code []byte, offset int) (int, error) {
+	if offset < 0 || offset+2 > len(code) {
+		return 0, fmt.Errorf("Invalid instruction offset %x", offset)
+	}
+
+	opcode := code[offset]
+	if opcode == 0x00 && code[offset+1] != 0x00 {
+		return payloadLength(code, offset)
+	}
+
+	instruction, ok := instructions[opcode]
+	if !ok {
+		return 0, &DisassembleError{Offset: offset, Opcode: opcode}
+	}
+
+	length := instruction.Size() * 2
+	if offset+length > len(code) {
+		return 0, fmt.Errorf("Truncated instruction %s at %x", instruction.Mnemonic(), offset)
+	}
+	return length, nil
+}
+
+func payloadLength(code []byte, offset int) (int, error) {
+	if offset+8 > len(code) {
+		return 0, fmt.Errorf("Truncated payload at %x", offset)
+	}
+
+	var units uint64
+	switch ident := binary.LittleEndian.Uint16(code[offset:]); ident {
+	case PACKED_SWITCH_PAYLOAD:
+		size := uint64(binary.LittleEndian.Uint16(code[offset+2:]))
+		units = size*2 + 4
+	case SPARSE_SWITCH_PAYLOAD:
+		size := uint64(binary.LittleEndian.Uint16(code[offset+2:]))
+		units = size*4 + 2
+	case FILL_ARRAY_DATA_PAYLOAD:
+		width := uint64(binary.LittleEndian.Uint16(code[offset+2:]))
+		size := uint64(binary.LittleEndian.Uint32(code[offset+4:]))
+		units = (size*width+1)/2 + 4
+	default:
+		return 0, &DisassembleError{Offset: offset, Opcode: code[offset]}
+	}
+
+	if uint64(offset)+units*2 > uint64(len(code)) {
+		return 0, fmt.Errorf("Truncated payload at %x", offset)
+	}
+	return int(units * 2), nil
+}
+
+func payloadName(ident uint16) string {
+	switch ident {
+	case PACKED_SWITCH_PAYLOAD:
+		return "packed-switch-payload"
+	case SPARSE_SWITCH_PAYLOAD:
+		return "sparse-switch-payload"
+	}
+	return "fill-array-data-payload"
+}
+
+func decodeInstruction(code []byte, offset int) (DecodedInstruction, error) {
+	length, err := InstructionLength(code, offset)
+	if err != nil {
+		return DecodedInstruction{}, err
+	}
+
+	di := DecodedInstruction{
+		Offset: uint32(offset),
+		Opcode: code[offset],
+		Length: length,
+		Raw:    code[offset : offset+length : offset+length],
+	}
+
+	if di.Opcode == 0x00 && code[offset+1] != 0x00 {
+		di.Name = payloadName(binary.LittleEndian.Uint16(code[offset:]))
+		return di, nil
+	}
+
+	instruction := instructions[di.Opcode]
+	di.Name = instruction.Mnemonic()
+	di.Format = instruction.Format
+	di.Operands = decodeOperands(instruction, code[offset:offset+length])
+	return di, nil
+}
+
+// indexOperand returns the operand for a pool index, its kind taken from
+// the instruction syntax, eg. string@BBBB.
+func indexOperand(instruction Instruction, nth int, index uint32) Operand {
+	kinds := indexKinds(instruction)
+
+	kind := ""
+	if nth < len(kinds) {
+		kind = kinds[nth]
+	}
+
+	switch kind {
+	case "string":
+		return StringIndexOperand{Index: index}
+	case "type":
+		return TypeIndexOperand{Index: index}
+	case "meth":
+		return MethodIndexOperand{Index: index}
+	case "field":
+		return FieldIndexOperand{Index: index}
+	}
+	return IndexOperand{Kind: kind, Index: index}
+}
+
+// indexKinds returns the kinds of the pool indices in the instruction
+// syntax, eg. meth and proto for meth@BBBB, proto@HHHH.
+func indexKinds(instruction Instruction) []string {
+	kinds := []string{}
+	for _, part := range strings.Split(instruction.Name, " ") {
+		if i := strings.Index(part, "@"); i != -1 {
+			kinds = append(kinds, part[:i])
+		}
+	}
+	return kinds
+}
+
+// decodeOperands decodes the operands of insn according to its format.
+// Invokes list their argument registers before the method index.
+func decodeOperands(instruction Instruction, insn []byte) []Operand {
+	le := binary.LittleEndian
+
+	a := insn[1]
+	unit := func(i int) uint16 {
+		return le.Uint16(insn[2*i:])
+	}
+	reg := func(r uint16) Operand {
+		return RegisterOperand{Register: r}
+	}
+	lit := func(v int64) Operand {
+		return LiteralOperand{Value: v}
+	}
+	branch := func(v int32) Operand {
+		return BranchOperand{Offset: v}
+	}
+
+	switch instruction.Format {
+	case "12x":
+		return []Operand{reg(uint16(a & 0x0f)), reg(uint16(a >> 4))}
+	case "11n":
+		return []Operand{reg(uint16(a & 0x0f)), lit(int64(int8(a) >> 4))}
+	case "11x":
+		return []Operand{reg(uint16(a))}
+	case "10t":
+		return []Operand{branch(int32(int8(a)))}
+	case "20t":
+		return []Operand{branch(int32(int16(unit(1))))}
+	case "22x":
+		return []Operand{reg(uint16(a)), reg(unit(1))}
+	case "21t":
+		return []Operand{reg(uint16(a)), branch(int32(int16(unit(1))))}
+	case "21s":
+		return []Operand{reg(uint16(a)), lit(int64(int16(unit(1))))}
+	case "21h":
+		if instruction.Mnemonic() == "const-wide/high16" {
+			return []Operand{reg(uint16(a)), lit(int64(unit(1)) << 48)}
+		}
+		return []Operand{reg(uint16(a)), lit(int64(int32(uint32(unit(1)) << 16)))}
+	case "21c":
+		return []Operand{reg(uint16(a)), indexOperand(instruction, 0, uint32(unit(1)))}
+	case "23x":
+		return []Operand{reg(uint16(a)), reg(unit(1) & 0xff), reg(unit(1) >> 8)}
+	case "22b":
+		return []Operand{reg(uint16(a)), reg(unit(1) & 0xff), lit(int64(int8(unit(1) >> 8)))}
+	case "22t":
+		return []Operand{reg(uint16(a & 0x0f)), reg(uint16(a >> 4)), branch(int32(int16(unit(1))))}
+	case "22s":
+		return []Operand{reg(uint16(a & 0x0f)), reg(uint16(a >> 4)), lit(int64(int16(unit(1))))}
+	case "22c":
+		return []Operand{reg(uint16(a & 0x0f)), reg(uint16(a >> 4)), indexOperand(instruction, 0, uint32(unit(1)))}
+	case "30t":
+		return []Operand{branch(int32(le.Uint32(insn[2:])))}
+	case "32x":
+		return []Operand{reg(unit(1)), reg(unit(2))}
+	case "31i":
+		return []Operand{reg(uint16(a)), lit(int64(int32(le.Uint32(insn[2:]))))}
+	case "31t":
+		return []Operand{reg(uint16(a)), branch(int32(le.Uint32(insn[2:])))}
+	case "31c":
+		return []Operand{reg(uint16(a)), indexOperand(instruction, 0, le.Uint32(insn[2:]))}
+	case "35c":
+		return append(argumentRegisters(a, unit(2)), indexOperand(instruction, 0, uint32(unit(1))))
+	case "3rc":
+		return append(rangeRegisters(a, unit(2)), indexOperand(instruction, 0, uint32(unit(1))))
+	case "45cc":
+		return append(argumentRegisters(a, unit(2)), indexOperand(instruction, 0, uint32(unit(1))), indexOperand(instruction, 1, uint32(unit(3))))
+	case "4rcc":
+		return append(rangeRegisters(a, unit(2)), indexOperand(instruction, 0, uint32(unit(1))), indexOperand(instruction, 1, uint32(unit(3))))
+	case "51l":
+		return []Operand{reg(uint16(a)), lit(int64(le.Uint64(insn[2:])))}
+	}
+	return nil
+}
+
+// argumentRegisters decodes the A|G byte and the FEDC unit of the 35c
+// format, A is the argument count and the arguments are C, D, E, F, G in
+// order.
+func argumentRegisters(ag byte, fedc uint16) []Operand {
+	count := int(ag >> 4)
+	if count > 5 {
+		count = 5
+	}
+
+	nibbles := []uint16{fedc & 0x0f, fedc >> 4 & 0x0f, fedc >> 8 & 0x0f, fedc >> 12, uint16(ag & 0x0f)}
+
+	registers := make([]Operand, count)
+	for i := range registers {
+		registers[i] = RegisterOperand{Register: nibbles[i]}
+	}
+	return registers
+}
+
+// rangeRegisters decodes the AA count and CCCC first register of the 3rc
+// format, the arguments are vCCCC through vNNNN where N = C + AA - 1.
+func rangeRegisters(count byte, first uint16) []Operand {
+	registers := make([]Operand, count)
+	for i := range registers {
+		registers[i] = RegisterOperand{Register: first + uint16(i)}
+	}
+	return registers
+}
+
+// Instructions decodes the method's code. Methods without code have no
+// instructions.
+func (m *EncodedMethod) Instructions() ([]DecodedInstruction, error) {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return nil, err
+	}
+
+	insns := []DecodedInstruction{}
+	for offset := 0; offset < len(code.Insns); {
+		di, err := m.dex.decodeInstruction(code.Insns, offset)
+		if err != nil {
+			return insns, err
+		}
+
+		insns = append(insns, di)
+		offset += di.Length
+	}
+	return insns, nil
+}
+
+// LabeledInstruction is a decoded instruction with smali style labels.
+type LabeledInstruction struct {
+	DecodedInstruction
+	// Label names this instruction when it is a branch target, eg. ":L0"
+	Label string
+	// Target is the label the instruction branches to
+	Target string
+}
+
+// InstructionsWithLabels decodes the method's code and labels every
+// branch target, switch case, try boundary and catch handler in address
+// order, :L0, :L1, ... the same labels Smali uses. Branch instructions get
+// the label they jump to as Target.
+func (m *EncodedMethod) InstructionsWithLabels() ([]LabeledInstruction, error) {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return nil, err
+	}
+
+	insns, err := m.Instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	labels, _, err := smaliLabels(code, insns)
+	if err != nil {
+		return nil, err
+	}
+
+	labeled := make([]LabeledInstruction, len(insns))
+	for i, di := range insns {
+		labeled[i] = LabeledInstruction{DecodedInstruction: di, Label: labels[di.Offset]}
+		if target, ok := branchTarget(di); ok {
+			labeled[i].Target = labels[target]
+		}
+	}
+	return labeled, nil
+}
+
+type decodedCode struct {
+	insns   []DecodedInstruction
+	offsets map[uint32]int
+}
+
+// InstructionAt returns a copy of the instruction starting at byte offset
+// offset in the method's code. The code is decoded and indexed on first
+// use. It returns false when no instruction starts at offset or the code
+// cannot be decoded.
+func (m *EncodedMethod) InstructionAt(offset uint32) (*DecodedInstruction, bool) {
+	m.dex.cacheMu.Lock()
+	decoded := m.decoded
+	m.dex.cacheMu.Unlock()
+
+	if decoded == nil {
+		insns, err := m.Instructions()
+		if err != nil {
+			return nil, false
+		}
+
+		decoded = &decodedCode{insns: insns, offsets: make(map[uint32]int, len(insns))}
+		for i, di := range insns {
+			decoded.offsets[di.Offset] = i
+		}
+
+		m.dex.cacheMu.Lock()
+		if m.decoded == nil {
+			m.decoded = decoded
+		}
+		decoded = m.decoded
+		m.dex.cacheMu.Unlock()
+	}
+
+	i, ok := decoded.offsets[offset]
+	if !ok {
+		return nil, false
+	}
+
+	di := decoded.insns[i]
+	di.Operands = append([]Operand{}, di.Operands...)
+	return &di, true
+}
+
+// ResultPairs maps the byte offset of each invoke and filled-new-array to
+// the offset of the move-result that stores its result, which must follow
+// it directly. Instructions whose result is dropped, eg. void calls, are
+// left out. It returns nil for methods without code or whose code cannot
+// be decoded.
+func (m *EncodedMethod) ResultPairs() map[int]int {
+	insns, err := m.Instructions()
+	if err != nil || len(insns) == 0 {
+		return nil
+	}
+
+	pairs := map[int]int{}
+	for i := 0; i+1 < len(insns); i++ {
+		di := insns[i]
+		if !strings.HasPrefix(di.Name, "invoke-") && !strings.HasPrefix(di.Name, "filled-new-array") {
+			continue
+		}
+
+		if next := insns[i+1]; strings.HasPrefix(next.Name, "move-result") {
+			pairs[int(di.Offset)] = int(next.Offset)
+		}
+	}
+	return pairs
+}
+
+// branchTarget returns the byte offset the instruction branches to.
+func branchTarget(di DecodedInstruction) (uint32, bool) {
+	for _, operand := range di.Operands {
+		if b, ok := operand.(BranchOperand); ok {
+			return uint32(int64(di.Offset) + int64(b.Offset)*2), true
+		}
+	}
+	return 0, false
+}
+
+// SwitchCase is a case of a packed or sparse switch, Target is the byte
+// offset of the case in the method's code.
+type SwitchCase struct {
+	Key    int32
+	Target uint32
+}
+
+// SwitchCases decodes the cases of the packed-switch or sparse-switch
+// instruction di of the method.
+func (m *EncodedMethod) SwitchCases(di DecodedInstruction) ([]SwitchCase, error) {
+	code, err := m.Code()
+	if err != nil {
+		return nil, err
+	}
+
+	if code == nil {
+		return nil, fmt.Errorf("Method has no code")
+	}
+	return switchCases(code.Insns, di)
+}
+
+// switchCases decodes the payload of switch di. Payloads must be 4-byte
+// aligned, a payload following an odd number of code units is preceded by
+// a nop for padding, which decodes as a regular instruction.
+func switchCases(code []byte, di DecodedInstruction) ([]SwitchCase, error) {
+	ident := uint16(PACKED_SWITCH_PAYLOAD)
+	switch di.Name {
+	case "packed-switch":
+	case "sparse-switch":
+		ident = SPARSE_SWITCH_PAYLOAD
+	default:
+		return nil, fmt.Errorf("Invalid switch instruction %s at %x", di.Name, di.Offset)
+	}
+
+	payload, _ := branchTarget(di)
+	if payload%4 != 0 {
+		return nil, fmt.Errorf("Misaligned switch payload at %x", payload)
+	}
+
+	if _, err := payloadLength(code, int(payload)); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint16(code[payload:]) != ident {
+		return nil, fmt.Errorf("Invalid %s payload at %x", di.Name, payload)
+	}
+
+	size := uint32(binary.LittleEndian.Uint16(code[payload+2:]))
+	cases := make([]SwitchCase, size)
+
+	// packed payloads have a first key, sparse ones all keys before the
+	// targets
+	targets := payload + 8
+	if ident == SPARSE_SWITCH_PAYLOAD {
+		targets = payload + 4 + size*4
+	}
+
+	for i := range cases {
+		if ident == PACKED_SWITCH_PAYLOAD {
+			cases[i].Key = int32(binary.LittleEndian.Uint32(code[payload+4:])) + int32(i)
+		} else {
+			cases[i].Key = int32(binary.LittleEndian.Uint32(code[payload+4+uint32(i)*4:]))
+		}
+
+		relative := int32(binary.LittleEndian.Uint32(code[targets+uint32(i)*4:]))
+		cases[i].Target = uint32(int64(di.Offset) + int64(relative)*2)
+	}
+	return cases, nil
+}
+
+// InstructionCount counts the method's instructions by walking their
+// lengths only, which is cheaper than Instructions.
+func (m *EncodedMethod) InstructionCount() (int, error) {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return 0, err
+	}
+
+	count := 0
+	for offset := 0; offset < len(code.Insns); count++ {
+		length, err := m.dex.instructionLength(code.Insns, offset)
+		if err != nil {
+			return count, err
+		}
+		offset += length
+	}
+	return count, nil
+}
+
+// firstParameterRegister returns the first register holding an incoming
+// parameter, the parameters take the last InsSize registers of the frame.
+func (c *CodeItem) firstParameterRegister() int {
+	return int(c.RegistersSize) - int(c.InsSize)
+}
+
+// smaliRegister formats r the way smali does, the parameter registers as
+// p0, p1, .. and the others as v0, v1, ..
+func (c *CodeItem) smaliRegister(r RegisterOperand) string {
+	if params := c.firstParameterRegister(); int(r.Register) >= params {
+		return fmt.Sprintf("p%d", int(r.Register)-params)
+	}
+	return r.String()
+}
+
+// ParameterRegisterMap maps the registers holding the incoming parameters,
+// the last ins_size registers of the frame, to parameter indices. The
+// implicit this of instance methods maps to -1, and wide (long and double)
+// parameters are listed by their first register only. It returns nil for
+// methods without code or with an invalid prototype.
+func (m *EncodedMethod) ParameterRegisterMap() map[int]int {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return nil
+	}
+
+	shorty, err := m.dex.Shorty(m.Method.ProtoIdx)
+	if err != nil {
+		return nil
+	}
+
+	registers := map[int]int{}
+
+	reg := code.firstParameterRegister()
+	if !m.AccessFlags.Has(ACC_STATIC) {
+		registers[reg] = -1
+		reg++
+	}
+
+	for i, c := range shorty[1:] {
+		registers[reg] = i
+		reg++
+
+		if c == 'J' || c == 'D' {
+			reg++
+		}
+	}
+	return registers
+}
@@ -0,0 +1,618 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestInstructionCount(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Switch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Switch;", "pick", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x012b, 0x0008, 0x0000, // packed-switch v1, +8
+				0x0012,         // const/4 v0, 0
+				0x000f,         // return v0
+				0x1012,         // const/4 v0, 1
+				0x000f,         // return v0
+				0x0000,         // nop, aligns the payload
+				0x0100, 0x0001, // packed-switch-payload, 1 entry
+				0x0000, 0x0000, // first key
+				0x0005, 0x0000, // target
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Switch;", "nothing", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC | ACC_NATIVE,
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+	insns, err := m.Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	count, err := m.InstructionCount()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if count != len(insns) || count != 7 {
+		t.Errorf("Test failed %d %d", count, len(insns))
+	}
+
+	if insns[6].Name != "packed-switch-payload" || insns[6].Offset != 16 {
+		t.Errorf("Test failed %s@%d %s@%d", insns[6].Name, insns[6].Offset, "packed-switch-payload", 16)
+	}
+
+	native := &dex.Classes[0].ClassData.DirectMethods[1]
+	if count, err := native.InstructionCount(); err != nil || count != 0 {
+		t.Errorf("Test failed %d %d", count, 0)
+	}
+}
+
+func TestInstructionOperands(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Hello;", "Ljava/lang/Object;")
+	hello := b.str("hello")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "greeting", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, insns: []uint16{
+				0x001a, uint16(hello), // const-string v0, "hello"
+				0x0011, // return-object v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	insns, err := dex.Classes[0].ClassData.DirectMethods[0].Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(insns[0].Operands) != 2 {
+		t.Fatalf("Test failed %d %d", len(insns[0].Operands), 2)
+	}
+
+	if o, ok := insns[0].Operands[0].(RegisterOperand); !ok || o.Register != 0 {
+		t.Errorf("Test failed %#v %#v", insns[0].Operands[0], RegisterOperand{Register: 0})
+	}
+
+	if o, ok := insns[0].Operands[1].(StringIndexOperand); !ok || o.Index != hello {
+		t.Errorf("Test failed %#v %#v", insns[0].Operands[1], StringIndexOperand{Index: hello})
+	}
+
+	want := fmt.Sprintf("const-string v0, string@%d", hello)
+	if s := insns[0].String(); s != want {
+		t.Errorf("Test failed %s %s", s, want)
+	}
+}
+
+func TestParameterRegisterMap(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Clock;", "Ljava/lang/Object;")
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Clock;", "set", "V", "I", "J", "Z"),
+			flags: ACC_PUBLIC,
+			// this, int, long (two registers) and boolean after two locals
+			code: &testCode{registers: 7, ins: 5, insns: []uint16{0x000e}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.VirtualMethods[0]
+
+	want := map[int]int{2: -1, 3: 0, 4: 1, 6: 2}
+	if registers := m.ParameterRegisterMap(); !reflect.DeepEqual(registers, want) {
+		t.Errorf("Test failed %v %v", registers, want)
+	}
+
+	// a shorty index past the string pool gives an empty shorty
+	dex.Prototypes[m.Method.ProtoIdx].ShortyIdx = uint32(dex.StringCount())
+	if registers := m.ParameterRegisterMap(); registers != nil {
+		t.Errorf("Test failed %v %v", registers, nil)
+	}
+
+	if s, ok := m.SimpleDecompile(); !ok || s != "return;" {
+		t.Errorf("Test failed %s %s", s, "return;")
+	}
+}
+
+func TestInvokeRegisters(t *testing.T) {
+	units := func(v ...uint16) []byte {
+		b := make([]byte, 2*len(v))
+		for i, u := range v {
+			b[2*i], b[2*i+1] = byte(u), byte(u>>8)
+		}
+		return b
+	}
+
+	tests := []struct {
+		insn []byte
+		want string
+	}{
+		{units(0x1071, 0x0007, 0x0003), "invoke-static v3, method@7"},
+		{units(0x2071, 0x0007, 0x0043), "invoke-static v3, v4, method@7"},
+		{units(0x3071, 0x0007, 0x0543), "invoke-static v3, v4, v5, method@7"},
+		{units(0x406e, 0x0007, 0x6543), "invoke-virtual v3, v4, v5, v6, method@7"},
+		{units(0x5871, 0x0007, 0x6543), "invoke-static v3, v4, v5, v6, v8, method@7"},
+		{units(0x0071, 0x0007, 0x0000), "invoke-static method@7"},
+		{units(0x0374, 0x0007, 0x0010), "invoke-virtual/range v16, v17, v18, method@7"},
+	}
+
+	for _, test := range tests {
+		di, err := decodeInstruction(test.insn, 0)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if s := di.String(); s != test.want {
+			t.Errorf("Test failed %s %s", s, test.want)
+		}
+	}
+}
+
+func TestInstructionsWithLabels(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Loop;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Loop;", "count", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x1035, 0x0005, // if-ge v0, v1, +5
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0xfc28, // goto -4
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	insns, err := dex.Classes[0].ClassData.DirectMethods[0].InstructionsWithLabels()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if insns[1].Label != ":L0" || insns[4].Label != ":L1" {
+		t.Errorf("Test failed %s %s", insns[1].Label, insns[4].Label)
+	}
+
+	if insns[3].Name != "goto" || insns[3].Target != insns[1].Label {
+		t.Errorf("Test failed %s %s", insns[3].Target, insns[1].Label)
+	}
+
+	if insns[1].Target != ":L1" || insns[0].Label != "" || insns[0].Target != "" {
+		t.Errorf("Test failed %#v", insns[1])
+	}
+}
+
+func TestInstructionsWithLabelsTry(t *testing.T) {
+	dex, err := ParseAt(testCounterDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	insns, err := dex.Classes[0].ClassData.VirtualMethods[0].InstructionsWithLabels()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// the labels of Counter.smali: try start, try end and handler
+	labels := []string{}
+	for _, di := range insns {
+		labels = append(labels, di.Label)
+	}
+
+	want := []string{":L0", "", "", ":L1", ":L2", ""}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("Test failed %v %v", labels, want)
+	}
+}
+
+func TestCatchHandlers(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Try;", "Ljava/lang/Object;")
+	ioException := b.typ("Ljava/io/IOException;")
+	runtimeException := b.typ("Ljava/lang/RuntimeException;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Try;", "run", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, insns: []uint16{
+				0x0000, // nop
+				0x000e, // return-void
+				0x000d, // move-exception v0
+				0x000e, // return-void
+				0x000d, // move-exception v0
+				0x0027, // throw v0
+			}, tries: []testTry{
+				{start: 0, count: 2, handler: 1},
+			}, handlers: []testHandler{
+				{catches: [][2]uint32{{uint32(ioException), 2}}},
+				{catches: [][2]uint32{{uint32(ioException), 2}, {uint32(runtimeException), 2}}, catchAll: 4, hasCatchAll: true},
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	code, err := dex.Classes[0].ClassData.DirectMethods[0].Code()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(code.Tries) != 1 {
+		t.Fatalf("Test failed %d %d", len(code.Tries), 1)
+	}
+
+	try := code.Tries[0]
+	if try.StartAddr != 0 || try.InsnCount != 2 {
+		t.Errorf("Test failed %d %d", try.StartAddr, try.InsnCount)
+	}
+
+	want := []TypeAddrPair{{uint32(ioException), 2}, {uint32(runtimeException), 2}}
+	if !reflect.DeepEqual(try.Handler.Handlers, want) {
+		t.Errorf("Test failed %v %v", try.Handler.Handlers, want)
+	}
+
+	if try.Handler.CatchAll == nil || *try.Handler.CatchAll != 4 {
+		t.Errorf("Test failed %v %v", try.Handler.CatchAll, 4)
+	}
+
+	// header, 6 code units, one try and a 10 byte handler list
+	if s, err := dex.Classes[0].ClassData.DirectMethods[0].CodeHex(); err != nil || len(s) != 2*(16+12+8+10) {
+		t.Errorf("Test failed %d %d", len(s), 2*(16+12+8+10))
+	}
+
+	if gaps := dex.DataCoverage(); len(gaps) != 0 {
+		t.Errorf("Test failed %v %v", gaps, []Gap{})
+	}
+}
+
+func TestReadCatchHandlersSize(t *testing.T) {
+	// one handler of size -0x80000000, which does not negate in 32 bits
+	b := append([]byte{0x01, 0x80, 0x80, 0x80, 0x80, 0x78}, make([]byte, 16)...)
+	if _, _, err := readCatchHandlers(b); err == nil {
+		t.Errorf("expected an error for handler size %d", math.MinInt32)
+	}
+}
+
+func TestCodeHex(t *testing.T) {
+	b := testHelloDEX()
+	c := b.classes[0]
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Hello;", "nothing", "V"), flags: ACC_PUBLIC | ACC_NATIVE},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	s, err := dex.Classes[0].ClassData.DirectMethods[0].CodeHex()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// 16 byte header and 4 code units
+	want := "0100" + "0100" + "0100" + "0000" + "00000000" + "04000000" + "7010" + fmt.Sprintf("%02x00", b.method("Ljava/lang/Object;", "<init>", "V")) + "0000" + "0e00"
+	if s != want {
+		t.Errorf("Test failed %s %s", s, want)
+	}
+
+	if s, err := dex.Classes[0].ClassData.VirtualMethods[0].CodeHex(); err != nil || s != "" {
+		t.Errorf("Test failed %q %q", s, "")
+	}
+}
+
+func TestCodeAlignment(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := dex.Classes[0].ClassData.DirectMethods[0]
+	if _, err := m.Code(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m.CodeOffset += 2
+	if _, err := m.Code(); err == nil {
+		t.Errorf("expected error for misaligned code offset")
+	}
+
+	m.CodeOffset = 0x70
+	if _, err := m.Code(); err == nil {
+		t.Errorf("expected error for code offset outside of the data section")
+	}
+}
+
+func TestSwitchCasesAlignment(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Switch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Switch;", "pick", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x002c, 0x0006, 0x0000, // sparse-switch v0, +6
+				0x000e,         // return-void
+				0x000e,         // return-void
+				0x0000,         // nop, aligns the payload
+				0x0200, 0x0002, // sparse-switch-payload, 2 entries
+				0xffff, 0xffff, // key -1
+				0x000a, 0x0000, // key 10
+				0x0003, 0x0000, // target +3
+				0x0004, 0x0000, // target +4
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Switch;", "misaligned", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x002c, 0x0005, 0x0000, // sparse-switch v0, +5
+				0x000e,         // return-void
+				0x000e,         // return-void
+				0x0200, 0x0001, // sparse-switch-payload, 1 entry
+				0x0000, 0x0000, // key 0
+				0x0003, 0x0000, // target +3
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+	insns, err := m.Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if insns[3].Name != "nop" || insns[4].Name != "sparse-switch-payload" || insns[4].Offset != 12 {
+		t.Errorf("Test failed %s %s@%d", insns[3].Name, insns[4].Name, insns[4].Offset)
+	}
+
+	cases, err := m.SwitchCases(insns[0])
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []SwitchCase{{Key: -1, Target: 6}, {Key: 10, Target: 8}}
+	if !reflect.DeepEqual(cases, want) {
+		t.Errorf("Test failed %v %v", cases, want)
+	}
+
+	misaligned := &dex.Classes[0].ClassData.DirectMethods[1]
+	insns, err = misaligned.Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if _, err := misaligned.SwitchCases(insns[0]); err == nil {
+		t.Errorf("Test failed %v", err)
+	}
+}
+
+func TestInstructionAt(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Branch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Branch;", "check", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x0038, 0x0003, // if-eqz v0, +3
+				0x000e, // return-void
+				0x1012, // const/4 v0, 1
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.InstructionAt(0)
+		}()
+	}
+	wg.Wait()
+
+	branch, ok := m.InstructionAt(0)
+	if !ok {
+		t.Fatalf("Test failed %v %v", ok, true)
+	}
+
+	target, _ := branchTarget(*branch)
+	di, ok := m.InstructionAt(target)
+	if !ok || di.Name != "const/4" || di.Offset != 6 {
+		t.Errorf("Test failed %v %v", di, "const/4@6")
+	}
+
+	if di, ok := m.InstructionAt(1); ok {
+		t.Errorf("Test failed %v %v", di, nil)
+	}
+
+	// callers get a copy of the cached instruction
+	branch.Name, branch.Operands[0] = "nop", nil
+	if di, _ := m.InstructionAt(0); di.Name != "if-eqz" || di.Operands[0] == nil {
+		t.Errorf("Test failed %v %v", di, "if-eqz")
+	}
+}
+
+func TestInstructionLength(t *testing.T) {
+	units := []uint16{
+		0x0112,                 // const/4 v1, 0
+		0x106e, 0x0000, 0x0000, // invoke-virtual {v0}, meth@0
+		0x0018, 0, 0, 0, 0, // const-wide v0, 0
+		0x0100, 0x0002, 0x0000, 0x0000, 0x0003, 0x0000, 0x0005, 0x0000, // packed-switch-payload
+		0x0200, 0x0001, 0x000a, 0x0000, 0x0003, 0x0000, // sparse-switch-payload
+		0x0300, 0x0002, 0x0003, 0x0000, 0x0001, 0x0002, 0x0003, // fill-array-data-payload
+	}
+
+	code := make([]byte, len(units)*2)
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(code[i*2:], unit)
+	}
+
+	offset := 0
+	for _, want := range []int{2, 6, 10, 16, 12, 14} {
+		length, err := InstructionLength(code, offset)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if length != want {
+			t.Errorf("Test failed %d %d at %x", length, want, offset)
+		}
+		offset += length
+	}
+
+	if offset != len(code) {
+		t.Errorf("Test failed %d %d", offset, len(code))
+	}
+
+	for _, offset := range []int{-2, len(code)} {
+		if _, err := InstructionLength(code, offset); err == nil {
+			t.Errorf("expected error at %d", offset)
+		}
+	}
+
+	// truncated invoke
+	if _, err := InstructionLength(code[:4], 2); err == nil {
+		t.Errorf("expected error for a truncated instruction")
+	}
+}
+
+func TestInstructionSize(t *testing.T) {
+	for opcode, want := range map[byte]int{0x0e: 1, 0x1a: 2, 0x6e: 3, 0x18: 5} {
+		insn := instructions[opcode]
+		if insn.Size() != want {
+			t.Errorf("Test failed %d %d", insn.Size(), want)
+		}
+	}
+}
+
+func TestResultPairs(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Calls;", "Ljava/lang/Object;")
+	length := b.method("Ljava/lang/String;", "length", "I")
+	println := b.method("Ljava/io/PrintStream;", "println", "V", "I")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Calls;", "print", "V", "Ljava/io/PrintStream;", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 2, outs: 2, insns: []uint16{
+				0x106e, uint16(length), 0x0002, // invoke-virtual {v2}, String.length
+				0x000a,                          // move-result v0
+				0x206e, uint16(println), 0x0001, // invoke-virtual {v1, v0}, PrintStream.println
+				0x0024, uint16(b.typ("[I")), 0x0000, // filled-new-array {}, int[]
+				0x000c, // move-result-object v0
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[int]int{0x0: 0x6, 0xe: 0x14}
+	if pairs := dex.Classes[0].ClassData.DirectMethods[0].ResultPairs(); !reflect.DeepEqual(pairs, want) {
+		t.Errorf("Test failed %v %v", pairs, want)
+	}
+}
+
+func TestInstructionRaw(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Switch;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Switch;", "pick", "V", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x002c, 0x0006, 0x0000, // sparse-switch v0, +6
+				0x000e,         // return-void
+				0x000e,         // return-void
+				0x0000,         // nop, aligns the payload
+				0x0200, 0x0001, // sparse-switch-payload, 1 entry
+				0x000a, 0x0000, // key 10
+				0x0003, 0x0000, // target +3
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+	insns, err := m.Instructions()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	code, err := m.Code()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	raw := []byte{}
+	for _, di := range insns {
+		if len(di.Raw) != di.Length {
+			t.Errorf("Test failed %s %d %d", di.Name, len(di.Raw), di.Length)
+		}
+		raw = append(raw, di.Raw...)
+	}
+
+	if !bytes.Equal(raw, code.Insns) {
+		t.Errorf("Test failed %x %x", raw, code.Insns)
+	}
+}
@@ -0,0 +1,531 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Gap is a range of the data section that no parsed item refers to.
+type Gap struct {
+	Offset uint32
+	Size   uint32
+}
+
+type span struct {
+	start, end uint64
+}
+
+// coverage collects the byte ranges of the data section used by items.
+type coverage struct {
+	d     *DEX
+	spans []span
+	// annotation items and sets are shared, each is added once
+	seen map[uint32]bool
+}
+
+func (c *coverage) add(off uint64, length int) {
+	c.spans = append(c.spans, span{off, off + uint64(length)})
+}
+
+// TrailingData returns the bytes after the file size declared in the
+// header, eg. an overlay appended to the dex. For a dex parsed with
+// ParseAt this is everything following it in the buffer.
+func (d *DEX) TrailingData() []byte {
+	return d.b[d.end():]
+}
+
+// DataSection returns the data section declared by the header, where the
+// strings, code, class data and annotations are stored, or nil when it
+// does not fit in the file.
+func (d *DEX) DataSection() []byte {
+	start := uint64(d.header.DataOffset)
+	end := start + uint64(d.header.DataSize)
+	if end > uint64(d.end()) {
+		return nil
+	}
+	return d.b[start:end]
+}
+
+// DataEntropy returns the Shannon entropy of the data section in bits per
+// byte, from 0 to 8. Compressed or encrypted payloads come close to 8,
+// regular dex data stays well below.
+func (d *DEX) DataEntropy() float64 {
+	return entropy(d.DataSection())
+}
+
+// DataEntropyWindows returns the entropy of each consecutive window of
+// size bytes of the data section, the last one possibly shorter, to
+// locate high entropy regions. Window i starts at DataOffset + i*size.
+func (d *DEX) DataEntropyWindows(size int) []float64 {
+	if size <= 0 {
+		return nil
+	}
+
+	data := d.DataSection()
+
+	windows := []float64{}
+	for start := 0; start < len(data); start += size {
+		end := start + size
+		if end > len(data) {
+			end = len(data)
+		}
+		windows = append(windows, entropy(data[start:end]))
+	}
+	return windows
+}
+
+func entropy(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+
+	h := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(b))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// AfterDataSection returns the bytes between the end of the data section
+// and the declared end of the file, the link data if there is any, or a
+// payload hidden within the file.
+func (d *DEX) AfterDataSection() []byte {
+	start := uint64(d.header.DataOffset) + uint64(d.header.DataSize)
+	if start > uint64(d.end()) {
+		return nil
+	}
+	return d.b[start:d.end()]
+}
+
+// LinkData is the link section of a statically linked dex. Its format is
+// left to the implementation, so only the raw bytes are available.
+type LinkData struct {
+	Offset uint32
+	Size   uint32
+	Raw    []byte
+}
+
+// ParseLinkData returns the link section declared by the header, or nil
+// when the dex has none.
+func (d *DEX) ParseLinkData() (*LinkData, error) {
+	h := d.header
+	if h.LinkSize == 0 {
+		return nil, nil
+	}
+
+	if uint64(h.LinkOff)+uint64(h.LinkSize) > uint64(d.end()) {
+		return nil, fmt.Errorf("Invalid link section %x size %d", h.LinkOff, h.LinkSize)
+	}
+	return &LinkData{Offset: h.LinkOff, Size: h.LinkSize, Raw: d.b[h.LinkOff : h.LinkOff+h.LinkSize]}, nil
+}
+
+// DataCoverage walks every item reachable from the header and returns the
+// ranges of the data section none of them cover. Bytes hidden between
+// items are a common place for packers to store payloads. Zero padding
+// that only aligns the next item is not reported. An item that cannot be
+// parsed covers nothing, so its bytes are reported as well.
+func (d *DEX) DataCoverage() []Gap {
+	c := &coverage{d: d, seen: map[uint32]bool{}}
+
+	c.mapList()
+
+	for i := uint32(0); i < d.header.StringIdsSize; i++ {
+		c.stringData(i)
+	}
+
+	for _, p := range d.Prototypes {
+		c.typeList(p.ParametersOffset)
+	}
+
+	for i := range d.Classes {
+		c.class(&d.Classes[i])
+	}
+
+	d.EachMethod(func(class *ClassDefItem, m *EncodedMethod) error {
+		c.code(m.CodeOffset)
+		return nil
+	})
+
+	start := uint64(d.header.DataOffset)
+	return c.gaps(start, start+uint64(d.header.DataSize))
+}
+
+func (c *coverage) gaps(start, end uint64) []Gap {
+	sort.Slice(c.spans, func(i, j int) bool { return c.spans[i].start < c.spans[j].start })
+
+	gaps := []Gap{}
+	pos := start
+	for _, s := range append(c.spans, span{end, end}) {
+		if s.start > end {
+			s.start = end
+		}
+
+		if s.start > pos && !c.padding(pos, s.start) {
+			gaps = append(gaps, Gap{Offset: uint32(pos), Size: uint32(s.start - pos)})
+		}
+
+		if s.end > pos {
+			pos = s.end
+		}
+	}
+	return gaps
+}
+
+// padding reports whether start to end are zero bytes aligning the next
+// item to 4 bytes.
+func (c *coverage) padding(start, end uint64) bool {
+	if end-start >= 4 || end%4 != 0 || end > uint64(len(c.d.b)) {
+		return false
+	}
+
+	for _, b := range c.d.b[start:end] {
+		if b != 0x00 {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *coverage) mapList() {
+	if c.d.header.MapOff != 0 {
+		c.add(uint64(c.d.header.MapOff), 4+12*len(c.d.Map))
+	}
+}
+
+// stringData adds the string_data_item of string id i.
+func (c *coverage) stringData(i uint32) error {
+	off := uint64(binary.LittleEndian.Uint32(c.d.b[uint64(c.d.header.StringIdsOffset)+uint64(i)*4:]))
+	if off >= uint64(len(c.d.b)) {
+		return fmt.Errorf("Invalid string data offset %x", off)
+	}
+
+	_, length, err := readUleb128(c.d.b[off:])
+	if err != nil {
+		return err
+	}
+
+	// the size counts utf-16 code units, scan for the terminator
+	end := bytes.IndexByte(c.d.b[off+uint64(length):], 0x00)
+	if end == -1 {
+		return fmt.Errorf("Unterminated string data at %x", off)
+	}
+	c.add(off, int(length)+end+1)
+	return nil
+}
+
+func (c *coverage) typeList(off uint32) error {
+	types, err := c.d.readTypeList(off)
+	if err != nil || off == 0 {
+		return err
+	}
+
+	c.add(uint64(off), 4+2*len(types))
+	return nil
+}
+
+func (c *coverage) class(class *ClassDefItem) error {
+	def := c.d.b[class.offset:]
+
+	if err := c.typeList(class.InterfacesOffset); err != nil {
+		return err
+	}
+
+	if off := binary.LittleEndian.Uint32(def[24:]); off != 0 {
+		length, err := c.d.classDataLength(off)
+		if err != nil {
+			return err
+		}
+		c.add(uint64(off), length)
+	}
+
+	if off := binary.LittleEndian.Uint32(def[28:]); off != 0 {
+		if uint64(off) >= uint64(len(c.d.b)) {
+			return fmt.Errorf("Invalid static values offset %x", off)
+		}
+
+		_, length, err := c.d.readEncodedArray(c.d.b[off:], DEFAULT_MAX_DEPTH)
+		if err != nil {
+			return err
+		}
+		c.add(uint64(off), length)
+	}
+
+	return c.annotations(class)
+}
+
+// classDataLength returns the size of the class_data_item at off.
+func (d *DEX) classDataLength(off uint32) (int, error) {
+	if uint64(off) >= uint64(len(d.b)) {
+		return 0, fmt.Errorf("Invalid class data offset %x", off)
+	}
+
+	b := d.b[off:]
+	offset := uint32(0)
+
+	read := func() (uint32, error) {
+		value, length, err := readUleb128(b[offset:])
+		offset += length
+		return value, err
+	}
+
+	sizes := make([]uint32, 4)
+	for i := range sizes {
+		size, err := read()
+		if err != nil {
+			return 0, err
+		}
+		sizes[i] = size
+	}
+
+	// fields have an index and flags, methods also a code offset
+	count := uint64(sizes[0]+sizes[1])*2 + uint64(sizes[2]+sizes[3])*3
+	for i := uint64(0); i < count; i++ {
+		if _, err := read(); err != nil {
+			return 0, err
+		}
+	}
+	return int(offset), nil
+}
+
+func (c *coverage) annotations(class *ClassDefItem) error {
+	dir, err := class.annotationsDirectory()
+	if err != nil || dir == nil {
+		return err
+	}
+
+	count := len(dir.FieldAnnotations) + len(dir.MethodAnnotations) + len(dir.ParameterAnnotations)
+	c.add(uint64(class.AnnotationsOffset), 16+8*count)
+
+	if err := c.annotationSet(dir.ClassAnnotationsOffset); err != nil {
+		return err
+	}
+
+	for _, members := range [][]MemberAnnotation{dir.FieldAnnotations, dir.MethodAnnotations} {
+		for _, member := range members {
+			if err := c.annotationSet(member.AnnotationsOffset); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, member := range dir.ParameterAnnotations {
+		if c.seen[member.AnnotationsOffset] {
+			continue
+		}
+		c.seen[member.AnnotationsOffset] = true
+
+		sets, err := c.d.readUints(member.AnnotationsOffset)
+		if err != nil {
+			return err
+		}
+		c.add(uint64(member.AnnotationsOffset), 4+4*len(sets))
+
+		for _, set := range sets {
+			if err := c.annotationSet(set); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *coverage) annotationSet(off uint32) error {
+	if off == 0 || c.seen[off] {
+		return nil
+	}
+	c.seen[off] = true
+
+	items, err := c.d.readUints(off)
+	if err != nil {
+		return err
+	}
+	c.add(uint64(off), 4+4*len(items))
+
+	for _, item := range items {
+		if c.seen[item] {
+			continue
+		}
+		c.seen[item] = true
+
+		if uint64(item)+1 > uint64(len(c.d.b)) {
+			return fmt.Errorf("Invalid annotation offset %x", item)
+		}
+
+		_, length, err := c.d.readEncodedAnnotation(c.d.b[item+1:], DEFAULT_MAX_DEPTH)
+		if err != nil {
+			return err
+		}
+		c.add(uint64(item), 1+length)
+	}
+	return nil
+}
+
+// code adds the code_item at off together with its tries, handlers and
+// debug info.
+func (c *coverage) code(off uint64) error {
+	if off == 0 || c.seen[uint32(off)] {
+		return nil
+	}
+	c.seen[uint32(off)] = true
+
+	code, length, err := c.d.codeItemLength(off)
+	if err != nil {
+		return err
+	}
+	c.add(off, length)
+
+	if code.DebugInfoOffset != 0 && !c.seen[code.DebugInfoOffset] {
+		c.seen[code.DebugInfoOffset] = true
+
+		if uint64(code.DebugInfoOffset) >= uint64(len(c.d.b)) {
+			return fmt.Errorf("Invalid debug info offset %x", code.DebugInfoOffset)
+		}
+
+		length, err := debugInfoLength(c.d.b[code.DebugInfoOffset:])
+		if err != nil {
+			return err
+		}
+		c.add(uint64(code.DebugInfoOffset), length)
+	}
+	return nil
+}
+
+// codeItemLength unpacks the code_item at off and returns its size,
+// including its tries and handlers.
+func (d *DEX) codeItemLength(off uint64) (*CodeItem, int, error) {
+	if off+16 > uint64(len(d.b)) {
+		return nil, 0, fmt.Errorf("Invalid code offset %x", off)
+	}
+
+	code := CodeItem{}
+	if _, err := Unpack(d.b[off:], &code); err != nil {
+		return nil, 0, err
+	}
+
+	end := off + 16 + uint64(code.InsnsSize)*2
+	if code.TriesSize > 0 {
+		// tries are 4 byte aligned
+		end = (end+3)&^3 + uint64(code.TriesSize)*8
+		if end > uint64(len(d.b)) {
+			return nil, 0, fmt.Errorf("Invalid tries size %d at %x", code.TriesSize, off)
+		}
+
+		_, length, err := readCatchHandlers(d.b[end:])
+		if err != nil {
+			return nil, 0, err
+		}
+		end += uint64(length)
+	}
+	return &code, int(end - off), nil
+}
+
+// MethodPair is a pair of related methods.
+type MethodPair struct {
+	First  MethodRef
+	Second MethodRef
+}
+
+// OverlappingCode returns the pairs of methods whose code items overlap,
+// including methods sharing one code item. First is the method whose code
+// starts first. Compilers give every method its own code, overlaps are an
+// anti-disassembly trick. Methods whose code cannot be read are skipped.
+func (d *DEX) OverlappingCode() []MethodPair {
+	type method struct {
+		ref MethodRef
+		span
+	}
+
+	methods := []method{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		if m.CodeOffset == 0 {
+			return nil
+		}
+
+		if _, length, err := d.codeItemLength(m.CodeOffset); err == nil {
+			methods = append(methods, method{MethodRef{Class: c, Method: m}, span{m.CodeOffset, m.CodeOffset + uint64(length)}})
+		}
+		return nil
+	})
+
+	// a stable sort keeps methods sharing code in definition order
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].start < methods[j].start })
+
+	pairs := []MethodPair{}
+	for i := range methods {
+		for j := i + 1; j < len(methods) && methods[j].start < methods[i].end; j++ {
+			pairs = append(pairs, MethodPair{First: methods[i].ref, Second: methods[j].ref})
+		}
+	}
+	return pairs
+}
+
+// debugInfoLength returns the size of the debug_info_item at the start of
+// b, up to and including DBG_END_SEQUENCE.
+func debugInfoLength(b []byte) (int, error) {
+	offset := uint32(0)
+	skip := func(n int) error {
+		for i := 0; i < n; i++ {
+			_, length, err := readUleb128(b[offset:])
+			if err != nil {
+				return err
+			}
+			offset += length
+		}
+		return nil
+	}
+
+	// line_start
+	if err := skip(1); err != nil {
+		return 0, err
+	}
+
+	parameters, length, err := readUleb128(b[offset:])
+	if err != nil {
+		return 0, err
+	}
+	offset += length
+
+	if err := skip(int(parameters)); err != nil {
+		return 0, err
+	}
+
+	// number of leb128 operands of each opcode, the others have none
+	operands := map[byte]int{
+		0x01: 1, // DBG_ADVANCE_PC
+		0x02: 1, // DBG_ADVANCE_LINE
+		0x03: 3, // DBG_START_LOCAL
+		0x04: 4, // DBG_START_LOCAL_EXTENDED
+		0x05: 1, // DBG_END_LOCAL
+		0x06: 1, // DBG_RESTART_LOCAL
+		0x09: 1, // DBG_SET_FILE
+	}
+
+	for {
+		if int(offset) >= len(b) {
+			return 0, fmt.Errorf("Unterminated debug info")
+		}
+
+		opcode := b[offset]
+		offset++
+
+		if opcode == 0x00 {
+			return int(offset), nil
+		}
+
+		if err := skip(operands[opcode]); err != nil {
+			return 0, err
+		}
+	}
+}
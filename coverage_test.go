@@ -0,0 +1,205 @@
+package godex
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func testCoverageDEX() *testDex {
+	t := testHelloDEX()
+	c := t.classes[0]
+	c.annotations = &testAnnotations{
+		class: []testAnnotation{
+			{visibility: VISIBILITY_RUNTIME, typ: t.typ("Lcom/example/Exported;")},
+		},
+	}
+	return t
+}
+
+func TestDataCoverage(t *testing.T) {
+	dex, err := ParseAt(testCoverageDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if gaps := dex.DataCoverage(); len(gaps) != 0 {
+		t.Errorf("Test failed %v %v", gaps, []Gap{})
+	}
+}
+
+func TestDataCoverageHidden(t *testing.T) {
+	hidden := []byte("PAYLOAD!")
+
+	b := testCoverageDEX()
+	b.hidden = hidden
+
+	buf := b.build()
+	dex, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	gaps := dex.DataCoverage()
+	expected := []Gap{{Offset: uint32(bytes.Index(buf, hidden)), Size: uint32(len(hidden))}}
+	if !reflect.DeepEqual(gaps, expected) {
+		t.Errorf("Test failed %v %v", gaps, expected)
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	link := []byte("LINKDATA")
+	overlay := []byte("0123456789abcdef")
+
+	b := testCoverageDEX()
+	b.link = link
+
+	buf := append(b.build(), overlay...)
+	dex, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if got := dex.TrailingData(); !bytes.Equal(got, overlay) {
+		t.Errorf("Test failed %q %q", got, overlay)
+	}
+
+	if got := dex.AfterDataSection(); !bytes.Equal(got, link) {
+		t.Errorf("Test failed %q %q", got, link)
+	}
+
+	dex, err = ParseAt(testCoverageDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if got := dex.TrailingData(); len(got) != 0 {
+		t.Errorf("Test failed %q %q", got, "")
+	}
+}
+
+func TestDataSection(t *testing.T) {
+	dex, err := ParseAt(testCoverageDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	data := dex.DataSection()
+	if len(data) != int(dex.header.DataSize) || len(data) == 0 {
+		t.Fatalf("Test failed %d %d", len(data), dex.header.DataSize)
+	}
+
+	// the data section runs to the end of the file
+	if !bytes.HasSuffix(dex.Bytes(), data) {
+		t.Errorf("Test failed %x", data)
+	}
+
+	dex.header.DataSize = dex.header.FileSize
+	if data := dex.DataSection(); data != nil {
+		t.Errorf("Test failed %d", len(data))
+	}
+}
+
+func TestDataEntropy(t *testing.T) {
+	dex, err := ParseAt(testCoverageDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	normal := dex.DataEntropy()
+
+	blob := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(blob)
+
+	b := testCoverageDEX()
+	b.hidden = blob
+
+	packed, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if normal <= 0 || normal >= 6 || packed.DataEntropy() <= normal {
+		t.Errorf("Test failed %f %f", normal, packed.DataEntropy())
+	}
+
+	// the blob spans several windows, each close to 8 bits per byte
+	high := 0
+	for _, h := range packed.DataEntropyWindows(512) {
+		if h > 7 {
+			high++
+		}
+	}
+
+	if high < 6 {
+		t.Errorf("Test failed %v", packed.DataEntropyWindows(512))
+	}
+
+	if windows := packed.DataEntropyWindows(0); windows != nil {
+		t.Errorf("Test failed %v", windows)
+	}
+}
+
+func TestOverlappingCode(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Shared;", "Ljava/lang/Object;")
+	for _, name := range []string{"a", "b", "c"} {
+		c.directMethods = append(c.directMethods, testMethod{
+			idx:   b.method("Lcom/example/Shared;", name, "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code:  &testCode{registers: 1, insns: []uint16{0x0000, 0x0000, 0x000e}},
+		})
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if pairs := dex.OverlappingCode(); len(pairs) != 0 {
+		t.Errorf("Test failed %v %v", pairs, []MethodPair{})
+	}
+
+	// b shares the code of a
+	methods := dex.Classes[0].ClassData.DirectMethods
+	methods[1].CodeOffset = methods[0].CodeOffset
+
+	pairs := dex.OverlappingCode()
+	if len(pairs) != 1 || pairs[0].First.Method.Method.Name() != "a" || pairs[0].Second.Method.Method.Name() != "b" {
+		t.Errorf("Test failed %v", pairs)
+	}
+
+	// c starts within the instructions of a and b
+	methods[2].CodeOffset = methods[0].CodeOffset + 16
+	if pairs := dex.OverlappingCode(); len(pairs) != 3 {
+		t.Errorf("Test failed %d %d", len(pairs), 3)
+	}
+}
+
+func TestParseLinkData(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if link, err := dex.ParseLinkData(); link != nil || err != nil {
+		t.Errorf("Test failed %v %v", link, err)
+	}
+
+	b := testHelloDEX()
+	b.link = []byte("linked")
+
+	dex, err = ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	link, err := dex.ParseLinkData()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if link.Size != 6 || string(link.Raw) != "linked" {
+		t.Errorf("Test failed %v %s", link, "linked")
+	}
+}
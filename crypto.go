@@ -0,0 +1,179 @@
+package godex
+
+import (
+	"strings"
+)
+
+// CryptoPackages are the class descriptor prefixes whose calls are
+// reported by CryptoUsage.
+var CryptoPackages = []string{
+	"Ljavax/crypto/",
+	"Ljava/security/",
+}
+
+// keyMaterialAPIs turn a string literal into key material, eg.
+// "secret".getBytes().
+var keyMaterialAPIs = []string{
+	"Ljava/lang/String;->getBytes",
+	"Ljava/lang/String;->toCharArray",
+	"Landroid/util/Base64;->decode",
+	"Ljava/util/Base64$Decoder;->decode",
+}
+
+// CryptoUse is a call to a crypto API, eg. Cipher.getInstance, with the
+// string literals found in its arguments.
+type CryptoUse struct {
+	Method MethodRef
+	API    *MethodIdItem
+	// byte offset of the invoke
+	Offset uint32
+	// Algorithm is a string literal passed as is, eg. the transformation
+	// "AES/CBC/PKCS5Padding" of Cipher.getInstance.
+	Algorithm string
+	// Key is a string literal passed as bytes or chars, eg. the key of a
+	// SecretKeySpec or the iv of an IvParameterSpec.
+	Key string
+}
+
+// literal is the string a register holds, derived is set if it was
+// converted to key material.
+type literal struct {
+	value   string
+	derived bool
+}
+
+// CryptoUsage returns the calls to classes in CryptoPackages, eg. Cipher,
+// MessageDigest and SecretKeySpec. Literals are tracked within basic
+// blocks, so algorithm names and hardcoded keys are only recovered when
+// set up next to the call, which is how they are usually written.
+func (d *DEX) CryptoUsage() []CryptoUse {
+	uses := []CryptoUse{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		cfg, err := m.CFG()
+		if err != nil || cfg == nil {
+			return nil
+		}
+
+		ref := MethodRef{Class: c, Method: m}
+		for _, block := range cfg.Blocks {
+			literals := map[uint16]literal{}
+			var result *literal
+			for _, di := range block.Instructions {
+				registers := []uint16{}
+				for _, operand := range di.Operands {
+					if r, ok := operand.(RegisterOperand); ok {
+						registers = append(registers, r.Register)
+					}
+				}
+
+				pending := result
+				result = nil
+
+				switch {
+				case strings.HasPrefix(di.Name, "const-string"):
+					for _, operand := range di.Operands {
+						if o, ok := operand.(StringIndexOperand); ok {
+							if s, err := d.StringAt(o.Index); err == nil {
+								literals[registers[0]] = literal{value: s}
+							}
+						}
+					}
+				case di.Name == "move-object" || di.Name == "move-object/from16" || di.Name == "move-object/16":
+					if l, ok := literals[registers[1]]; ok {
+						literals[registers[0]] = l
+					} else {
+						delete(literals, registers[0])
+					}
+				case strings.HasPrefix(di.Name, "move-result"):
+					if pending != nil {
+						literals[registers[0]] = *pending
+					} else {
+						delete(literals, registers[0])
+					}
+				case strings.HasPrefix(di.Name, "invoke-"):
+					var method *MethodIdItem
+					for _, operand := range di.Operands {
+						if o, ok := operand.(MethodIndexOperand); ok && int(o.Index) < len(d.Methods) {
+							method = &d.Methods[o.Index]
+						}
+					}
+
+					if method == nil {
+						continue
+					}
+
+					if matchesAPI(method, keyMaterialAPIs) {
+						for _, r := range registers {
+							if l, ok := literals[r]; ok {
+								result = &literal{value: l.value, derived: true}
+								break
+							}
+						}
+						continue
+					}
+
+					if !isCryptoClass(method.Class()) {
+						continue
+					}
+
+					use := CryptoUse{Method: ref, API: method, Offset: di.Offset}
+					for _, arg := range d.invokeArguments(method, !strings.HasPrefix(di.Name, "invoke-static"), registers) {
+						l, ok := literals[arg]
+						switch {
+						case !ok:
+						case !l.derived && use.Algorithm == "":
+							use.Algorithm = l.value
+						case l.derived && use.Key == "":
+							use.Key = l.value
+						}
+					}
+					uses = append(uses, use)
+				case !writesFirstRegister(di) || len(registers) == 0:
+				default:
+					delete(literals, registers[0])
+					if strings.HasPrefix(di.Name, "move-wide") || strings.HasPrefix(di.Name, "const-wide") {
+						delete(literals, registers[0]+1)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return uses
+}
+
+func isCryptoClass(class string) bool {
+	for _, prefix := range CryptoPackages {
+		if strings.HasPrefix(class, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// invokeArguments returns the registers holding the first register of
+// each parameter of method, leaving out the receiver of instance calls and
+// the second half of longs and doubles.
+func (d *DEX) invokeArguments(method *MethodIdItem, instance bool, registers []uint16) []uint16 {
+	if instance {
+		if len(registers) == 0 {
+			return nil
+		}
+		registers = registers[1:]
+	}
+
+	shorty, err := d.Shorty(method.ProtoIdx)
+	if err != nil {
+		return nil
+	}
+
+	args := []uint16{}
+	for i := 1; i < len(shorty) && len(registers) > 0; i++ {
+		args = append(args, registers[0])
+		registers = registers[1:]
+		if (shorty[i] == 'J' || shorty[i] == 'D') && len(registers) > 0 {
+			registers = registers[1:]
+		}
+	}
+	return args
+}
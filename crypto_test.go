@@ -0,0 +1,58 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestCryptoUsage(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Vault;", "Ljava/lang/Object;")
+	getInstance := b.method("Ljavax/crypto/Cipher;", "getInstance", "Ljavax/crypto/Cipher;", "Ljava/lang/String;")
+	getBytes := b.method("Ljava/lang/String;", "getBytes", "[B")
+	keySpec := b.method("Ljavax/crypto/spec/SecretKeySpec;", "<init>", "V", "[B", "Ljava/lang/String;")
+	length := b.method("Ljava/lang/String;", "length", "I")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Vault;", "cipher", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 4, outs: 3, insns: []uint16{
+				0x001a, uint16(b.str("AES/CBC/PKCS5Padding")), // const-string v0, "AES/CBC/PKCS5Padding"
+				0x1071, uint16(getInstance), 0x0000, // invoke-static {v0}, Cipher.getInstance
+				0x000c,                                    // move-result-object v0
+				0x011a, uint16(b.str("0123456789abcdef")), // const-string v1, "0123456789abcdef"
+				0x106e, uint16(length), 0x0001, // invoke-virtual {v1}, String.length
+				0x106e, uint16(getBytes), 0x0001, // invoke-virtual {v1}, String.getBytes
+				0x010c,                       // move-result-object v1
+				0x021a, uint16(b.str("AES")), // const-string v2, "AES"
+				0x0322, uint16(b.typ("Ljavax/crypto/spec/SecretKeySpec;")), // new-instance v3, SecretKeySpec
+				0x3070, uint16(keySpec), 0x0213, // invoke-direct {v3, v1, v2}, SecretKeySpec.<init>
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	uses := dex.CryptoUsage()
+	if len(uses) != 2 {
+		t.Fatalf("Test failed %v %d", uses, 2)
+	}
+
+	for i, want := range []struct {
+		api       string
+		offset    uint32
+		algorithm string
+		key       string
+	}{
+		{"getInstance", 4, "AES/CBC/PKCS5Padding", ""},
+		{"<init>", 38, "AES", "0123456789abcdef"},
+	} {
+		use := uses[i]
+		if use.API.Name() != want.api || use.Offset != want.offset || use.Algorithm != want.algorithm || use.Key != want.key {
+			t.Errorf("Test failed %s %x %q %q", use.API.Name(), use.Offset, use.Algorithm, use.Key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package godex
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MethodsCSV writes one csv row per method to w, after a header row, with
+// its class, name, descriptor, access flags and instruction count.
+func (d *DEX) MethodsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"class", "name", "signature", "access_flags", "instructions"}); err != nil {
+		return err
+	}
+
+	err := d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		descriptor, err := d.Prototypes[m.Method.ProtoIdx].descriptor()
+		if err != nil {
+			return err
+		}
+
+		count, err := m.InstructionCount()
+		if err != nil {
+			return err
+		}
+
+		return cw.Write([]string{
+			m.Method.Class(),
+			m.Method.Name(),
+			descriptor,
+			strings.TrimSpace(m.AccessFlags.methodString()),
+			strconv.Itoa(count),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,43 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestMethodsCSV(t *testing.T) {
+	b := testHelloDEX()
+	b.classes[0].virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "greet, \"quoted\"", "V", "Ljava/lang/String;", "I"),
+			flags: ACC_PUBLIC | ACC_FINAL | ACC_VARARGS,
+			code:  &testCode{registers: 3, ins: 3, insns: []uint16{0x000e}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dex.MethodsCSV(&buf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := [][]string{
+		{"class", "name", "signature", "access_flags", "instructions"},
+		{"Lcom/example/Hello;", "<init>", "()V", "public constructor", "2"},
+		{"Lcom/example/Hello;", "greet, \"quoted\"", "(Ljava/lang/String;I)V", "public final varargs", "1"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Test failed %q %q", rows, want)
+	}
+}
@@ -0,0 +1,205 @@
+package godex
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SimpleDecompile renders trivial methods as a pseudo-Java statement, eg.
+// "return this.name;". It recognizes returning a constant, a field or the
+// result of a single call, and calls whose result is discarded. Other
+// methods return false.
+func (m *EncodedMethod) SimpleDecompile() (string, bool) {
+	insns, err := m.Instructions()
+	if err != nil || len(insns) == 0 {
+		return "", false
+	}
+
+	d := decompiler{m: m, params: m.ParameterRegisterMap()}
+
+	last := insns[len(insns)-1]
+	switch {
+	case len(insns) == 1 && last.Name == "return-void":
+		return "return;", true
+	case len(insns) == 2 && last.Name == "return-void":
+		if call, ok := d.call(insns[0]); ok {
+			return call + ";", true
+		}
+	case len(insns) == 2 && d.returns(last, insns[0]):
+		if value, ok := d.value(insns[0]); ok {
+			return "return " + value + ";", true
+		}
+	case len(insns) == 3 && d.returns(last, insns[1]) && strings.HasPrefix(insns[1].Name, "move-result"):
+		if call, ok := d.call(insns[0]); ok {
+			return "return " + call + ";", true
+		}
+	}
+	return "", false
+}
+
+type decompiler struct {
+	m      *EncodedMethod
+	params map[int]int
+}
+
+// returns reports whether ret returns the register insn writes to.
+func (d decompiler) returns(ret, insn DecodedInstruction) bool {
+	if !strings.HasPrefix(ret.Name, "return") || ret.Name == "return-void" || len(ret.Operands) == 0 || len(insn.Operands) == 0 {
+		return false
+	}
+	return ret.Operands[0] == insn.Operands[0]
+}
+
+// returnType returns the java name of the method's return type.
+func (d decompiler) returnType() (string, bool) {
+	proto, err := d.m.dex.ProtoAt(uint32(d.m.Method.ProtoIdx))
+	if err != nil {
+		return "", false
+	}
+
+	t, err := d.m.dex.TypeAt(proto.ReturnTypeIdx)
+	if err != nil {
+		return "", false
+	}
+	return t.JavaName(), true
+}
+
+// value renders an instruction loading a constant or a field.
+func (d decompiler) value(insn DecodedInstruction) (string, bool) {
+	dex := d.m.dex
+
+	switch insn.Name {
+	case "const/4", "const/16", "const", "const/high16":
+		v := insn.Operands[1].(LiteralOperand).Value
+		ret, ok := d.returnType()
+		if !ok {
+			return "", false
+		}
+
+		switch ret {
+		case "boolean":
+			return strconv.FormatBool(v != 0), true
+		case "float":
+			return floatLiteral(float64(math.Float32frombits(uint32(v))), 32, "f")
+		}
+		return strconv.FormatInt(v, 10), true
+	case "const-wide/16", "const-wide/32", "const-wide":
+		v := insn.Operands[1].(LiteralOperand).Value
+		ret, ok := d.returnType()
+		if !ok {
+			return "", false
+		}
+
+		if ret == "double" {
+			return floatLiteral(math.Float64frombits(uint64(v)), 64, "")
+		}
+		return strconv.FormatInt(v, 10) + "L", true
+	case "const-string", "const-string/jumbo":
+		idx := insn.Operands[1].(StringIndexOperand).Index
+		s, err := dex.StringAt(idx)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Quote(s), true
+	}
+
+	field, ok := insn.Operands[len(insn.Operands)-1].(FieldIndexOperand)
+	if !ok || int(field.Index) >= len(dex.Fields) {
+		return "", false
+	}
+	f := dex.Fields[field.Index]
+
+	switch {
+	case strings.HasPrefix(insn.Name, "iget"):
+		object, ok := d.register(insn.Operands[1])
+		if !ok {
+			return "", false
+		}
+		return object + "." + f.String(), true
+	case strings.HasPrefix(insn.Name, "sget"):
+		class, err := dex.TypeAt(uint32(f.ClassIdx))
+		if err != nil {
+			return "", false
+		}
+		return simpleName(class.JavaName()) + "." + f.String(), true
+	}
+	return "", false
+}
+
+// call renders an invoke whose arguments are all parameters. The second
+// register of wide parameters has no name, so those calls are not
+// recognized.
+func (d decompiler) call(insn DecodedInstruction) (string, bool) {
+	if !strings.HasPrefix(insn.Name, "invoke-") || len(insn.Operands) == 0 {
+		return "", false
+	}
+
+	method, ok := insn.Operands[len(insn.Operands)-1].(MethodIndexOperand)
+	if !ok || int(method.Index) >= len(d.m.dex.Methods) {
+		return "", false
+	}
+	target := d.m.dex.Methods[method.Index]
+
+	args := []string{}
+	for _, operand := range insn.Operands[:len(insn.Operands)-1] {
+		arg, ok := d.register(operand)
+		if !ok {
+			return "", false
+		}
+		args = append(args, arg)
+	}
+
+	class, err := d.m.dex.TypeAt(uint32(target.ClassIdx))
+	if err != nil {
+		return "", false
+	}
+
+	receiver := simpleName(class.JavaName())
+	if !strings.HasPrefix(insn.Name, "invoke-static") {
+		if len(args) == 0 {
+			return "", false
+		}
+		receiver, args = args[0], args[1:]
+	}
+
+	return fmt.Sprintf("%s.%s(%s)", receiver, target.Name(), strings.Join(args, ", ")), true
+}
+
+// register names a parameter register this, arg0, arg1, ...
+func (d decompiler) register(operand Operand) (string, bool) {
+	r, ok := operand.(RegisterOperand)
+	if !ok {
+		return "", false
+	}
+
+	idx, ok := d.params[int(r.Register)]
+	if !ok {
+		return "", false
+	}
+
+	if idx == -1 {
+		return "this", true
+	}
+	return fmt.Sprintf("arg%d", idx), true
+}
+
+// floatLiteral formats f as a java literal of the given bit size, eg.
+// 1.0f. NaN and the infinities have no literal.
+func floatLiteral(f float64, bitSize int, suffix string) (string, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", false
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s + suffix, true
+}
+
+// simpleName strips the package of a java class name.
+func simpleName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,117 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestSimpleDecompile(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/User;", "Ljava/lang/Object;")
+	name := b.field("Lcom/example/User;", "Ljava/lang/String;", "name")
+	format := b.method("Lcom/example/Util;", "format", "Ljava/lang/String;", "Ljava/lang/String;")
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/User;", "getName", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x1054, uint16(name), // iget-object v0, v1, name
+				0x0011, // return-object v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "getVersion", "I"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0013, 0x002a, // const/16 v0, 42
+				0x000f, // return v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "isAdmin", "Z"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0012, // const/4 v0, 0
+				0x000f, // return v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "display", "Ljava/lang/String;", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 3, ins: 2, outs: 1, insns: []uint16{
+				0x1071, uint16(format), 0x0002, // invoke-static {v2}, Util.format
+				0x000c, // move-result-object v0
+				0x0011, // return-object v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "loop", "V"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 1, ins: 1, insns: []uint16{
+				0x0028, // goto +0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "getRatio", "F"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0015, 0x3f80, // const/high16 v0, 1.0f
+				0x000f, // return v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "getScale", "D"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 3, ins: 1, insns: []uint16{
+				0x0018, 0x0000, 0x0000, 0x0000, 0x4004, // const-wide v0, 2.5
+				0x0010, // return-wide v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/User;", "getDefault", "Ljava/lang/String;"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0062, uint16(b.field("Lcom/example/User;", "Ljava/lang/String;", "DEFAULT")), // sget-object v0, DEFAULT
+				0x0011, // return-object v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[string]string{
+		"getName":    "return this.name;",
+		"getVersion": "return 42;",
+		"isAdmin":    "return false;",
+		"display":    "return Util.format(arg0);",
+		"getRatio":   "return 1.0f;",
+		"getScale":   "return 2.5;",
+		"getDefault": "return User.DEFAULT;",
+	}
+
+	for _, m := range dex.Classes[0].ClassData.VirtualMethods {
+		s, ok := m.SimpleDecompile()
+		if ok != (want[m.Method.Name()] != "") || s != want[m.Method.Name()] {
+			t.Errorf("Test failed %s %s %s", m.Method.Name(), s, want[m.Method.Name()])
+		}
+	}
+
+	// parsing rejects these, but the pools are exported
+	for i := range dex.Prototypes {
+		dex.Prototypes[i].ReturnTypeIdx = 999
+	}
+	for i := range dex.Fields {
+		dex.Fields[i].ClassIdx = 999
+	}
+
+	for _, m := range dex.Classes[0].ClassData.VirtualMethods {
+		switch m.Method.Name() {
+		case "getRatio", "getScale", "getDefault":
+			if s, ok := m.SimpleDecompile(); ok {
+				t.Errorf("Test failed %s %s", m.Method.Name(), s)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package godex
+
+import (
+	"strings"
+)
+
+// stringConstructorAPIs build a string from decoded bytes or chars.
+var stringConstructorAPIs = []string{
+	"Ljava/lang/String;-><init>",
+	"Ljava/lang/String;->valueOf",
+	"Ljava/lang/String;->copyValueOf",
+}
+
+type StringDecryptorOptions struct {
+	// MinArithmetic is the number of xor, add or sub instructions on array
+	// elements a loop needs, defaults to 1. Raise it to flag fewer methods.
+	MinArithmetic int
+}
+
+// StringDecryptors returns the methods that look like string decryption
+// routines, see StringDecryptorsWith.
+func (d *DEX) StringDecryptors() []MethodRef {
+	return d.StringDecryptorsWith(StringDecryptorOptions{})
+}
+
+// StringDecryptorsWith flags methods with a loop that reads array elements
+// and does xor, add or sub arithmetic on them, and that construct a
+// string. Arithmetic on other registers, eg. the loop counter, does not
+// count. This is a heuristic: it finds the common obfuscator pattern but
+// also checksums or encoders that happen to build strings.
+func (d *DEX) StringDecryptorsWith(opts StringDecryptorOptions) []MethodRef {
+	minArithmetic := opts.MinArithmetic
+	if minArithmetic <= 0 {
+		minArithmetic = 1
+	}
+
+	return d.FindMethods(func(c *ClassDefItem, m *EncodedMethod) bool {
+		constructs := false
+		for _, methodIdx := range m.invokedMethods() {
+			if int(methodIdx) < len(d.Methods) && matchesAPI(&d.Methods[methodIdx], stringConstructorAPIs) {
+				constructs = true
+			}
+		}
+
+		if !constructs {
+			return false
+		}
+
+		cfg, err := m.CFG()
+		if err != nil || cfg == nil {
+			return false
+		}
+
+		for _, loop := range cfg.NaturalLoops() {
+			// registers holding an array element, or arithmetic on one
+			elements := map[uint16]bool{}
+			for _, b := range loop.Body {
+				for _, di := range cfg.Blocks[b].Instructions {
+					if registers := operandRegisters(di); strings.HasPrefix(di.Name, "aget") && len(registers) > 0 {
+						elements[registers[0]] = true
+					}
+				}
+			}
+
+			arithmetic := 0
+			for _, b := range loop.Body {
+				for _, di := range cfg.Blocks[b].Instructions {
+					if !isDecryptArithmetic(di.Name) {
+						continue
+					}
+
+					registers := operandRegisters(di)
+					sources := registers
+					if !strings.HasSuffix(di.Name, "/2addr") && len(registers) > 0 {
+						sources = registers[1:]
+					}
+
+					for _, r := range sources {
+						if elements[r] {
+							arithmetic++
+							elements[registers[0]] = true
+							break
+						}
+					}
+				}
+			}
+
+			if arithmetic >= minArithmetic {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func isDecryptArithmetic(name string) bool {
+	for _, prefix := range []string{"xor-int", "add-int", "sub-int", "rsub-int"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// operandRegisters returns the registers among the operands of di, in
+// order.
+func operandRegisters(di DecodedInstruction) []uint16 {
+	registers := []uint16{}
+	for _, operand := range di.Operands {
+		if r, ok := operand.(RegisterOperand); ok {
+			registers = append(registers, r.Register)
+		}
+	}
+	return registers
+}
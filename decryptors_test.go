@@ -0,0 +1,74 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestStringDecryptors(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Obf;", "Ljava/lang/Object;")
+	stringType := b.typ("Ljava/lang/String;")
+	stringInit := b.method("Ljava/lang/String;", "<init>", "V", "[B")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Obf;", "decrypt", "Ljava/lang/String;", "[B"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 4, ins: 1, outs: 2, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x3121,         // array-length v1, v3
+				0x1035, 0x000c, // if-ge v0, v1, +12
+				0x0248, 0x0003, // aget-byte v2, v3, v0
+				0x02df, 0x2a02, // xor-int/lit8 v2, v2, 42
+				0x228d,         // int-to-byte v2, v2
+				0x024f, 0x0003, // aput-byte v2, v3, v0
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0xf528,                     // goto -11
+				0x0022, uint16(stringType), // new-instance v0, String
+				0x2070, uint16(stringInit), 0x0030, // invoke-direct {v0, v3}, String.<init>
+				0x0011, // return-object v0
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Obf;", "wrap", "Ljava/lang/String;", "[B"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, outs: 2, insns: []uint16{
+				0x0022, uint16(stringType), // new-instance v0, String
+				0x2070, uint16(stringInit), 0x0010, // invoke-direct {v0, v1}, String.<init>
+				0x0011, // return-object v0
+			}},
+		},
+		{
+			// a copy loop only increments its counter
+			idx:   b.method("Lcom/example/Obf;", "copy", "Ljava/lang/String;", "[B"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 4, ins: 1, outs: 2, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x3121,         // array-length v1, v3
+				0x1035, 0x000c, // if-ge v0, v1, +12
+				0x0248, 0x0003, // aget-byte v2, v3, v0
+				0x0000, 0x0000, // nop, nop
+				0x0000,         // nop
+				0x024f, 0x0003, // aput-byte v2, v3, v0
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0xf528,                     // goto -11
+				0x0022, uint16(stringType), // new-instance v0, String
+				0x2070, uint16(stringInit), 0x0030, // invoke-direct {v0, v3}, String.<init>
+				0x0011, // return-object v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	refs := dex.StringDecryptors()
+	if len(refs) != 1 || refs[0].Method.Method.Name() != "decrypt" {
+		t.Fatalf("Test failed %v %v", refs, "decrypt")
+	}
+
+	if refs := dex.StringDecryptorsWith(StringDecryptorOptions{MinArithmetic: 3}); len(refs) != 0 {
+		t.Errorf("Test failed %d %d", len(refs), 0)
+	}
+}
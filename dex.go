@@ -1,12 +1,17 @@
 package godex
 
 import (
-	_ "bytes"
+	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const ENDIAN_CONSTANT = 0x12345678
@@ -17,44 +22,89 @@ var DEX_FILE_MAGIC = []byte{0x64, 0x65, 0x78, 0x0a, 0x30, 0x33, 0x35, 0x00}
 
 type AccessFlags uint32
 
+// Access flags, some bits mean different things for fields and methods,
+// eg. 0x40 is volatile on a field but bridge on a method.
 const (
-	ACC_PUBLIC = 1 << iota
-	ACC_PRIVATE
-	ACC_PROTECTED
-	ACC_STATIC
-	ACC_FINAL
-	ACC_SYNCHRONIZED
-	ACC_VOLATILE
-	ACC_BRIDGE
-	ACC_TRANSIENT
-	ACC_VARARGS
-	ACC_NATIVE
-	ACC_INTERFACE
-	ACC_ABSTRACT
-	ACC_STRICT
-	ACC_SYNTHETIC
-	ACC_ANNOTATION
-	ACC_ENUM
+	ACC_PUBLIC                = 0x1
+	ACC_PRIVATE               = 0x2
+	ACC_PROTECTED             = 0x4
+	ACC_STATIC                = 0x8
+	ACC_FINAL                 = 0x10
+	ACC_SYNCHRONIZED          = 0x20
+	ACC_VOLATILE              = 0x40
+	ACC_BRIDGE                = 0x40
+	ACC_TRANSIENT             = 0x80
+	ACC_VARARGS               = 0x80
+	ACC_NATIVE                = 0x100
+	ACC_INTERFACE             = 0x200
+	ACC_ABSTRACT              = 0x400
+	ACC_STRICT                = 0x800
+	ACC_SYNTHETIC             = 0x1000
+	ACC_ANNOTATION            = 0x2000
+	ACC_ENUM                  = 0x4000
 	ACC_CONSTRUCTOR           = 0x10000
 	ACC_DECLARED_SYNCHRONIZED = 0x20000
 )
 
+// Has reports whether all bits of flag are set.
+func (af AccessFlags) Has(flag AccessFlags) bool {
+	return af&flag == flag
+}
+
+var accessFlagNames = []struct {
+	flag AccessFlags
+	name string
+}{
+	{ACC_PUBLIC, "public"},
+	{ACC_PRIVATE, "private"},
+	{ACC_PROTECTED, "protected"},
+	{ACC_STATIC, "static"},
+	{ACC_FINAL, "final"},
+	{ACC_SYNCHRONIZED, "synchronized"},
+	{ACC_NATIVE, "native"},
+	{ACC_INTERFACE, "interface"},
+	{ACC_ABSTRACT, "abstract"},
+	{ACC_STRICT, "strictfp"},
+	{ACC_SYNTHETIC, "synthetic"},
+	{ACC_ANNOTATION, "annotation"},
+	{ACC_ENUM, "enum"},
+	{ACC_CONSTRUCTOR, "constructor"},
+	{ACC_DECLARED_SYNCHRONIZED, "declared-synchronized"},
+}
+
+// String lists the names of the flags that are set, each followed by a
+// space. The bits that differ between fields and methods, eg. volatile
+// and bridge, are left out.
 func (af AccessFlags) String() string {
 	str := ""
-	if af&ACC_PUBLIC == 0 {
-		str += "public "
-	} else if af&ACC_PRIVATE != 0 {
-		str += "private "
-	} else if af&ACC_PROTECTED != 0 {
-		str += "protected "
-	} else if af&ACC_STATIC != 0 {
-		str += "static "
-	} else if af&ACC_FINAL != 0 {
-		str += "final "
-	} else if af&ACC_SYNCHRONIZED != 0 {
-		str += "synchronized "
-	} else if af&ACC_CONSTRUCTOR != 0 {
-		str += "constructor "
+	for _, f := range accessFlagNames {
+		if af.Has(f.flag) {
+			str += f.name + " "
+		}
+	}
+	return str
+}
+
+// fieldString is String including the flags only fields have.
+func (af AccessFlags) fieldString() string {
+	str := af.String()
+	if af.Has(ACC_VOLATILE) {
+		str += "volatile "
+	}
+	if af.Has(ACC_TRANSIENT) {
+		str += "transient "
+	}
+	return str
+}
+
+// methodString is String including the flags only methods have.
+func (af AccessFlags) methodString() string {
+	str := af.String()
+	if af.Has(ACC_BRIDGE) {
+		str += "bridge "
+	}
+	if af.Has(ACC_VARARGS) {
+		str += "varargs "
 	}
 	return str
 }
@@ -94,6 +144,35 @@ func (h *Header) String() string {
 	return val
 }
 
+// Version is the dex format version from the magic, eg. 35 for "dex\n035".
+// Versions compare as integers.
+type Version int
+
+func (v Version) String() string {
+	return fmt.Sprintf("%03d", int(v))
+}
+
+// DexVersion parses the three version digits of the magic.
+func (h *Header) DexVersion() (Version, error) {
+	if !bytes.Equal(h.Magic[:4], DEX_FILE_MAGIC[:4]) || h.Magic[7] != 0x00 {
+		return 0, fmt.Errorf("Invalid magic %x", h.Magic)
+	}
+
+	v := 0
+	for _, c := range h.Magic[4:7] {
+		if !isDigit(c) {
+			return 0, fmt.Errorf("Invalid version %q", h.Magic[4:7])
+		}
+		v = v*10 + int(c-'0')
+	}
+	return Version(v), nil
+}
+
+// Version returns the dex format version of the file.
+func (d *DEX) Version() (Version, error) {
+	return d.header.DexVersion()
+}
+
 type ClassDefItem struct {
 	dex               *DEX           `pack:"-"`
 	ClassIdx          uint32         `pack:"uint"`
@@ -104,10 +183,33 @@ type ClassDefItem struct {
 	AnnotationsOffset uint32         `pack:"uint"`
 	ClassData         ClassDataItem  `pack:"classdata"`
 	StaticValues      []EncodedValue `pack:"staticvalues"`
+	// offset of the class_def_item in the file
+	offset uint32 `pack:"-"`
 }
 
 func (m *ClassDefItem) String() string {
-	return fmt.Sprintf("%s %s", m.AccessFlags, m.dex.Strings[m.SourceFileIdx])
+	if m.SourceFileIdx == NO_INDEX {
+		return fmt.Sprintf("%s", m.AccessFlags)
+	}
+	return fmt.Sprintf("%s %s", m.AccessFlags, m.dex.string(m.SourceFileIdx))
+}
+
+// Interfaces returns the descriptors of the interfaces the class
+// implements.
+func (m *ClassDefItem) Interfaces() ([]string, error) {
+	types, err := m.dex.readTypeList(m.InterfacesOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]string, len(types))
+	for i, typeIdx := range types {
+		if int(typeIdx) >= len(m.dex.Types) {
+			return nil, fmt.Errorf("Invalid interface type %d", typeIdx)
+		}
+		interfaces[i] = m.dex.Types[typeIdx].String()
+	}
+	return interfaces, nil
 }
 
 type FieldIdItem struct {
@@ -126,26 +228,28 @@ func (m *FieldIdItem) Class() string {
 }
 
 func (m *FieldIdItem) String() string {
-	return fmt.Sprintf("%s", m.dex.Strings[m.NameIdx])
+	return m.dex.string(m.NameIdx)
 }
 
 const (
-	VALUE_BYTE       = 0x00
-	VALUE_SHORT      = 0x02
-	VALUE_CHAR       = 0x03
-	VALUE_INT        = 0x04
-	VALUE_LONG       = 0x06
-	VALUE_FLOAT      = 0x10
-	VALUE_DOUBLE     = 0x11
-	VALUE_STRING     = 0x17
-	VALUE_TYPE       = 0x18
-	VALUE_FIELD      = 0x19
-	VALUE_METHOD     = 0x1a
-	VALUE_ENUM       = 0x1b
-	VALUE_ARRAY      = 0x1c
-	VALUE_ANNOTATION = 0x1d
-	VALUE_NULL       = 0x1e
-	VALUE_BOOLEAN    = 0x1f
+	VALUE_BYTE          = 0x00
+	VALUE_SHORT         = 0x02
+	VALUE_CHAR          = 0x03
+	VALUE_INT           = 0x04
+	VALUE_LONG          = 0x06
+	VALUE_FLOAT         = 0x10
+	VALUE_DOUBLE        = 0x11
+	VALUE_METHOD_TYPE   = 0x15
+	VALUE_METHOD_HANDLE = 0x16
+	VALUE_STRING        = 0x17
+	VALUE_TYPE          = 0x18
+	VALUE_FIELD         = 0x19
+	VALUE_METHOD        = 0x1a
+	VALUE_ENUM          = 0x1b
+	VALUE_ARRAY         = 0x1c
+	VALUE_ANNOTATION    = 0x1d
+	VALUE_NULL          = 0x1e
+	VALUE_BOOLEAN       = 0x1f
 )
 
 type ValueType uint32
@@ -166,6 +270,10 @@ func (vt ValueType) String() string {
 		return "float"
 	case VALUE_DOUBLE:
 		return "double"
+	case VALUE_METHOD_TYPE:
+		return "method_type"
+	case VALUE_METHOD_HANDLE:
+		return "method_handle"
 	case VALUE_STRING:
 		return "string"
 	case VALUE_TYPE:
@@ -192,6 +300,7 @@ func (vt ValueType) String() string {
 type EncodedValue struct {
 	dex       *DEX      `pack:"-"`
 	ValueType ValueType `pack:"-"`
+	Arg       byte      `pack:"-"`
 	Data      []byte    `pack:"-"`
 }
 
@@ -202,328 +311,363 @@ type EncodedArray struct {
 
 type EncodedField struct {
 	dex          *DEX        `pack:"-"`
+	classIdx     int         `pack:"-"`
+	FieldIdx     uint32      `pack:"-"`
 	Field        FieldIdItem `pack:"-"`
 	FieldIdxDiff uint64      `pack:"uleb128"`
 	AccessFlags  AccessFlags `pack:"uleb128"`
 }
 
+// StaticValue returns the initial value of a static field. Static values
+// are stored in the order of the static fields, trailing fields without a
+// value are initialized to zero or null and have none.
+func (f *EncodedField) StaticValue() (EncodedValue, bool) {
+	class := &f.dex.Classes[f.classIdx]
+	for i, field := range class.ClassData.StaticFields {
+		if field.FieldIdx != f.FieldIdx {
+			continue
+		}
+
+		if i >= len(class.StaticValues) {
+			break
+		}
+		return class.StaticValues[i], true
+	}
+	return EncodedValue{}, false
+}
+
+func (f *EncodedField) IsStatic() bool {
+	return f.AccessFlags.Has(ACC_STATIC)
+}
+
+func (f *EncodedField) IsFinal() bool {
+	return f.AccessFlags.Has(ACC_FINAL)
+}
+
+// IsVolatile reports whether the field is volatile, the bit is bridge for
+// methods.
+func (f *EncodedField) IsVolatile() bool {
+	return f.AccessFlags.Has(ACC_VOLATILE)
+}
+
+// IsTransient reports whether the field is transient, the bit is varargs
+// for methods.
+func (f *EncodedField) IsTransient() bool {
+	return f.AccessFlags.Has(ACC_TRANSIENT)
+}
+
+// String returns the field as a java declaration, eg.
+// "private volatile int count", including the flags only fields have.
+func (f *EncodedField) String() string {
+	return f.AccessFlags.fieldString() + f.dex.Types[f.Field.TypeIdx].JavaName() + " " + f.Field.String()
+}
+
 type EncodedMethod struct {
 	dex           *DEX         `pack:"-"`
+	classIdx      int          `pack:"-"`
+	MethodIdx     uint32       `pack:"-"`
 	Method        MethodIdItem `pack:"-"`
 	MethodIdxDiff uint64       `pack:"uleb128"`
 	AccessFlags   AccessFlags  `pack:"uleb128"`
 	CodeOffset    uint64       `pack:"uleb128"`
+	// decoded code indexed by offset, built by InstructionAt
+	decoded *decodedCode `pack:"-"`
+}
+
+func (m *EncodedMethod) IsStatic() bool {
+	return m.AccessFlags.Has(ACC_STATIC)
+}
+
+func (m *EncodedMethod) IsAbstract() bool {
+	return m.AccessFlags.Has(ACC_ABSTRACT)
+}
+
+func (m *EncodedMethod) IsNative() bool {
+	return m.AccessFlags.Has(ACC_NATIVE)
+}
+
+// IsSynthetic reports whether the method was generated by the compiler,
+// eg. accessors for inner classes.
+func (m *EncodedMethod) IsSynthetic() bool {
+	return m.AccessFlags.Has(ACC_SYNTHETIC)
+}
+
+// IsBridge reports whether the method is a compiler generated bridge for
+// generics or covariant return types.
+func (m *EncodedMethod) IsBridge() bool {
+	return m.AccessFlags.Has(ACC_BRIDGE)
+}
+
+// IsConstructor reports whether the method is an instance constructor,
+// <init>.
+func (m *EncodedMethod) IsConstructor() bool {
+	return m.Method.Name() == "<init>"
+}
+
+// IsStaticInitializer reports whether the method is the static
+// initializer of its class, <clinit>.
+func (m *EncodedMethod) IsStaticInitializer() bool {
+	return m.Method.Name() == "<clinit>"
 }
 
 type Instruction struct {
 	Name   string
-	Length int
+	Format string
+}
+
+// Mnemonic returns the opcode name without the operand syntax.
+func (i Instruction) Mnemonic() string {
+	if n := strings.Index(i.Name, " "); n != -1 {
+		return i.Name[:n]
+	}
+	return i.Name
+}
+
+// Size returns the size of the instruction in 16-bit code units, as
+// determined by its format.
+func (i Instruction) Size() int {
+	return formatSizes[i.Format]
+}
+
+var formatSizes = map[string]int{
+	"10x": 1, "12x": 1, "11n": 1, "11x": 1, "10t": 1,
+	"20t": 2, "22x": 2, "21t": 2, "21s": 2, "21h": 2, "21c": 2,
+	"23x": 2, "22b": 2, "22t": 2, "22s": 2, "22c": 2,
+	"30t": 3, "32x": 3, "31i": 3, "31t": 3, "31c": 3, "35c": 3, "3rc": 3,
+	"45cc": 4, "4rcc": 4,
+	"51l": 5,
 }
 
 var instructions map[byte]Instruction = map[byte]Instruction{
-	0x00: Instruction{Name: "nop", Length: 0},
-	0x01: Instruction{Name: "move vA, vB", Length: 1},
-	0x02: Instruction{Name: "move/from16 vAA, vBBBB", Length: 3},
-	0x03: Instruction{Name: "move/16 vAAAA, vBBBB", Length: 4},
-	0x04: Instruction{Name: "move-wide vA, vB", Length: 1},
-	0x05: Instruction{Name: "move-wide/from16 vAA, vBBBB", Length: 3},
-	0x06: Instruction{Name: "move-wide/16 vAAAA, vBBBB", Length: 4},
-	0x07: Instruction{Name: "move-object vA, vB", Length: 1},
-	0x08: Instruction{Name: "move-object/from16 vAA, vBBBB", Length: 3},
-	0x09: Instruction{Name: "move-object/16 vAAAA, vBBBB", Length: 4},
-	0x0a: Instruction{Name: "move-result vAA", Length: 1},
-	0x0b: Instruction{Name: "move-result-wide vAA", Length: 1},
-	0x0c: Instruction{Name: "move-result-object vAA", Length: 1},
-	0x0d: Instruction{Name: "move-exception vAA", Length: 1},
-	0x0e: Instruction{Name: "return-void", Length: 1},
-	0x0f: Instruction{Name: "return vAA", Length: 1},
-	0x10: Instruction{Name: "return-wide vAA", Length: 1},
-	0x11: Instruction{Name: "return-object vAA", Length: 1},
-	0x12: Instruction{Name: "const/4 vA, #+B", Length: 1},
-	0x13: Instruction{Name: "const/16 vAA, #+BBBB", Length: 3},
-	0x14: Instruction{Name: "const vAA, #+BBBBBBBB", Length: 5},
-	0x15: Instruction{Name: "const/high16 vAA, #+BBBB0000", Length: 5},
-	0x16: Instruction{Name: "const-wide/16 vAA, #+BBBB", Length: 3},
-	0x17: Instruction{Name: "const-wide/32 vAA, #+BBBBBBBB", Length: 5},
-	0x18: Instruction{Name: "const-wide vAA, #+BBBBBBBBBBBBBBBB", Length: 9},
-	0x19: Instruction{Name: "const-wide/high16 vAA, #+BBBB000000000000", Length: 9},
-	0x1a: Instruction{Name: "const-string vAA, string@BBBB", Length: 3},
-	0x1b: Instruction{Name: "const-string/jumbo vAA, string@BBBBBBBB", Length: 5},
-	0x1c: Instruction{Name: "const-class vAA, type@BBBB", Length: 3},
-	0x1d: Instruction{Name: "monitor-enter vAA", Length: 1},
-	0x1e: Instruction{Name: "monitor-exit vAA", Length: 1},
-	0x1f: Instruction{Name: "check-cast vAA, type@BBBB", Length: 3},
-	0x20: Instruction{Name: "instance-of vA, vB, type@CCCC", Length: 3},
-	0x21: Instruction{Name: "array-length vA, vB", Length: 1},
-	0x22: Instruction{Name: "new-instance vAA, type@BBBB", Length: 3},
-	0x23: Instruction{Name: "new-array vA, vB, type@CCCC", Length: 3},
-	0x24: Instruction{Name: "filled-new-array {Name:vC, vD, vE, vF, vG}, type@BBBB", Length: -1},
-	0x25: Instruction{Name: "filled-new-array/range {Name:vCCCC .. vNNNN}, type@BBBB", Length: -1},
-	0x26: Instruction{Name: "fill-array-data vAA, +BBBBBBBB", Length: -1},
-	0x27: Instruction{Name: "throw vAA", Length: 1},
-	0x28: Instruction{Name: "goto +AA", Length: 1},
-	0x29: Instruction{Name: "goto/16 +AAAA", Length: 2},
-	0x2a: Instruction{Name: "goto/32 +AAAAAAAA", Length: 4},
-	0x2b: Instruction{Name: "packed-switch vAA, +BBBBBBBB", Length: -1},
-	0x2c: Instruction{Name: "sparse-switch vAA, +BBBBBBBB", Length: -1},
-	0x2d: Instruction{Name: "cmpl-float vAA, vBB, vCC", Length: 3},
-	0x2e: Instruction{Name: "cmpg-float vAA, vBB, vCC", Length: 3},
-	0x2f: Instruction{Name: "cmpl-double vAA, vBB, vCC", Length: 3},
-	0x30: Instruction{Name: "cmplg-double vAA, vBB, vCC", Length: 3},
-	0x31: Instruction{Name: "cmp-long vAA, vBB, vCC", Length: 3},
-	0x32: Instruction{Name: "if-eq vA, vB, +CCCC", Length: 3},
-	0x33: Instruction{Name: "if-ne vA, vB, +CCCC", Length: 3},
-	0x34: Instruction{Name: "if-lt vA, vB, +CCCC", Length: 3},
-	0x35: Instruction{Name: "if-ge vA, vB, +CCCC", Length: 3},
-	0x36: Instruction{Name: "if-gt vA, vB, +CCCC", Length: 3},
-	0x37: Instruction{Name: "if-le vA, vB, +CCCC", Length: 3},
-	0x38: Instruction{Name: "if-eqz vAA, +BBBB", Length: 3},
-	0x39: Instruction{Name: "if-nez vAA, +BBBB", Length: 3},
-	0x3a: Instruction{Name: "if-ltz vAA, +BBBB", Length: 3},
-	0x3b: Instruction{Name: "if-gez vAA, +BBBB", Length: 3},
-	0x3c: Instruction{Name: "if-gtz vAA, +BBBB", Length: 3},
-	0x3d: Instruction{Name: "if-lez vAA, +BBBB", Length: 3},
-	0x44: Instruction{Name: "aget vAA, vBB, vCC", Length: -1},
-	0x45: Instruction{Name: "aget-wide vAA, vBB, vCC", Length: -1},
-	0x46: Instruction{Name: "aget-object vAA, vBB, vCC", Length: -1},
-	0x47: Instruction{Name: "aget-boolean vAA, vBB, vCC", Length: -1},
-	0x48: Instruction{Name: "aget-byte vAA, vBB, vCC", Length: -1},
-	0x49: Instruction{Name: "aget-char vAA, vBB, vCC", Length: -1},
-	0x4a: Instruction{Name: "aget-short vAA, vBB, vCC", Length: -1},
-	0x4b: Instruction{Name: "aput vAA, vBB, vCC", Length: -1},
-	0x4c: Instruction{Name: "aput-wide vAA, vBB, vCC", Length: -1},
-	0x4d: Instruction{Name: "aput-object vAA, vBB, vCC", Length: -1},
-	0x4e: Instruction{Name: "aput-boolean vAA, vBB, vCC", Length: -1},
-	0x4f: Instruction{Name: "aput-byte vAA, vBB, vCC", Length: -1},
-	0x50: Instruction{Name: "aput-char vAA, vBB, vCC", Length: -1},
-	0x51: Instruction{Name: "aput-short vAA, vBB, vCC", Length: -1},
-	0x52: Instruction{Name: "iget vA, vB, field@CCCC", Length: 3},
-	0x53: Instruction{Name: "iget-wide vA, vB, field@CCCC", Length: 3},
-	0x54: Instruction{Name: "iget-object vA, vB, field@CCCC", Length: 3},
-	0x55: Instruction{Name: "iget-boolean vA, vB, field@CCCC", Length: 3},
-	0x56: Instruction{Name: "iget-byte vA, vB, field@CCCC", Length: 3},
-	0x57: Instruction{Name: "iget-char vA, vB, field@CCCC", Length: 3},
-	0x58: Instruction{Name: "iget-short vA, vB, field@CCCC", Length: 3},
-	0x59: Instruction{Name: "iput vA, vB, field@CCCC", Length: 3},
-	0x5a: Instruction{Name: "iput-wide vA, vB, field@CCCC", Length: 3},
-	0x5b: Instruction{Name: "iput-object vA, vB, field@CCCC", Length: 3},
-	0x5c: Instruction{Name: "iput-boolean vA, vB, field@CCCC", Length: 3},
-	0x5d: Instruction{Name: "iput-byte vA, vB, field@CCCC", Length: 3},
-	0x5e: Instruction{Name: "iput-char vA, vB, field@CCCC", Length: 3},
-	0x5f: Instruction{Name: "iput-short vA, vB, field@CCCC", Length: 3},
-	0x60: Instruction{Name: "sget vAA, field@BBBB", Length: 3},
-	0x61: Instruction{Name: "sget-wide vAA, field@BBBB", Length: 3},
-	0x62: Instruction{Name: "sget-object vAA, field@BBBB", Length: 3},
-	0x63: Instruction{Name: "sget-boolean vAA, field@BBBB", Length: 3},
-	0x64: Instruction{Name: "sget-byte vAA, field@BBBB", Length: 3},
-	0x65: Instruction{Name: "sget-char vAA, field@BBBB", Length: 3},
-	0x66: Instruction{Name: "sget-short vAA, field@BBBB", Length: 3},
-	0x67: Instruction{Name: "sput vAA, field@BBBB", Length: 3},
-	0x68: Instruction{Name: "sput-wide vAA, field@BBBB", Length: 3},
-	0x69: Instruction{Name: "sput-object vAA, field@BBBB", Length: 3},
-	0x6a: Instruction{Name: "sput-boolean vAA, field@BBBB", Length: 3},
-	0x6b: Instruction{Name: "sput-byte vAA, field@BBBB", Length: 3},
-	0x6c: Instruction{Name: "sput-char vAA, field@BBBB", Length: 3},
-	0x6d: Instruction{Name: "sput-short vAA, field@BBBB", Length: 3},
-	0x6e: Instruction{Name: "invoke-virtual {Name:vC, vD, vE, vF, vG}, meth@BBBB", Length: 5},
-	0x6f: Instruction{Name: "invoke-super {Name:vC, vD, vE, vF, vG}, meth@BBBB", Length: 5},
-	0x70: Instruction{Name: "invoke-direct {Name:vC, vD, vE, vF, vG}, meth@BBBB", Length: 5},
-	0x71: Instruction{Name: "invoke-static {Name:vC, vD, vE, vF, vG}, meth@BBBB", Length: 5},
-	0x72: Instruction{Name: "invoke-interface {Name:vC, vD, vE, vF, vG}, meth@BBBB", Length: 5},
-	0x74: Instruction{Name: "invoke-virtual/range {Name:vCCCC .. vNNNN}, meth@BBBB", Length: 5},
-	0x75: Instruction{Name: "invoke-super/range {Name:vCCCC .. vNNNN}, meth@BBBB", Length: 5},
-	0x76: Instruction{Name: "invoke-direct/range {Name:vCCCC .. vNNNN}, meth@BBBB", Length: 5},
-	0x77: Instruction{Name: "invoke-static/range {Name:vCCCC .. vNNNN}, meth@BBBB", Length: 5},
-	0x78: Instruction{Name: "invoke-interface/range {Name:vCCCC .. vNNNN}, meth@BBBB", Length: 5},
-	0x7b: Instruction{Name: "neg-int vA, vB", Length: 1},
-	0x7c: Instruction{Name: "not-int vA, vB", Length: 1},
-	0x7d: Instruction{Name: "neg-long vA, vB", Length: 1},
-	0x7e: Instruction{Name: "not-long vA, vB", Length: 1},
-	0x7f: Instruction{Name: "neg-float vA, vB", Length: 1},
-	0x80: Instruction{Name: "neg-double vA, vB", Length: 1},
-	0x81: Instruction{Name: "int-to-long vA, vB", Length: 1},
-	0x82: Instruction{Name: "int-to-float vA, vB", Length: 1},
-	0x83: Instruction{Name: "int-to-double vA, vB", Length: 1},
-	0x84: Instruction{Name: "long-to-int vA, vB", Length: 1},
-	0x85: Instruction{Name: "long-to-float vA, vB", Length: 1},
-	0x86: Instruction{Name: "long-to-double vA, vB", Length: 1},
-	0x87: Instruction{Name: "float-to-int vA, vB", Length: 1},
-	0x88: Instruction{Name: "float-to-long vA, vB", Length: 1},
-	0x89: Instruction{Name: "float-to-double vA, vB", Length: 1},
-	0x8a: Instruction{Name: "double-to-int vA, vB", Length: 1},
-	0x8b: Instruction{Name: "double-to-long vA, vB", Length: 1},
-	0x8c: Instruction{Name: "double-to-float vA, vB", Length: 1},
-	0x8d: Instruction{Name: "int-to-byte vA, vB", Length: 1},
-	0x8e: Instruction{Name: "int-to-char vA, vB", Length: 1},
-	0x8f: Instruction{Name: "int-to-short vA, vB", Length: 1},
-	0x90: Instruction{Name: "add-int vAA, vBB, vCC", Length: 3},
-	0x91: Instruction{Name: "sub-int vAA, vBB, vCC", Length: 3},
-	0x92: Instruction{Name: "mul-int vAA, vBB, vCC", Length: 3},
-	0x93: Instruction{Name: "div-int vAA, vBB, vCC", Length: 3},
-	0x94: Instruction{Name: "rem-int vAA, vBB, vCC", Length: 3},
-	0x95: Instruction{Name: "and-int vAA, vBB, vCC", Length: 3},
-	0x96: Instruction{Name: "or-int vAA, vBB, vCC", Length: 3},
-	0x97: Instruction{Name: "xor-int vAA, vBB, vCC", Length: 3},
-	0x98: Instruction{Name: "shl-int vAA, vBB, vCC", Length: 3},
-	0x99: Instruction{Name: "shr-int vAA, vBB, vCC", Length: 3},
-	0x9a: Instruction{Name: "ushr-int vAA, vBB, vCC", Length: 3},
-	0x9b: Instruction{Name: "add-long vAA, vBB, vCC", Length: 3},
-	0x9c: Instruction{Name: "sub-long vAA, vBB, vCC", Length: 3},
-	0x9d: Instruction{Name: "mul-long vAA, vBB, vCC", Length: 3},
-	0x9e: Instruction{Name: "div-long vAA, vBB, vCC", Length: 3},
-	0x9f: Instruction{Name: "rem-long vAA, vBB, vCC", Length: 3},
-	0xA0: Instruction{Name: "and-long vAA, vBB, vCC", Length: 3},
-	0xA1: Instruction{Name: "or-long vAA, vBB, vCC", Length: 3},
-	0xA2: Instruction{Name: "xor-long vAA, vBB, vCC", Length: 3},
-	0xA3: Instruction{Name: "shl-long vAA, vBB, vCC", Length: 3},
-	0xA4: Instruction{Name: "shr-long vAA, vBB, vCC", Length: 3},
-	0xA5: Instruction{Name: "ushr-long vAA, vBB, vCC", Length: 3},
-	0xA6: Instruction{Name: "add-float vAA, vBB, vCC", Length: 3},
-	0xA7: Instruction{Name: "sub-float vAA, vBB, vCC", Length: 3},
-	0xA8: Instruction{Name: "mul-float vAA, vBB, vCC", Length: 3},
-	0xA9: Instruction{Name: "div-float vAA, vBB, vCC", Length: 3},
-	0xAA: Instruction{Name: "rem-float vAA, vBB, vCC", Length: 3},
-	0xAB: Instruction{Name: "add-double vAA, vBB, vCC", Length: 3},
-	0xAC: Instruction{Name: "sub-double vAA, vBB, vCC", Length: 3},
-	0xAD: Instruction{Name: "mul-double vAA, vBB, vCC", Length: 3},
-	0xAE: Instruction{Name: "div-double vAA, vBB, vCC", Length: 3},
-	0xAF: Instruction{Name: "rem-double vAA, vBB, vCC", Length: 3},
-	0xB0: Instruction{Name: "add-int/2addr vA, vB", Length: 1},
-	0xB1: Instruction{Name: "sub-int2addr vA, vB", Length: 1},
-	0xB2: Instruction{Name: "mul-int/2addr vA, vB", Length: 1},
-	0xB3: Instruction{Name: "div-int/2addr vA, vB", Length: 1},
-	0xB4: Instruction{Name: "rem-int/2addr vA, vB", Length: 1},
-	0xB5: Instruction{Name: "and-int/2addr vA, vB", Length: 1},
-	0xB6: Instruction{Name: "or-int/2addr vA, vB", Length: 1},
-	0xB7: Instruction{Name: "xor-int/2addr vA, vB", Length: 1},
-	0xB8: Instruction{Name: "shl-int/2addr vA, vB", Length: 1},
-	0xB9: Instruction{Name: "shr-int/2addr vA, vB", Length: 1},
-	0xBa: Instruction{Name: "ushr-int/2addr vA, vB", Length: 1},
-	0xBb: Instruction{Name: "add-long/2addr vA, vB", Length: 1},
-	0xBc: Instruction{Name: "sub-long/2addr vA, vB", Length: 1},
-	0xBd: Instruction{Name: "mul-long/2addr vA, vB", Length: 1},
-	0xBe: Instruction{Name: "div-long/2addr vA, vB", Length: 1},
-	0xBf: Instruction{Name: "rem-long/2addr vA, vB", Length: 1},
-	0xc0: Instruction{Name: "and-long/2addr vA, vB", Length: 1},
-	0xc1: Instruction{Name: "or-long/2addr vA, vB", Length: 1},
-	0xc2: Instruction{Name: "xor-long/2addr vA, vB", Length: 1},
-	0xc3: Instruction{Name: "shl-long/2addr vA, vB", Length: 1},
-	0xc4: Instruction{Name: "shr-long/2addr vA, vB", Length: 1},
-	0xc5: Instruction{Name: "ushr-long/2addr vA, vB", Length: 1},
-	0xc6: Instruction{Name: "add-float/2addr vA, vB", Length: 1},
-	0xc7: Instruction{Name: "sub-float/2addr vA, vB", Length: 1},
-	0xc8: Instruction{Name: "mul-float/2addr vA, vB", Length: 1},
-	0xc9: Instruction{Name: "div-float/2addr vA, vB", Length: 1},
-	0xca: Instruction{Name: "rem-float/2addr vA, vB", Length: 1},
-	0xcb: Instruction{Name: "add-double/2addr vA, vB", Length: 1},
-	0xcc: Instruction{Name: "sub-double/2addr vA, vB", Length: 1},
-	0xcd: Instruction{Name: "mul-double/2addr vA, vB", Length: 1},
-	0xce: Instruction{Name: "div-double/2addr vA, vB", Length: 1},
-	0xcf: Instruction{Name: "rem-double/2addr vA, vB", Length: 1},
-	0xd0: Instruction{Name: "add-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd1: Instruction{Name: "rsub-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd2: Instruction{Name: "mul-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd3: Instruction{Name: "div-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd4: Instruction{Name: "rem-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd5: Instruction{Name: "and-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd6: Instruction{Name: "or-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd7: Instruction{Name: "xor-int/lit16 vA, vB, #+CCCC", Length: 3},
-	0xd8: Instruction{Name: "add-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xd9: Instruction{Name: "rsub-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xda: Instruction{Name: "mul-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xdb: Instruction{Name: "div-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xdc: Instruction{Name: "rem-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xdd: Instruction{Name: "and-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xde: Instruction{Name: "or-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xdf: Instruction{Name: "xor-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xe0: Instruction{Name: "shl-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xe1: Instruction{Name: "shr-int/lit8 vAA, vBB, #+CC", Length: 3},
-	0xe2: Instruction{Name: "ushr-int/lit8 vAA, vBB, #+CC", Length: 3},
+	0x00: Instruction{Name: "nop", Format: "10x"},
+	0x01: Instruction{Name: "move vA, vB", Format: "12x"},
+	0x02: Instruction{Name: "move/from16 vAA, vBBBB", Format: "22x"},
+	0x03: Instruction{Name: "move/16 vAAAA, vBBBB", Format: "32x"},
+	0x04: Instruction{Name: "move-wide vA, vB", Format: "12x"},
+	0x05: Instruction{Name: "move-wide/from16 vAA, vBBBB", Format: "22x"},
+	0x06: Instruction{Name: "move-wide/16 vAAAA, vBBBB", Format: "32x"},
+	0x07: Instruction{Name: "move-object vA, vB", Format: "12x"},
+	0x08: Instruction{Name: "move-object/from16 vAA, vBBBB", Format: "22x"},
+	0x09: Instruction{Name: "move-object/16 vAAAA, vBBBB", Format: "32x"},
+	0x0a: Instruction{Name: "move-result vAA", Format: "11x"},
+	0x0b: Instruction{Name: "move-result-wide vAA", Format: "11x"},
+	0x0c: Instruction{Name: "move-result-object vAA", Format: "11x"},
+	0x0d: Instruction{Name: "move-exception vAA", Format: "11x"},
+	0x0e: Instruction{Name: "return-void", Format: "10x"},
+	0x0f: Instruction{Name: "return vAA", Format: "11x"},
+	0x10: Instruction{Name: "return-wide vAA", Format: "11x"},
+	0x11: Instruction{Name: "return-object vAA", Format: "11x"},
+	0x12: Instruction{Name: "const/4 vA, #+B", Format: "11n"},
+	0x13: Instruction{Name: "const/16 vAA, #+BBBB", Format: "21s"},
+	0x14: Instruction{Name: "const vAA, #+BBBBBBBB", Format: "31i"},
+	0x15: Instruction{Name: "const/high16 vAA, #+BBBB0000", Format: "21h"},
+	0x16: Instruction{Name: "const-wide/16 vAA, #+BBBB", Format: "21s"},
+	0x17: Instruction{Name: "const-wide/32 vAA, #+BBBBBBBB", Format: "31i"},
+	0x18: Instruction{Name: "const-wide vAA, #+BBBBBBBBBBBBBBBB", Format: "51l"},
+	0x19: Instruction{Name: "const-wide/high16 vAA, #+BBBB000000000000", Format: "21h"},
+	0x1a: Instruction{Name: "const-string vAA, string@BBBB", Format: "21c"},
+	0x1b: Instruction{Name: "const-string/jumbo vAA, string@BBBBBBBB", Format: "31c"},
+	0x1c: Instruction{Name: "const-class vAA, type@BBBB", Format: "21c"},
+	0x1d: Instruction{Name: "monitor-enter vAA", Format: "11x"},
+	0x1e: Instruction{Name: "monitor-exit vAA", Format: "11x"},
+	0x1f: Instruction{Name: "check-cast vAA, type@BBBB", Format: "21c"},
+	0x20: Instruction{Name: "instance-of vA, vB, type@CCCC", Format: "22c"},
+	0x21: Instruction{Name: "array-length vA, vB", Format: "12x"},
+	0x22: Instruction{Name: "new-instance vAA, type@BBBB", Format: "21c"},
+	0x23: Instruction{Name: "new-array vA, vB, type@CCCC", Format: "22c"},
+	0x24: Instruction{Name: "filled-new-array {vC, vD, vE, vF, vG}, type@BBBB", Format: "35c"},
+	0x25: Instruction{Name: "filled-new-array/range {vCCCC .. vNNNN}, type@BBBB", Format: "3rc"},
+	0x26: Instruction{Name: "fill-array-data vAA, +BBBBBBBB", Format: "31t"},
+	0x27: Instruction{Name: "throw vAA", Format: "11x"},
+	0x28: Instruction{Name: "goto +AA", Format: "10t"},
+	0x29: Instruction{Name: "goto/16 +AAAA", Format: "20t"},
+	0x2a: Instruction{Name: "goto/32 +AAAAAAAA", Format: "30t"},
+	0x2b: Instruction{Name: "packed-switch vAA, +BBBBBBBB", Format: "31t"},
+	0x2c: Instruction{Name: "sparse-switch vAA, +BBBBBBBB", Format: "31t"},
+	0x2d: Instruction{Name: "cmpl-float vAA, vBB, vCC", Format: "23x"},
+	0x2e: Instruction{Name: "cmpg-float vAA, vBB, vCC", Format: "23x"},
+	0x2f: Instruction{Name: "cmpl-double vAA, vBB, vCC", Format: "23x"},
+	0x30: Instruction{Name: "cmpg-double vAA, vBB, vCC", Format: "23x"},
+	0x31: Instruction{Name: "cmp-long vAA, vBB, vCC", Format: "23x"},
+	0x32: Instruction{Name: "if-eq vA, vB, +CCCC", Format: "22t"},
+	0x33: Instruction{Name: "if-ne vA, vB, +CCCC", Format: "22t"},
+	0x34: Instruction{Name: "if-lt vA, vB, +CCCC", Format: "22t"},
+	0x35: Instruction{Name: "if-ge vA, vB, +CCCC", Format: "22t"},
+	0x36: Instruction{Name: "if-gt vA, vB, +CCCC", Format: "22t"},
+	0x37: Instruction{Name: "if-le vA, vB, +CCCC", Format: "22t"},
+	0x38: Instruction{Name: "if-eqz vAA, +BBBB", Format: "21t"},
+	0x39: Instruction{Name: "if-nez vAA, +BBBB", Format: "21t"},
+	0x3a: Instruction{Name: "if-ltz vAA, +BBBB", Format: "21t"},
+	0x3b: Instruction{Name: "if-gez vAA, +BBBB", Format: "21t"},
+	0x3c: Instruction{Name: "if-gtz vAA, +BBBB", Format: "21t"},
+	0x3d: Instruction{Name: "if-lez vAA, +BBBB", Format: "21t"},
+	0x44: Instruction{Name: "aget vAA, vBB, vCC", Format: "23x"},
+	0x45: Instruction{Name: "aget-wide vAA, vBB, vCC", Format: "23x"},
+	0x46: Instruction{Name: "aget-object vAA, vBB, vCC", Format: "23x"},
+	0x47: Instruction{Name: "aget-boolean vAA, vBB, vCC", Format: "23x"},
+	0x48: Instruction{Name: "aget-byte vAA, vBB, vCC", Format: "23x"},
+	0x49: Instruction{Name: "aget-char vAA, vBB, vCC", Format: "23x"},
+	0x4a: Instruction{Name: "aget-short vAA, vBB, vCC", Format: "23x"},
+	0x4b: Instruction{Name: "aput vAA, vBB, vCC", Format: "23x"},
+	0x4c: Instruction{Name: "aput-wide vAA, vBB, vCC", Format: "23x"},
+	0x4d: Instruction{Name: "aput-object vAA, vBB, vCC", Format: "23x"},
+	0x4e: Instruction{Name: "aput-boolean vAA, vBB, vCC", Format: "23x"},
+	0x4f: Instruction{Name: "aput-byte vAA, vBB, vCC", Format: "23x"},
+	0x50: Instruction{Name: "aput-char vAA, vBB, vCC", Format: "23x"},
+	0x51: Instruction{Name: "aput-short vAA, vBB, vCC", Format: "23x"},
+	0x52: Instruction{Name: "iget vA, vB, field@CCCC", Format: "22c"},
+	0x53: Instruction{Name: "iget-wide vA, vB, field@CCCC", Format: "22c"},
+	0x54: Instruction{Name: "iget-object vA, vB, field@CCCC", Format: "22c"},
+	0x55: Instruction{Name: "iget-boolean vA, vB, field@CCCC", Format: "22c"},
+	0x56: Instruction{Name: "iget-byte vA, vB, field@CCCC", Format: "22c"},
+	0x57: Instruction{Name: "iget-char vA, vB, field@CCCC", Format: "22c"},
+	0x58: Instruction{Name: "iget-short vA, vB, field@CCCC", Format: "22c"},
+	0x59: Instruction{Name: "iput vA, vB, field@CCCC", Format: "22c"},
+	0x5a: Instruction{Name: "iput-wide vA, vB, field@CCCC", Format: "22c"},
+	0x5b: Instruction{Name: "iput-object vA, vB, field@CCCC", Format: "22c"},
+	0x5c: Instruction{Name: "iput-boolean vA, vB, field@CCCC", Format: "22c"},
+	0x5d: Instruction{Name: "iput-byte vA, vB, field@CCCC", Format: "22c"},
+	0x5e: Instruction{Name: "iput-char vA, vB, field@CCCC", Format: "22c"},
+	0x5f: Instruction{Name: "iput-short vA, vB, field@CCCC", Format: "22c"},
+	0x60: Instruction{Name: "sget vAA, field@BBBB", Format: "21c"},
+	0x61: Instruction{Name: "sget-wide vAA, field@BBBB", Format: "21c"},
+	0x62: Instruction{Name: "sget-object vAA, field@BBBB", Format: "21c"},
+	0x63: Instruction{Name: "sget-boolean vAA, field@BBBB", Format: "21c"},
+	0x64: Instruction{Name: "sget-byte vAA, field@BBBB", Format: "21c"},
+	0x65: Instruction{Name: "sget-char vAA, field@BBBB", Format: "21c"},
+	0x66: Instruction{Name: "sget-short vAA, field@BBBB", Format: "21c"},
+	0x67: Instruction{Name: "sput vAA, field@BBBB", Format: "21c"},
+	0x68: Instruction{Name: "sput-wide vAA, field@BBBB", Format: "21c"},
+	0x69: Instruction{Name: "sput-object vAA, field@BBBB", Format: "21c"},
+	0x6a: Instruction{Name: "sput-boolean vAA, field@BBBB", Format: "21c"},
+	0x6b: Instruction{Name: "sput-byte vAA, field@BBBB", Format: "21c"},
+	0x6c: Instruction{Name: "sput-char vAA, field@BBBB", Format: "21c"},
+	0x6d: Instruction{Name: "sput-short vAA, field@BBBB", Format: "21c"},
+	0x6e: Instruction{Name: "invoke-virtual {vC, vD, vE, vF, vG}, meth@BBBB", Format: "35c"},
+	0x6f: Instruction{Name: "invoke-super {vC, vD, vE, vF, vG}, meth@BBBB", Format: "35c"},
+	0x70: Instruction{Name: "invoke-direct {vC, vD, vE, vF, vG}, meth@BBBB", Format: "35c"},
+	0x71: Instruction{Name: "invoke-static {vC, vD, vE, vF, vG}, meth@BBBB", Format: "35c"},
+	0x72: Instruction{Name: "invoke-interface {vC, vD, vE, vF, vG}, meth@BBBB", Format: "35c"},
+	0x74: Instruction{Name: "invoke-virtual/range {vCCCC .. vNNNN}, meth@BBBB", Format: "3rc"},
+	0x75: Instruction{Name: "invoke-super/range {vCCCC .. vNNNN}, meth@BBBB", Format: "3rc"},
+	0x76: Instruction{Name: "invoke-direct/range {vCCCC .. vNNNN}, meth@BBBB", Format: "3rc"},
+	0x77: Instruction{Name: "invoke-static/range {vCCCC .. vNNNN}, meth@BBBB", Format: "3rc"},
+	0x78: Instruction{Name: "invoke-interface/range {vCCCC .. vNNNN}, meth@BBBB", Format: "3rc"},
+	0x7b: Instruction{Name: "neg-int vA, vB", Format: "12x"},
+	0x7c: Instruction{Name: "not-int vA, vB", Format: "12x"},
+	0x7d: Instruction{Name: "neg-long vA, vB", Format: "12x"},
+	0x7e: Instruction{Name: "not-long vA, vB", Format: "12x"},
+	0x7f: Instruction{Name: "neg-float vA, vB", Format: "12x"},
+	0x80: Instruction{Name: "neg-double vA, vB", Format: "12x"},
+	0x81: Instruction{Name: "int-to-long vA, vB", Format: "12x"},
+	0x82: Instruction{Name: "int-to-float vA, vB", Format: "12x"},
+	0x83: Instruction{Name: "int-to-double vA, vB", Format: "12x"},
+	0x84: Instruction{Name: "long-to-int vA, vB", Format: "12x"},
+	0x85: Instruction{Name: "long-to-float vA, vB", Format: "12x"},
+	0x86: Instruction{Name: "long-to-double vA, vB", Format: "12x"},
+	0x87: Instruction{Name: "float-to-int vA, vB", Format: "12x"},
+	0x88: Instruction{Name: "float-to-long vA, vB", Format: "12x"},
+	0x89: Instruction{Name: "float-to-double vA, vB", Format: "12x"},
+	0x8a: Instruction{Name: "double-to-int vA, vB", Format: "12x"},
+	0x8b: Instruction{Name: "double-to-long vA, vB", Format: "12x"},
+	0x8c: Instruction{Name: "double-to-float vA, vB", Format: "12x"},
+	0x8d: Instruction{Name: "int-to-byte vA, vB", Format: "12x"},
+	0x8e: Instruction{Name: "int-to-char vA, vB", Format: "12x"},
+	0x8f: Instruction{Name: "int-to-short vA, vB", Format: "12x"},
+	0x90: Instruction{Name: "add-int vAA, vBB, vCC", Format: "23x"},
+	0x91: Instruction{Name: "sub-int vAA, vBB, vCC", Format: "23x"},
+	0x92: Instruction{Name: "mul-int vAA, vBB, vCC", Format: "23x"},
+	0x93: Instruction{Name: "div-int vAA, vBB, vCC", Format: "23x"},
+	0x94: Instruction{Name: "rem-int vAA, vBB, vCC", Format: "23x"},
+	0x95: Instruction{Name: "and-int vAA, vBB, vCC", Format: "23x"},
+	0x96: Instruction{Name: "or-int vAA, vBB, vCC", Format: "23x"},
+	0x97: Instruction{Name: "xor-int vAA, vBB, vCC", Format: "23x"},
+	0x98: Instruction{Name: "shl-int vAA, vBB, vCC", Format: "23x"},
+	0x99: Instruction{Name: "shr-int vAA, vBB, vCC", Format: "23x"},
+	0x9a: Instruction{Name: "ushr-int vAA, vBB, vCC", Format: "23x"},
+	0x9b: Instruction{Name: "add-long vAA, vBB, vCC", Format: "23x"},
+	0x9c: Instruction{Name: "sub-long vAA, vBB, vCC", Format: "23x"},
+	0x9d: Instruction{Name: "mul-long vAA, vBB, vCC", Format: "23x"},
+	0x9e: Instruction{Name: "div-long vAA, vBB, vCC", Format: "23x"},
+	0x9f: Instruction{Name: "rem-long vAA, vBB, vCC", Format: "23x"},
+	0xa0: Instruction{Name: "and-long vAA, vBB, vCC", Format: "23x"},
+	0xa1: Instruction{Name: "or-long vAA, vBB, vCC", Format: "23x"},
+	0xa2: Instruction{Name: "xor-long vAA, vBB, vCC", Format: "23x"},
+	0xa3: Instruction{Name: "shl-long vAA, vBB, vCC", Format: "23x"},
+	0xa4: Instruction{Name: "shr-long vAA, vBB, vCC", Format: "23x"},
+	0xa5: Instruction{Name: "ushr-long vAA, vBB, vCC", Format: "23x"},
+	0xa6: Instruction{Name: "add-float vAA, vBB, vCC", Format: "23x"},
+	0xa7: Instruction{Name: "sub-float vAA, vBB, vCC", Format: "23x"},
+	0xa8: Instruction{Name: "mul-float vAA, vBB, vCC", Format: "23x"},
+	0xa9: Instruction{Name: "div-float vAA, vBB, vCC", Format: "23x"},
+	0xaa: Instruction{Name: "rem-float vAA, vBB, vCC", Format: "23x"},
+	0xab: Instruction{Name: "add-double vAA, vBB, vCC", Format: "23x"},
+	0xac: Instruction{Name: "sub-double vAA, vBB, vCC", Format: "23x"},
+	0xad: Instruction{Name: "mul-double vAA, vBB, vCC", Format: "23x"},
+	0xae: Instruction{Name: "div-double vAA, vBB, vCC", Format: "23x"},
+	0xaf: Instruction{Name: "rem-double vAA, vBB, vCC", Format: "23x"},
+	0xb0: Instruction{Name: "add-int/2addr vA, vB", Format: "12x"},
+	0xb1: Instruction{Name: "sub-int/2addr vA, vB", Format: "12x"},
+	0xb2: Instruction{Name: "mul-int/2addr vA, vB", Format: "12x"},
+	0xb3: Instruction{Name: "div-int/2addr vA, vB", Format: "12x"},
+	0xb4: Instruction{Name: "rem-int/2addr vA, vB", Format: "12x"},
+	0xb5: Instruction{Name: "and-int/2addr vA, vB", Format: "12x"},
+	0xb6: Instruction{Name: "or-int/2addr vA, vB", Format: "12x"},
+	0xb7: Instruction{Name: "xor-int/2addr vA, vB", Format: "12x"},
+	0xb8: Instruction{Name: "shl-int/2addr vA, vB", Format: "12x"},
+	0xb9: Instruction{Name: "shr-int/2addr vA, vB", Format: "12x"},
+	0xba: Instruction{Name: "ushr-int/2addr vA, vB", Format: "12x"},
+	0xbb: Instruction{Name: "add-long/2addr vA, vB", Format: "12x"},
+	0xbc: Instruction{Name: "sub-long/2addr vA, vB", Format: "12x"},
+	0xbd: Instruction{Name: "mul-long/2addr vA, vB", Format: "12x"},
+	0xbe: Instruction{Name: "div-long/2addr vA, vB", Format: "12x"},
+	0xbf: Instruction{Name: "rem-long/2addr vA, vB", Format: "12x"},
+	0xc0: Instruction{Name: "and-long/2addr vA, vB", Format: "12x"},
+	0xc1: Instruction{Name: "or-long/2addr vA, vB", Format: "12x"},
+	0xc2: Instruction{Name: "xor-long/2addr vA, vB", Format: "12x"},
+	0xc3: Instruction{Name: "shl-long/2addr vA, vB", Format: "12x"},
+	0xc4: Instruction{Name: "shr-long/2addr vA, vB", Format: "12x"},
+	0xc5: Instruction{Name: "ushr-long/2addr vA, vB", Format: "12x"},
+	0xc6: Instruction{Name: "add-float/2addr vA, vB", Format: "12x"},
+	0xc7: Instruction{Name: "sub-float/2addr vA, vB", Format: "12x"},
+	0xc8: Instruction{Name: "mul-float/2addr vA, vB", Format: "12x"},
+	0xc9: Instruction{Name: "div-float/2addr vA, vB", Format: "12x"},
+	0xca: Instruction{Name: "rem-float/2addr vA, vB", Format: "12x"},
+	0xcb: Instruction{Name: "add-double/2addr vA, vB", Format: "12x"},
+	0xcc: Instruction{Name: "sub-double/2addr vA, vB", Format: "12x"},
+	0xcd: Instruction{Name: "mul-double/2addr vA, vB", Format: "12x"},
+	0xce: Instruction{Name: "div-double/2addr vA, vB", Format: "12x"},
+	0xcf: Instruction{Name: "rem-double/2addr vA, vB", Format: "12x"},
+	0xd0: Instruction{Name: "add-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd1: Instruction{Name: "rsub-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd2: Instruction{Name: "mul-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd3: Instruction{Name: "div-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd4: Instruction{Name: "rem-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd5: Instruction{Name: "and-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd6: Instruction{Name: "or-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd7: Instruction{Name: "xor-int/lit16 vA, vB, #+CCCC", Format: "22s"},
+	0xd8: Instruction{Name: "add-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xd9: Instruction{Name: "rsub-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xda: Instruction{Name: "mul-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xdb: Instruction{Name: "div-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xdc: Instruction{Name: "rem-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xdd: Instruction{Name: "and-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xde: Instruction{Name: "or-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xdf: Instruction{Name: "xor-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xe0: Instruction{Name: "shl-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xe1: Instruction{Name: "shr-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xe2: Instruction{Name: "ushr-int/lit8 vAA, vBB, #+CC", Format: "22b"},
+	0xfa: Instruction{Name: "invoke-polymorphic {vC, vD, vE, vF, vG}, meth@BBBB, proto@HHHH", Format: "45cc"},
+	0xfb: Instruction{Name: "invoke-polymorphic/range {vCCCC .. vNNNN}, meth@BBBB, proto@HHHH", Format: "4rcc"},
+	0xfc: Instruction{Name: "invoke-custom {vC, vD, vE, vF, vG}, call_site@BBBB", Format: "35c"},
+	0xfd: Instruction{Name: "invoke-custom/range {vCCCC .. vNNNN}, call_site@BBBB", Format: "3rc"},
+	0xfe: Instruction{Name: "const-method-handle vAA, method_handle@BBBB", Format: "21c"},
+	0xff: Instruction{Name: "const-method-type vAA, proto@BBBB", Format: "21c"},
 }
 
+// Disassemble writes the method's instructions to stdout.
 func (m *EncodedMethod) Disassemble() error {
-	fmt.Println("*****")
-	fmt.Println(m.CodeOffset)
-
-	offset := int(m.CodeOffset)
-
-	offset += 12
-
-	// size
-	size := int(binary.LittleEndian.Uint32(m.dex.b[offset : offset+4]))
-
-	fmt.Printf("Size: %d\n", size)
-	offset += 4
-
-	// check opcode
-	for offset < int(m.CodeOffset)+16+(size*2) {
-		instruction_code := m.dex.b[offset]
-		if instruction, ok := instructions[instruction_code]; ok {
-			str := fmt.Sprintf("%0.2x %s", instruction_code, instruction.Name)
-
-			offset += 1
-
-			/*
-				const string v5 = "Y"
-				v6 = this.getStateVal()
-				if String.equals(v5, v6) != 0 {
-					return
-				}*/
-
-			if instruction_code == 0x6e || instruction_code == 0x6f || instruction_code == 0x70 || instruction_code == 0x71 {
-				// variable arguments
-				// fmt.Println("%d %d", int(m.dex.b[offset]), (int(m.dex.b[offset]) & 0xF0 >> 4))
-				// fmt.Println("%d args", (4+((int(m.dex.b[offset])&0xF0)<<4)*4)/8)
-				// offset += (4 + (((int(m.dex.b[offset]) & 0xF0) >> 4) * 4)) / 8
-				//fmt.Printf("%x %x\n", offset, m.dex.b[offset+3:offset+5])
-				methodIdx := int(binary.LittleEndian.Uint16(m.dex.b[offset+1 : offset+3]))
-				str += " #" + m.dex.Methods[methodIdx].Name()
-			} else if instruction_code == 0x72 || instruction_code == 0x73 || instruction_code == 0x74 {
-				// variable arguments
-				// fmt.Println("%d %d", int(m.dex.b[offset]), (int(m.dex.b[offset]) & 0xF0 >> 4))
-				// fmt.Println("%d args", (4+((int(m.dex.b[offset])&0xF0)<<4)*4)/8)
-				// offset += (4 + (((int(m.dex.b[offset]) & 0xF0) >> 4) * 4)) / 8
-				//fmt.Printf("%x %x\n", offset, m.dex.b[offset+3:offset+5])
-				methodIdx := int(binary.LittleEndian.Uint16(m.dex.b[offset+1 : offset+3]))
-				str += " #" + m.dex.Methods[methodIdx].Name()
-			} else if instruction_code == 0x22 {
-				register := int(m.dex.b[offset])
-				typeIdx := int(binary.LittleEndian.Uint16(m.dex.b[offset+1 : offset+3]))
-				str += fmt.Sprintf(" # %d=%s", register, m.dex.Types[typeIdx].String())
-			} else if instruction_code == 0x39 {
-				register := int(m.dex.b[offset])
-				str += fmt.Sprintf(" # Register: %d", register)
-			} else if instruction_code == 0x07 {
-				dest := int(m.dex.b[offset] & 0x0F)
-				src := int(m.dex.b[offset]&0xF0) >> 4
-				str += fmt.Sprintf(" # Register: %d = %d ", dest, src)
-			} else if instruction_code == 0x12 {
-				register := int(m.dex.b[offset] & 0x0F)
-				value := int(m.dex.b[offset]&0xF0) >> 4
-				str += fmt.Sprintf(" # Register: %d = %d ", register, value)
-			} else if instruction_code == 0x0a || instruction_code == 0xb || instruction_code == 0x0c {
-				// vAA
-				register := int(m.dex.b[offset])
-				str += fmt.Sprintf(" # Register: %d", register)
-			} else if instruction_code == 0x1a {
-				register := int(m.dex.b[offset])
-				str += fmt.Sprintf(" # Register: %d", register)
-				stringIdx := int(binary.LittleEndian.Uint16(m.dex.b[offset+1 : offset+3]))
-				str += fmt.Sprintf(" # %d=%s", register, m.dex.Strings[stringIdx])
-			} else if instruction.Length != -1 {
-			} else {
-				fmt.Printf("Invalid opcode %x\n", instruction_code)
-				break
-			}
-			offset += instruction.Length
-			fmt.Println(str)
-			continue
-		}
-		break
-	}
-
-	fmt.Println("*****")
-	return nil
+	return m.DisassembleTo(os.Stdout, DisassembleOptions{})
 }
 
 type ClassDataItem struct {
@@ -553,7 +697,7 @@ func (m *MethodIdItem) Class() string {
 }
 
 func (m *MethodIdItem) Name() string {
-	return m.dex.Strings[m.NameIdx]
+	return m.dex.string(m.NameIdx)
 }
 
 func (m *MethodIdItem) String() string {
@@ -567,68 +711,331 @@ type ProtoIdItem struct {
 	ParametersOffset uint32 `pack:"uint"`
 }
 
+// ReturnType returns the return type of the prototype as a java name, eg.
+// boolean or void, or an empty string when it is out of range.
+func (m *ProtoIdItem) ReturnType() string {
+	t, err := m.dex.TypeAt(m.ReturnTypeIdx)
+	if err != nil {
+		return ""
+	}
+	return t.JavaName()
+}
+
+// Parameters returns the parameter types of the prototype as java names.
+func (m *ProtoIdItem) Parameters() ([]string, error) {
+	params, err := m.dex.readTypeList(m.ParametersOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(params))
+	for i, typeIdx := range params {
+		if int(typeIdx) >= len(m.dex.Types) {
+			return nil, &IndexError{Kind: "type", Index: uint32(typeIdx), Max: len(m.dex.Types)}
+		}
+		names[i] = m.dex.Types[typeIdx].JavaName()
+	}
+	return names, nil
+}
+
+// PrototypeSignatures returns every prototype in the pool as
+// "(parameters) return type" with java names, eg.
+// "(java.lang.String, int) void".
+func (d *DEX) PrototypeSignatures() []string {
+	signatures := make([]string, len(d.Prototypes))
+	for i := range d.Prototypes {
+		params, err := d.Prototypes[i].Parameters()
+		if err != nil {
+			signatures[i] = fmt.Sprintf("<%s>", err)
+			continue
+		}
+
+		ret, err := d.TypeAt(d.Prototypes[i].ReturnTypeIdx)
+		if err != nil {
+			signatures[i] = fmt.Sprintf("<%s>", err)
+			continue
+		}
+		signatures[i] = fmt.Sprintf("(%s) %s", strings.Join(params, ", "), ret.JavaName())
+	}
+	return signatures
+}
+
 func (m *ProtoIdItem) String() string {
-	return fmt.Sprintf("%s(%d) %s %d", m.dex.Strings[m.ShortyIdx], m.ShortyIdx, m.dex.Types[m.ReturnTypeIdx].String(), m.ParametersOffset)
+	return fmt.Sprintf("%s(%d) %s %d", m.dex.string(m.ShortyIdx), m.ShortyIdx, m.dex.Types[m.ReturnTypeIdx].String(), m.ParametersOffset)
 }
 
+// Shorty returns the short form descriptor of the prototype, eg. "VLJ" for
+// void f(Object, long). The return type comes first and all references
+// are L, which is enough to size the argument registers.
+func (d *DEX) Shorty(protoIdx uint16) (string, error) {
+	if int(protoIdx) >= len(d.Prototypes) {
+		return "", &IndexError{Kind: "proto", Index: uint32(protoIdx), Max: len(d.Prototypes)}
+	}
+
+	shorty, err := d.StringAt(d.Prototypes[protoIdx].ShortyIdx)
+	if err != nil {
+		return "", err
+	}
+
+	if shorty == "" {
+		return "", fmt.Errorf("Invalid empty shorty of proto %d", protoIdx)
+	}
+	return shorty, nil
+}
+
+// readTypeList reads the type_list at off, an offset of 0 is an empty
+// list.
+func (d *DEX) readTypeList(off uint32) ([]uint16, error) {
+	if off == 0 {
+		return nil, nil
+	}
+
+	if uint64(off)+4 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid type list offset %x", off)
+	}
+
+	size := binary.LittleEndian.Uint32(d.b[off:])
+	if uint64(off)+4+uint64(size)*2 > uint64(len(d.b)) {
+		return nil, fmt.Errorf("Invalid type list size %d at %x", size, off)
+	}
+
+	types := make([]uint16, size)
+	for i := range types {
+		types[i] = binary.LittleEndian.Uint16(d.b[off+4+uint32(i)*2:])
+	}
+	return types, nil
+}
+
+// DEX is a parsed dex file. Once parsed it may be read from multiple
+// goroutines, the caches filled on first use are guarded.
 type DEX struct {
-	b          []byte
-	header     Header
+	b      []byte
+	header Header
+	// Strings is the decoded string pool. It is only filled by
+	// DecodeStrings or ParseOptions.EagerStrings, use StringAt to decode
+	// single strings on demand.
 	Strings    []string
 	Types      []TypeId
 	Prototypes []ProtoIdItem
 	Fields     []FieldIdItem
 	Methods    []MethodIdItem
 	Classes    []ClassDefItem
+	// Map is the map_list, describing every section of the file
+	Map []MapItem
+
+	// stringsMu guards lazyStrings and lazyDecoded, cacheMu guards
+	// javaNames, stringIndex, methodIndex and the decoded code of methods
+	stringsMu sync.Mutex
+	cacheMu   sync.Mutex
+	// interned java names, keyed by descriptor string index
+	javaNames map[uint32]string
+	// strings decoded on first use by StringAt
+	lazyStrings []string
+	lazyDecoded []bool
+	// reverse of the string pool, built on first use
+	stringIndex map[string]int
+	// method indices keyed by class->name(params)return, built on first
+	// use by FindMethod
+	methodIndex map[string]int
+	// fields defined in the class data, keyed by field index
+	definedFields map[uint32]*EncodedField
+	// decoders of undefined opcodes, see RegisterOpcodeHandler
+	opcodeHandlers map[byte]OperandDecoder
 }
 
 func (d *DEX) readHeader() error {
+	if len(d.b) < 0x70 {
+		return fmt.Errorf("Invalid dex, too small for header: %d bytes", len(d.b))
+	}
+
 	_, err := Unpack(d.b, &d.header)
 	return err
 }
 
 func (d *DEX) readFields() error {
+	if err := d.checkSection("field ids", d.header.FieldsOffset, d.header.FieldsSize, 0x8); err != nil {
+		return err
+	}
+
 	d.Fields = make([]FieldIdItem, d.header.FieldsSize)
 	for i := 0; i < int(d.header.FieldsSize); i++ {
-		s := uint32(d.header.FieldsOffset) + uint32(0x8*i)
+		s := uint64(d.header.FieldsOffset) + uint64(0x8*i)
 		field_id_item := FieldIdItem{dex: d}
 		if _, err := Unpack(d.b[s:], &field_id_item); err != nil {
 			return err
 		}
 
+		if int(field_id_item.ClassIdx) >= len(d.Types) || int(field_id_item.TypeIdx) >= len(d.Types) || int64(field_id_item.NameIdx) >= int64(d.StringCount()) {
+			return fmt.Errorf("Invalid field id %d", i)
+		}
+
 		d.Fields[i] = field_id_item
 	}
 	return nil
 }
 
 func (d *DEX) readMethods() error {
+	if err := d.checkSection("method ids", d.header.MethodIdsOffset, d.header.MethodIdsSize, 0x8); err != nil {
+		return err
+	}
+
+	d.methodIndex = nil
 	d.Methods = make([]MethodIdItem, d.header.MethodIdsSize)
 	for i := 0; i < int(d.header.MethodIdsSize); i++ {
-		s := uint32(d.header.MethodIdsOffset) + uint32(0x8*i)
+		s := uint64(d.header.MethodIdsOffset) + uint64(0x8*i)
 		method_id_item := MethodIdItem{dex: d}
 		if _, err := Unpack(d.b[s:], &method_id_item); err != nil {
 			return err
 		}
 
+		if int(method_id_item.ClassIdx) >= len(d.Types) || int(method_id_item.ProtoIdx) >= len(d.Prototypes) || int64(method_id_item.NameIdx) >= int64(d.StringCount()) {
+			return fmt.Errorf("Invalid method id %d", i)
+		}
+
 		d.Methods[i] = method_id_item
 	}
 	return nil
 }
 
+// descriptor returns the prototype as a method descriptor, eg.
+// "(Landroid/os/Bundle;)V".
+func (m *ProtoIdItem) descriptor() (string, error) {
+	params, err := m.dex.readTypeList(m.ParametersOffset)
+	if err != nil {
+		return "", err
+	}
+
+	if int(m.ReturnTypeIdx) >= len(m.dex.Types) {
+		return "", &IndexError{Kind: "type", Index: m.ReturnTypeIdx, Max: len(m.dex.Types)}
+	}
+
+	descriptor := "("
+	for _, typeIdx := range params {
+		if int(typeIdx) >= len(m.dex.Types) {
+			return "", &IndexError{Kind: "type", Index: uint32(typeIdx), Max: len(m.dex.Types)}
+		}
+		descriptor += m.dex.Types[typeIdx].String()
+	}
+	return descriptor + ")" + m.dex.Types[m.ReturnTypeIdx].String(), nil
+}
+
+// indexMethods builds the method index, which decodes the names of all
+// methods. Methods with an invalid prototype are left out.
+func (d *DEX) indexMethods() {
+	protos := make([]string, len(d.Prototypes))
+	valid := make([]bool, len(d.Prototypes))
+	for i := range d.Prototypes {
+		descriptor, err := d.Prototypes[i].descriptor()
+		protos[i], valid[i] = descriptor, err == nil
+	}
+
+	d.methodIndex = make(map[string]int, len(d.Methods))
+	for i, m := range d.Methods {
+		if valid[m.ProtoIdx] {
+			d.methodIndex[m.Class()+"->"+m.Name()+protos[m.ProtoIdx]] = i
+		}
+	}
+}
+
+// FindMethod returns the index of the method id of class, eg.
+// "Landroid/app/Activity;", with the given name and signature, eg.
+// "(Landroid/os/Bundle;)V".
+func (d *DEX) FindMethod(class, name, signature string) (int, bool) {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+
+	if d.methodIndex == nil {
+		d.indexMethods()
+	}
+
+	idx, ok := d.methodIndex[class+"->"+name+signature]
+	return idx, ok
+}
+
 type TypeId struct {
 	dex           *DEX   `pack:"-"`
 	DescriptorIdx uint32 `pack:"uint"`
 }
 
 func (t *TypeId) String() string {
-	return fmt.Sprintf("%s", t.dex.Strings[t.DescriptorIdx])
+	return t.dex.string(t.DescriptorIdx)
+}
+
+// JavaName returns the type in Java source notation, eg. java.lang.String
+// or int[]. Results are interned on the DEX, so repeated lookups of the
+// same type share a single string.
+func (t *TypeId) JavaName() string {
+	t.dex.cacheMu.Lock()
+	name, ok := t.dex.javaNames[t.DescriptorIdx]
+	t.dex.cacheMu.Unlock()
+	if ok {
+		return name
+	}
+
+	name = javaName(t.dex.string(t.DescriptorIdx))
+
+	t.dex.cacheMu.Lock()
+	defer t.dex.cacheMu.Unlock()
+
+	if interned, ok := t.dex.javaNames[t.DescriptorIdx]; ok {
+		return interned
+	}
+
+	if t.dex.javaNames == nil {
+		t.dex.javaNames = map[uint32]string{}
+	}
+
+	t.dex.javaNames[t.DescriptorIdx] = name
+	return name
+}
+
+func javaName(descriptor string) string {
+	dims := 0
+	for dims < len(descriptor) && descriptor[dims] == '[' {
+		dims++
+	}
+
+	name := descriptor[dims:]
+	switch name {
+	case "V":
+		name = "void"
+	case "Z":
+		name = "boolean"
+	case "B":
+		name = "byte"
+	case "S":
+		name = "short"
+	case "C":
+		name = "char"
+	case "I":
+		name = "int"
+	case "J":
+		name = "long"
+	case "F":
+		name = "float"
+	case "D":
+		name = "double"
+	default:
+		if len(name) > 1 && name[0] == 'L' && name[len(name)-1] == ';' {
+			name = strings.Replace(name[1:len(name)-1], "/", ".", -1)
+		}
+	}
+
+	for i := 0; i < dims; i++ {
+		name += "[]"
+	}
+	return name
 }
 
 func (d *DEX) readTypes() error {
+	if err := d.checkSection("type ids", d.header.TypeIdsOffset, d.header.TypeIdsSize, 4); err != nil {
+		return err
+	}
+
 	d.Types = make([]TypeId, d.header.TypeIdsSize)
 	for i := 0; i < int(d.header.TypeIdsSize); i++ {
 		typeid := TypeId{dex: d}
-		if _, err := Unpack(d.b[d.header.TypeIdsOffset+uint32(4*i):], &typeid); err != nil {
+		if _, err := Unpack(d.b[uint64(d.header.TypeIdsOffset)+uint64(4*i):], &typeid); err != nil {
 			return err
 		}
 
@@ -638,70 +1045,332 @@ func (d *DEX) readTypes() error {
 }
 
 func (d *DEX) readStrings() error {
-	d.Strings = make([]string, d.header.StringIdsSize)
+	if err := d.checkSection("string ids", d.header.StringIdsOffset, d.header.StringIdsSize, 4); err != nil {
+		return err
+	}
+
+	d.Strings = nil
+	d.lazyStrings = make([]string, d.header.StringIdsSize)
+	d.lazyDecoded = make([]bool, d.header.StringIdsSize)
+	return nil
+}
 
-	var data = d.b[d.header.StringIdsOffset:]
-	for i := 0; i < int(d.header.StringIdsSize); i++ {
-		var offset = i * 4
-		string_data_offset := binary.LittleEndian.Uint32(data[offset : offset+4])
-		s, _ := str(d.b[string_data_offset:])
-		d.Strings[i] = s
+// DecodeStrings decodes the whole string pool into Strings.
+func (d *DEX) DecodeStrings() error {
+	pool := make([]string, d.StringCount())
+	for i := range pool {
+		s, err := d.StringAt(uint32(i))
+		if err != nil {
+			return err
+		}
+		pool[i] = s
 	}
 
+	d.Strings = pool
 	return nil
 }
 
+// decodeString decodes the string_data_item of string id idx.
+func (d *DEX) decodeString(idx uint32) (string, error) {
+	string_data_offset := binary.LittleEndian.Uint32(d.b[d.header.StringIdsOffset+idx*4:])
+	if int(string_data_offset) >= len(d.b) {
+		return "", fmt.Errorf("Invalid string data offset %x", string_data_offset)
+	}
+
+	s, _, err := str(d.b[string_data_offset:])
+	return s, err
+}
+
+// string returns string idx, or an empty string when it is out of range
+// or cannot be decoded.
+func (d *DEX) string(idx uint32) string {
+	s, _ := d.StringAt(idx)
+	return s
+}
+
+// StringIndex returns the index of s in the string pool.
+func (d *DEX) StringIndex(s string) (int, bool) {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+
+	if d.stringIndex == nil {
+		count := d.StringCount()
+		d.stringIndex = make(map[string]int, count)
+		for i := 0; i < count; i++ {
+			v, err := d.StringAt(uint32(i))
+			if err != nil {
+				continue
+			}
+
+			if _, ok := d.stringIndex[v]; !ok {
+				d.stringIndex[v] = i
+			}
+		}
+	}
+
+	idx, ok := d.stringIndex[s]
+	return idx, ok
+}
+
 func (d *DEX) readPrototypes() error {
+	if err := d.checkSection("proto ids", d.header.ProtosOffset, d.header.ProtosSize, 0xc); err != nil {
+		return err
+	}
+
 	d.Prototypes = make([]ProtoIdItem, d.header.ProtosSize)
 	for i := 0; i < int(d.header.ProtosSize); i++ {
-		s := uint32(d.header.ProtosOffset) + uint32(0xc*i)
+		s := uint64(d.header.ProtosOffset) + uint64(0xc*i)
 		proto_id_item := ProtoIdItem{dex: d}
 		if _, err := Unpack(d.b[s:], &proto_id_item); err != nil {
 			return err
 		}
+
+		if int(proto_id_item.ReturnTypeIdx) >= len(d.Types) {
+			return &IndexError{Kind: "type", Index: proto_id_item.ReturnTypeIdx, Max: len(d.Types)}
+		}
 		d.Prototypes[i] = proto_id_item
 	}
 	return nil
 }
 
-func (d *DEX) Dump() {
-	fmt.Println("Types:")
-	for i, t := range d.Types {
-		fmt.Printf("%d %s\n", i, t.String())
-	}
+// MethodRef points at a method defined in the dex and its class.
+type MethodRef struct {
+	Class  *ClassDefItem
+	Method *EncodedMethod
+}
+
+func (r MethodRef) String() string {
+	return r.Method.Method.String()
+}
 
-	fmt.Println("Prototypes:")
-	for _, m := range d.Prototypes {
-		fmt.Println(m.String())
+// EachMethod calls fn for every direct and virtual method of every class,
+// stopping at the first error.
+func (d *DEX) EachMethod(fn func(*ClassDefItem, *EncodedMethod) error) error {
+	for i := range d.Classes {
+		c := &d.Classes[i]
+		for _, methods := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+			for j := range methods {
+				if err := fn(c, &methods[j]); err != nil {
+					return err
+				}
+			}
+		}
 	}
+	return nil
+}
 
-	fmt.Println("Classes:")
-	for _, c := range d.Classes {
-		fmt.Println(c.String())
-		for _, f := range c.ClassData.InstanceFields {
-			fmt.Printf("%s %s %s %s=\n", f.AccessFlags.String(), f.Field.Type(), f.Field.Class(), f.Field.String())
+// FindMethods returns all methods matching pred.
+func (d *DEX) FindMethods(pred func(*ClassDefItem, *EncodedMethod) bool) []MethodRef {
+	refs := []MethodRef{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		if pred(c, m) {
+			refs = append(refs, MethodRef{Class: c, Method: m})
 		}
-		for _, f := range c.ClassData.StaticFields {
-			fmt.Printf("%s %s %s %s=\n", f.AccessFlags.String(), f.Field.Type(), f.Field.Class(), f.Field.String())
+		return nil
+	})
+	return refs
+}
+
+// staticValueString formats the decoded initial value of a static field,
+// strings are quoted. Fields without a value give an empty string.
+func (f *EncodedField) staticValueString() string {
+	ev, ok := f.StaticValue()
+	if !ok {
+		return ""
+	}
+
+	v, err := ev.Decode()
+	if err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+
+	if s, ok := v.(string); ok && ev.ValueType == VALUE_STRING {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// errWriter keeps the first error writing to w and fails every write
+// after it.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+func (d *DEX) Dump() {
+	d.DumpTo(os.Stdout, nil)
+}
+
+// DUMP_SECTIONS are the sections DumpTo knows about.
+var DUMP_SECTIONS = []string{"header", "strings", "types", "prototypes", "fields", "methods", "classes"}
+
+// DumpTo writes the requested sections to w, in the order given. Without
+// sections it writes the types, prototypes and classes, like Dump.
+func (d *DEX) DumpTo(w io.Writer, sections []string) error {
+	if len(sections) == 0 {
+		sections = []string{"types", "prototypes", "classes"}
+	}
+
+	for _, section := range sections {
+		found := false
+		for _, known := range DUMP_SECTIONS {
+			found = found || section == known
 		}
 
-		for _, m := range c.ClassData.DirectMethods {
-			fmt.Printf("%s()\n", m.Method.String())
-			m.Disassemble()
+		if !found {
+			return fmt.Errorf("Unknown section %s", section)
 		}
-		for _, m := range c.ClassData.VirtualMethods {
-			fmt.Printf("%s()\n", m.Method.String())
-			m.Disassemble()
+	}
+
+	ew := &errWriter{w: w}
+	for _, section := range sections {
+		switch section {
+		case "header":
+			fmt.Fprintln(ew, "Header:")
+			fmt.Fprintln(ew, d.header.String())
+		case "strings":
+			fmt.Fprintln(ew, "Strings:")
+			for i := 0; i < d.StringCount(); i++ {
+				s, err := d.StringAt(uint32(i))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(ew, "%d %s\n", i, s)
+			}
+		case "types":
+			fmt.Fprintln(ew, "Types:")
+			for i, t := range d.Types {
+				fmt.Fprintf(ew, "%d %s\n", i, t.String())
+			}
+		case "prototypes":
+			fmt.Fprintln(ew, "Prototypes:")
+			for _, m := range d.Prototypes {
+				fmt.Fprintln(ew, m.String())
+			}
+		case "fields":
+			fmt.Fprintln(ew, "Fields:")
+			for i, f := range d.Fields {
+				fmt.Fprintf(ew, "%d %s %s %s\n", i, f.Class(), f.Type(), f.String())
+			}
+		case "methods":
+			fmt.Fprintln(ew, "Methods:")
+			for i, m := range d.Methods {
+				fmt.Fprintf(ew, "%d %s\n", i, m.String())
+			}
+		case "classes":
+			fmt.Fprintln(ew, "Classes:")
+			for _, c := range d.Classes {
+				fmt.Fprintln(ew, c.String())
+				for _, f := range c.ClassData.InstanceFields {
+					fmt.Fprintf(ew, "%s %s %s %s=\n", f.AccessFlags.String(), f.Field.Type(), f.Field.Class(), f.Field.String())
+				}
+				for _, f := range c.ClassData.StaticFields {
+					fmt.Fprintf(ew, "%s %s %s %s=%s\n", f.AccessFlags.String(), f.Field.Type(), f.Field.Class(), f.Field.String(), f.staticValueString())
+				}
+
+				for _, m := range c.ClassData.DirectMethods {
+					fmt.Fprintf(ew, "%s()\n", m.Method.String())
+					if err := m.DisassembleTo(ew, DisassembleOptions{}); err != nil {
+						return err
+					}
+				}
+				for _, m := range c.ClassData.VirtualMethods {
+					fmt.Fprintf(ew, "%s()\n", m.Method.String())
+					if err := m.DisassembleTo(ew, DisassembleOptions{}); err != nil {
+						return err
+					}
+				}
+			}
 		}
 
+		if ew.err != nil {
+			return ew.err
+		}
 	}
+	return nil
 }
 
 func (dex *DEX) Parse() error {
+	if err := dex.readIds(); err != nil {
+		return err
+	}
+
+	if err := dex.checkSection("class defs", dex.header.ClassDefsOffset, dex.header.ClassDefsSize, 32); err != nil {
+		return err
+	}
+
+	dex.definedFields = nil
+	dex.Classes = make([]ClassDefItem, dex.header.ClassDefsSize)
+	for i := 0; i < int(dex.header.ClassDefsSize); i++ {
+		class, err := dex.readClass(dex.header.ClassDefsOffset+uint32(32*i), i)
+		if err != nil {
+			return err
+		}
+		dex.Classes[i] = class
+	}
+
+	return nil
+}
+
+// defineFields records the fields defined in a class for DefinedField.
+func (d *DEX) defineFields(fields []EncodedField) {
+	if d.definedFields == nil {
+		d.definedFields = map[uint32]*EncodedField{}
+	}
+
+	for i := range fields {
+		d.definedFields[fields[i].FieldIdx] = &fields[i]
+	}
+}
+
+// DefinedField returns the definition of field id fieldIdx, with its access
+// flags and initial value, when the field is defined by a class in this
+// dex.
+func (d *DEX) DefinedField(fieldIdx int) (*EncodedField, bool) {
+	if fieldIdx < 0 || fieldIdx >= len(d.Fields) {
+		return nil, false
+	}
+
+	f, ok := d.definedFields[uint32(fieldIdx)]
+	return f, ok
+}
+
+// checkSection fails when count items of size bytes at off do not fit in
+// the file. The sizes come from the header, so they are computed in 64 bits
+// to not wrap around.
+func (d *DEX) checkSection(name string, off uint32, count uint32, size uint64) error {
+	// empty sections should have a zero offset, but it is never read
+	if count == 0 {
+		return nil
+	}
+
+	if uint64(off)+uint64(count)*size > uint64(len(d.b)) {
+		return fmt.Errorf("Invalid %s section, %d items at %x exceed the file", name, count, off)
+	}
+	return nil
+}
+
+// readIds parses the header and the id pools, everything but the class
+// definitions.
+func (dex *DEX) readIds() error {
 	if err := dex.readHeader(); err != nil {
 		return err
 	}
 
+	if err := dex.readMapList(); err != nil {
+		return err
+	}
+
 	if err := dex.readStrings(); err != nil {
 		return err
 	}
@@ -722,174 +1391,301 @@ func (dex *DEX) Parse() error {
 		return err
 	}
 
-	b := dex.b
-	var err error
-	header := dex.header
+	return nil
+}
 
-	_ = err
+// readClass parses the class_def_item at s, i is the index the class
+// will have in Classes. Invalid class data or static values fail it.
+func (dex *DEX) readClass(s uint32, i int) (ClassDefItem, error) {
+	b := dex.b
 
-	dex.Classes = make([]ClassDefItem, header.ClassDefsSize)
-	for i := 0; i < int(header.ClassDefsSize); i++ {
-		s := uint32(header.ClassDefsOffset) + uint32(32*i)
+	class_def_item := ClassDefItem{dex: dex, offset: s}
 
-		class_def_item := ClassDefItem{dex: dex}
+	RegisterPack("classdata", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		// get class data offset
+		var offset uint32
+		length, err := packs["uint"](data, reflect.ValueOf(&offset).Elem())
 
-		RegisterPack("classdata", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			// get class data offset
-			var offset uint32
-			length, err := packs["uint"](data, reflect.ValueOf(&offset).Elem())
+		if offset == 0 {
+			return length, err
+		}
 
-			if offset == 0 {
-				return length, err
-			}
+		if offset >= uint32(len(b)) {
+			return length, fmt.Errorf("Invalid class data offset %x", offset)
+		}
 
-			// actually should use val
-			_, _ = Unpack(b[offset:], &class_def_item.ClassData)
+		// actually should use val
+		if _, err := Unpack(b[offset:], &class_def_item.ClassData); err != nil {
 			return length, err
-		}))
-
-		RegisterPack("staticfields", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			class_def_item.ClassData.StaticFields = make([]EncodedField, class_def_item.ClassData.StaticFieldSize)
-
-			offset := 0
-			field_idx := uint64(0)
-			for j := uint64(0); j < class_def_item.ClassData.StaticFieldSize; j++ {
-				ef := EncodedField{dex: dex}
-				length, _ := Unpack(data[offset:], &ef)
-				field_idx += uint64(ef.FieldIdxDiff)
-				ef.Field = dex.Fields[field_idx]
-				offset += length
-				class_def_item.ClassData.StaticFields[j] = ef
+		}
+		return length, err
+	}))
+
+	RegisterPack("staticfields", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		class_def_item.ClassData.StaticFields = make([]EncodedField, class_def_item.ClassData.StaticFieldSize)
+
+		offset := 0
+		field_idx := uint64(0)
+		for j := uint64(0); j < class_def_item.ClassData.StaticFieldSize; j++ {
+			ef := EncodedField{dex: dex, classIdx: i}
+			length, err := Unpack(data[offset:], &ef)
+			if err != nil {
+				return uint(offset), err
 			}
 
-			return uint(offset), nil
-		}))
-
-		RegisterPack("instancefields", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			class_def_item.ClassData.InstanceFields = make([]EncodedField, class_def_item.ClassData.InstanceFieldSize)
-			offset := 0
-			field_idx := uint64(0)
-			for j := uint64(0); j < class_def_item.ClassData.InstanceFieldSize; j++ {
-				ef := EncodedField{dex: dex}
-				length, _ := Unpack(data[offset:], &ef)
-				field_idx += uint64(ef.FieldIdxDiff)
-				ef.Field = dex.Fields[field_idx]
-				offset += length
-				class_def_item.ClassData.InstanceFields[j] = ef
+			field_idx += uint64(ef.FieldIdxDiff)
+			if field_idx >= uint64(len(dex.Fields)) {
+				return uint(offset), &IndexError{Kind: "field", Index: uint32(field_idx), Max: len(dex.Fields)}
 			}
+			ef.FieldIdx = uint32(field_idx)
+			ef.Field = dex.Fields[field_idx]
+			offset += length
+			class_def_item.ClassData.StaticFields[j] = ef
+		}
 
-			return uint(offset), nil
-		}))
-
-		RegisterPack("directmethods", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			class_def_item.ClassData.DirectMethods = make([]EncodedMethod, class_def_item.ClassData.DirectMethodsSize)
-			offset := 0
-			method_idx := uint64(0)
-			for j := uint64(0); j < class_def_item.ClassData.DirectMethodsSize; j++ {
-				em := EncodedMethod{dex: dex}
-				length, _ := Unpack(data[offset:], &em)
-				method_idx += uint64(em.MethodIdxDiff)
-				em.Method = dex.Methods[method_idx]
-				offset += length
-				class_def_item.ClassData.DirectMethods[j] = em
-			}
-			return uint(offset), nil
-		}))
-
-		RegisterPack("virtualmethods", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			class_def_item.ClassData.VirtualMethods = make([]EncodedMethod, class_def_item.ClassData.VirtualMethodsSize)
-			offset := 0
-			method_idx := uint64(0)
-			for j := uint64(0); j < class_def_item.ClassData.VirtualMethodsSize; j++ {
-				em := EncodedMethod{dex: dex}
-				length, _ := Unpack(data[offset:], &em)
-				method_idx += uint64(em.MethodIdxDiff)
-				em.Method = dex.Methods[method_idx]
-				class_def_item.ClassData.VirtualMethods[j] = em
-				offset += length
+		dex.defineFields(class_def_item.ClassData.StaticFields)
+		return uint(offset), nil
+	}))
+
+	RegisterPack("instancefields", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		class_def_item.ClassData.InstanceFields = make([]EncodedField, class_def_item.ClassData.InstanceFieldSize)
+		offset := 0
+		field_idx := uint64(0)
+		for j := uint64(0); j < class_def_item.ClassData.InstanceFieldSize; j++ {
+			ef := EncodedField{dex: dex, classIdx: i}
+			length, err := Unpack(data[offset:], &ef)
+			if err != nil {
+				return uint(offset), err
 			}
-			return uint(offset), nil
-		}))
-
-		RegisterPack("staticvalues", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
-			// get class data offset
-			var offset uint32
-			length, err := packs["uint"](data, reflect.ValueOf(&offset).Elem())
-			if offset == 0 {
-				return length, err
-			}
-
-			// actually should use val
-
-			var size uint64
-			length, err = packs["uleb128"](b[offset:], reflect.ValueOf(&size).Elem())
 
-			offset += uint32(length)
-
-			class_def_item.StaticValues = make([]EncodedValue, size)
-
-			for j := uint64(0); j < size; j++ {
-				ev := EncodedValue{dex: dex}
+			field_idx += uint64(ef.FieldIdxDiff)
+			if field_idx >= uint64(len(dex.Fields)) {
+				return uint(offset), &IndexError{Kind: "field", Index: uint32(field_idx), Max: len(dex.Fields)}
+			}
+			ef.FieldIdx = uint32(field_idx)
+			ef.Field = dex.Fields[field_idx]
+			offset += length
+			class_def_item.ClassData.InstanceFields[j] = ef
+		}
 
-				var val uint32
-				length, _ = packs["ubyte"](b[offset:], reflect.ValueOf(&val).Elem())
-				valueType := ValueType(val & 0x1f)
-				size2 := (uint64(val&0xE0) >> 5)
+		dex.defineFields(class_def_item.ClassData.InstanceFields)
+		return uint(offset), nil
+	}))
+
+	RegisterPack("directmethods", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		class_def_item.ClassData.DirectMethods = make([]EncodedMethod, class_def_item.ClassData.DirectMethodsSize)
+		offset := 0
+		method_idx := uint64(0)
+		for j := uint64(0); j < class_def_item.ClassData.DirectMethodsSize; j++ {
+			em := EncodedMethod{dex: dex, classIdx: i}
+			length, err := Unpack(data[offset:], &em)
+			if err != nil {
+				return uint(offset), err
+			}
 
-				fmt.Printf("ValueType:%d size:%d type:%d %s\n", val, size2, valueType, valueType.String())
+			method_idx += uint64(em.MethodIdxDiff)
+			if method_idx >= uint64(len(dex.Methods)) {
+				return uint(offset), &IndexError{Kind: "method", Index: uint32(method_idx), Max: len(dex.Methods)}
+			}
+			em.MethodIdx = uint32(method_idx)
+			em.Method = dex.Methods[method_idx]
+			offset += length
+			class_def_item.ClassData.DirectMethods[j] = em
+		}
+		return uint(offset), nil
+	}))
+
+	RegisterPack("virtualmethods", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		class_def_item.ClassData.VirtualMethods = make([]EncodedMethod, class_def_item.ClassData.VirtualMethodsSize)
+		offset := 0
+		method_idx := uint64(0)
+		for j := uint64(0); j < class_def_item.ClassData.VirtualMethodsSize; j++ {
+			em := EncodedMethod{dex: dex, classIdx: i}
+			length, err := Unpack(data[offset:], &em)
+			if err != nil {
+				return uint(offset), err
+			}
 
-				if valueType == VALUE_STRING {
-					var stringIdx uint32
-					for k := uint64(0); k <= size2; k++ {
-						stringIdx = stringIdx + uint32(b[offset+1+uint32(k)])<<(k*8)
-					}
-					str := dex.Strings[stringIdx]
-					fmt.Printf("stringidx %d %d %s\n", b[offset+1], stringIdx, str)
-				} else if valueType == VALUE_INT {
-					// SIGNED
-				}
+			method_idx += uint64(em.MethodIdxDiff)
+			if method_idx >= uint64(len(dex.Methods)) {
+				return uint(offset), &IndexError{Kind: "method", Index: uint32(method_idx), Max: len(dex.Methods)}
+			}
+			em.MethodIdx = uint32(method_idx)
+			em.Method = dex.Methods[method_idx]
+			class_def_item.ClassData.VirtualMethods[j] = em
+			offset += length
+		}
+		return uint(offset), nil
+	}))
 
-				offset += (uint32(val) & 0x0E) >> 5
+	RegisterPack("staticvalues", PackFunc(func(data []byte, val reflect.Value) (uint, error) {
+		var offset uint32
+		length, err := packs["uint"](data, reflect.ValueOf(&offset).Elem())
+		if offset == 0 {
+			return length, err
+		}
 
-				class_def_item.StaticValues[j] = ev
-			}
+		if offset >= uint32(len(b)) {
+			return length, fmt.Errorf("Invalid static values offset %x", offset)
+		}
 
-			// _, _ = Unpack(b[offset:], &ea)
+		values, _, err := dex.readEncodedArray(b[offset:], DEFAULT_MAX_DEPTH)
+		if err != nil {
 			return length, err
-		}))
+		}
 
-		_, err = Unpack(b[s:], &class_def_item)
+		class_def_item.StaticValues = values
+		return length, nil
+	}))
 
-		dex.Classes[i] = class_def_item
+	if _, err := Unpack(b[s:], &class_def_item); err != nil {
+		return class_def_item, err
+	}
 
-		/*
-			if class_def_item.StaticValuesOffset > 0 {
-				b2 := class_def_item.StaticValuesOffset
+	return class_def_item, nil
+}
 
-				var ea EncodedArray
-				length, err = Unpack(b[b2:], &ea)
-				b2 += uint32(length)
-			}*/
+func Open(path string) (*DEX, error) {
+	var err error
+	var file *os.File
+	if file, err = os.Open(path); err != nil {
+		return nil, err
+	}
 
+	var b []byte
+	if b, err = ioutil.ReadAll(file); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return ParseAt(b, 0)
 }
 
-func Open(path string) (*DEX, error) {
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+)
+
+// OpenCompressed opens a gzip compressed dex file. Files which are not
+// compressed are parsed as is.
+func OpenCompressed(path string) (*DEX, error) {
 	var err error
 	var file *os.File
 	if file, err = os.Open(path); err != nil {
 		return nil, err
 	}
 
+	defer file.Close()
+
 	var b []byte
 	if b, err = ioutil.ReadAll(file); err != nil {
 		return nil, err
 	}
 
-	dex := &DEX{b: b}
-	dex.Parse()
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(b, xzMagic):
+		return nil, fmt.Errorf("xz compressed dex files are not supported")
+	}
+
+	return ParseAt(b, 0)
+}
+
+// NewDEX returns the dex file in b without parsing it, call Parse or
+// ParseClass before use.
+func NewDEX(b []byte) *DEX {
+	return &DEX{b: b}
+}
+
+type ParseOptions struct {
+	// EagerStrings decodes the whole string pool into Strings while
+	// parsing. By default strings are decoded on first use by StringAt,
+	// which saves the work for the strings a tool never touches.
+	EagerStrings bool
+}
+
+// ParseAt parses a dex file embedded at offset off in b, see ParseAtWith.
+func ParseAt(b []byte, off int) (*DEX, error) {
+	return ParseAtWith(b, off, ParseOptions{})
+}
+
+// ParseAtWith parses a dex file embedded at offset off in b. The dex is
+// not copied; all offsets within it stay relative to its own start.
+func ParseAtWith(b []byte, off int, opts ParseOptions) (*DEX, error) {
+	if off < 0 || off > len(b) {
+		return nil, fmt.Errorf("Invalid offset %d", off)
+	}
+
+	dex := &DEX{b: b[off:]}
+	if err := dex.Parse(); err != nil {
+		return nil, err
+	}
+
+	if opts.EagerStrings {
+		if err := dex.DecodeStrings(); err != nil {
+			return nil, err
+		}
+	}
 
 	return dex, nil
 }
+
+// OpenWrapped parses a dex file stored after a fixed size prefix of
+// headerSkip bytes, eg. the length and type fields of a Parcel-wrapped
+// blob. Use ScanForDex when the size of the prefix is not known.
+func OpenWrapped(b []byte, headerSkip int) (*DEX, error) {
+	if headerSkip < 0 || headerSkip > len(b) {
+		return nil, fmt.Errorf("Invalid prefix size %d", headerSkip)
+	}
+
+	if !bytes.HasPrefix(b[headerSkip:], DEX_FILE_MAGIC[:4]) {
+		return nil, fmt.Errorf("No dex file after %d byte prefix", headerSkip)
+	}
+
+	return ParseAt(b, headerSkip)
+}
+
+// ScanForDex returns the offsets in b where a dex file appears to start.
+// Candidates are found by their magic (any version) and kept only when
+// the declared file size fits within b. Use ParseAt to parse them.
+func ScanForDex(b []byte) []int {
+	offsets := []int{}
+
+	prefix := DEX_FILE_MAGIC[:4]
+	for off := 0; off+0x70 <= len(b); off++ {
+		i := bytes.Index(b[off:], prefix)
+		if i == -1 {
+			break
+		}
+
+		off += i
+		if off+0x70 > len(b) {
+			break
+		}
+
+		magic := b[off : off+8]
+		if !isDigit(magic[4]) || !isDigit(magic[5]) || !isDigit(magic[6]) || magic[7] != 0x00 {
+			continue
+		}
+
+		size := binary.LittleEndian.Uint32(b[off+32 : off+36])
+		if size < 0x70 || uint64(off)+uint64(size) > uint64(len(b)) {
+			continue
+		}
+
+		offsets = append(offsets, off)
+	}
+
+	return offsets
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -1,6 +1,15 @@
 package godex
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -53,3 +62,655 @@ func TestXxx(t *testing.T) {
 
 	_ = err
 }
+
+func TestStrLengthExceedsBuffer(t *testing.T) {
+	// declares 5 bytes of string data, but only 2 follow
+	if _, _, err := str([]byte{0x05, 'a', 'b'}); err == nil {
+		t.Errorf("expected error for truncated string data")
+	}
+
+	s, _, err := str([]byte{0x02, 'a', 'b', 0x00})
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if s != "ab" {
+		t.Errorf("Test failed %s %s", s, "ab")
+	}
+}
+
+func TestStrUTF16Length(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Hello;", "Ljava/lang/Object;")
+	greeting := b.str("héllo wörld")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if s, _ := dex.StringAt(greeting); s != "héllo wörld" {
+		t.Errorf("Test failed %s %s", s, "héllo wörld")
+	}
+
+	// U+1F600 as two encoded surrogates and NUL as two bytes
+	data := []byte{0x04, 'a', 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0xc0, 0x80, 0x00}
+	if s, _, err := str(data); err != nil || s != "a\U0001F600\x00" {
+		t.Errorf("Test failed %q %q", s, "a\U0001F600\x00")
+	}
+
+	// the length counts code units, not bytes
+	if _, _, err := str([]byte{0x0b, 0xc3, 0xa9, 0x00}); err == nil {
+		t.Errorf("expected error for wrong code unit count")
+	}
+}
+
+func testTypesDEX() *DEX {
+	d := &DEX{
+		Strings: []string{"I", "Ljava/lang/String;", "[[Lcom/foo/Bar;", "V"},
+	}
+	for i := range d.Strings {
+		d.Types = append(d.Types, TypeId{dex: d, DescriptorIdx: uint32(i)})
+	}
+	return d
+}
+
+func TestJavaName(t *testing.T) {
+	d := testTypesDEX()
+
+	want := []string{"int", "java.lang.String", "com.foo.Bar[][]", "void"}
+	for i := range d.Types {
+		// second lookup is served from the intern cache
+		for j := 0; j < 2; j++ {
+			if name := d.Types[i].JavaName(); name != want[i] {
+				t.Errorf("Test failed %s %s", name, want[i])
+			}
+		}
+	}
+
+	if len(d.javaNames) != len(want) {
+		t.Errorf("Test failed %d %d", len(d.javaNames), len(want))
+	}
+}
+
+func BenchmarkJavaName(b *testing.B) {
+	d := testTypesDEX()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.Types[2].JavaName()
+	}
+}
+
+func BenchmarkJavaNameUncached(b *testing.B) {
+	d := testTypesDEX()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		javaName(d.Types[2].String())
+	}
+}
+
+func testHelloDEX() *testDex {
+	t := &testDex{}
+	c := t.class("Lcom/example/Hello;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   t.method("Lcom/example/Hello;", "<init>", "V"),
+			flags: ACC_PUBLIC | ACC_CONSTRUCTOR,
+			code: &testCode{registers: 1, ins: 1, outs: 1, insns: []uint16{
+				0x1070, uint16(t.method("Ljava/lang/Object;", "<init>", "V")), 0x0000, // invoke-direct {v0}, Object.<init>
+				0x000e, // return-void
+			}},
+		},
+	}
+	return t
+}
+
+func TestParseAt(t *testing.T) {
+	b := testHelloDEX().build()
+
+	buf := append(make([]byte, 0x1000), b...)
+	buf = append(buf, make([]byte, 0x100)...)
+
+	dex, err := ParseAt(buf, 0x1000)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(dex.Classes) != 1 {
+		t.Fatalf("Test failed %d %d", len(dex.Classes), 1)
+	}
+
+	if name := dex.Types[dex.Classes[0].ClassIdx].String(); name != "Lcom/example/Hello;" {
+		t.Errorf("Test failed %s %s", name, "Lcom/example/Hello;")
+	}
+
+	if name := dex.Classes[0].ClassData.DirectMethods[0].Method.Name(); name != "<init>" {
+		t.Errorf("Test failed %s %s", name, "<init>")
+	}
+
+	if _, err := ParseAt(buf, len(buf)-0x10); err == nil {
+		t.Errorf("expected error parsing truncated dex")
+	}
+}
+
+func TestOpenWrapped(t *testing.T) {
+	b := testHelloDEX().build()
+
+	prefix := make([]byte, 32)
+	binary.LittleEndian.PutUint32(prefix, uint32(len(b)))
+	buf := append(prefix, b...)
+
+	dex, err := OpenWrapped(buf, 32)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if name := dex.Types[dex.Classes[0].ClassIdx].String(); name != "Lcom/example/Hello;" {
+		t.Errorf("Test failed %s %s", name, "Lcom/example/Hello;")
+	}
+
+	for _, skip := range []int{-1, 16, len(buf) + 1} {
+		if _, err := OpenWrapped(buf, skip); err == nil {
+			t.Errorf("expected error skipping %d bytes", skip)
+		}
+	}
+}
+
+func TestScanForDex(t *testing.T) {
+	b := testHelloDEX().build()
+
+	buf := append([]byte("junk dex\n"), b...)
+	buf = append(buf, make([]byte, 0x33)...)
+	second := len(buf)
+	buf = append(buf, b...)
+	// a magic whose declared size runs past the buffer is rejected
+	buf = append(buf, b[:0x80]...)
+
+	offsets := ScanForDex(buf)
+	if len(offsets) != 2 || offsets[0] != 9 || offsets[1] != second {
+		t.Fatalf("Test failed %v %v", offsets, []int{9, second})
+	}
+
+	for _, off := range offsets {
+		if _, err := ParseAt(buf, off); err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+}
+
+func TestProtoReturnType(t *testing.T) {
+	b := &testDex{}
+	b.proto("Z", "Ljava/lang/String;")
+	b.proto("V")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for i, want := range []string{"boolean", "void"} {
+		if ret := dex.Prototypes[i].ReturnType(); ret != want {
+			t.Errorf("Test failed %s %s", ret, want)
+		}
+	}
+
+	b.protos[1].ret = 999
+	_, err = ParseAt(b.build(), 0)
+	if _, ok := err.(*IndexError); !ok {
+		t.Errorf("Test failed %v %s", err, "Invalid type index")
+	}
+}
+
+func TestPrototypeSignatures(t *testing.T) {
+	b := &testDex{}
+	b.proto("Z", "Ljava/lang/String;", "[I")
+	b.proto("V")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{"(java.lang.String, int[]) boolean", "() void"}
+	if signatures := dex.PrototypeSignatures(); !reflect.DeepEqual(signatures, want) {
+		t.Errorf("Test failed %v %v", signatures, want)
+	}
+
+	// parsing rejects this, but the pools are exported
+	dex.Prototypes[1].ReturnTypeIdx = 999
+	want[1] = "<Invalid type index 999, max 4>"
+	if signatures := dex.PrototypeSignatures(); !reflect.DeepEqual(signatures, want) {
+		t.Errorf("Test failed %v %v", signatures, want)
+	}
+}
+
+func TestConstructorMethods(t *testing.T) {
+	b := testHelloDEX()
+	c := b.classes[0]
+	c.directMethods = append(c.directMethods, testMethod{
+		idx: b.method("Lcom/example/Hello;", "<clinit>", "V"), flags: ACC_STATIC | ACC_CONSTRUCTOR, code: &testCode{insns: []uint16{0x000e}},
+	})
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Hello;", "init", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, test := range []struct {
+		m           *EncodedMethod
+		constructor bool
+		initializer bool
+	}{
+		{&dex.Classes[0].ClassData.DirectMethods[0], true, false},
+		{&dex.Classes[0].ClassData.DirectMethods[1], false, true},
+		{&dex.Classes[0].ClassData.VirtualMethods[0], false, false},
+	} {
+		if test.m.IsConstructor() != test.constructor || test.m.IsStaticInitializer() != test.initializer {
+			t.Errorf("Test failed %s %v %v", test.m.Method.Name(), test.m.IsConstructor(), test.m.IsStaticInitializer())
+		}
+	}
+}
+
+func TestParseEmptySections(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Empty;", "Ljava/lang/Object;")
+	c.staticValues = []byte{0x00}
+
+	raw := b.build()
+
+	// empty sections should have a zero offset, some tools leave one
+	le := binary.LittleEndian
+	for i := 0; i < 6; i++ {
+		if le.Uint32(raw[56+8*i:]) == 0 {
+			le.PutUint32(raw[60+8*i:], 0xfffffff0)
+		}
+	}
+
+	dex, err := ParseAt(raw, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(dex.Prototypes) != 0 || len(dex.Fields) != 0 || len(dex.Methods) != 0 || len(dex.Classes) != 1 {
+		t.Fatalf("Test failed %d %d %d %d", len(dex.Prototypes), len(dex.Fields), len(dex.Methods), len(dex.Classes))
+	}
+
+	class := &dex.Classes[0]
+	if _, err := class.Smali(); err != nil {
+		t.Errorf("Test failed %v", err)
+	}
+
+	if refs := dex.FindMethods(func(*ClassDefItem, *EncodedMethod) bool { return true }); len(refs) != 0 {
+		t.Errorf("Test failed %v", refs)
+	}
+
+	if err := dex.VerifySections(); err == nil {
+		t.Errorf("expected an error for the offsets of empty sections")
+	}
+}
+
+func TestOpenCompressed(t *testing.T) {
+	b := testHelloDEX().build()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"classes.dex.gz": buf.Bytes(), "classes.dex": b} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		dex, err := OpenCompressed(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if len(dex.Classes) != 1 {
+			t.Errorf("%s: Test failed %d %d", name, len(dex.Classes), 1)
+		}
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	b := testHelloDEX()
+	want := int(b.str("<init>"))
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if idx, ok := dex.StringIndex("<init>"); !ok || idx != want {
+		t.Errorf("Test failed %d %d", idx, want)
+	}
+
+	if _, ok := dex.StringIndex("missing"); ok {
+		t.Errorf("Test failed, found %s", "missing")
+	}
+}
+
+func TestDumpToSections(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dex.DumpTo(&buf, []string{"strings"}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "Strings:\n"
+	for i := 0; i < dex.StringCount(); i++ {
+		want += fmt.Sprintf("%d %s\n", i, dex.string(uint32(i)))
+	}
+
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := dex.DumpTo(&buf, []string{"strings", "bogus"}); err == nil || buf.Len() != 0 {
+		t.Errorf("expected error without output for unknown section")
+	}
+
+	r, w := io.Pipe()
+	r.Close()
+	if err := dex.DumpTo(w, nil); err != io.ErrClosedPipe {
+		t.Errorf("Test failed %v %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestDexVersion(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	v, err := dex.Version()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if v != 35 || v.String() != "035" || v >= 38 {
+		t.Errorf("Test failed %s %s", v, "035")
+	}
+
+	h := Header{}
+	copy(h.Magic[:], "dex\n0x5\x00")
+	if _, err := h.DexVersion(); err == nil {
+		t.Errorf("expected error for corrupted magic")
+	}
+}
+
+func TestSectionSizeOverflow(t *testing.T) {
+	b := testHelloDEX().build()
+
+	// 8 * 0x20000001 wraps around to 8 in 32 bits
+	for _, off := range []int{0x50, 0x58} {
+		buf := append([]byte{}, b...)
+		binary.LittleEndian.PutUint32(buf[off:], 0x20000001)
+
+		if _, err := ParseAt(buf, 0); err == nil {
+			t.Errorf("expected error for section size at %x", off)
+		}
+	}
+
+	buf := append([]byte{}, b...)
+	binary.LittleEndian.PutUint32(buf[0x60:], 0x08000001)
+	if _, err := ParseAt(buf, 0); err == nil {
+		t.Errorf("expected error for class defs size")
+	}
+}
+
+func TestShorty(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Hello;", "Ljava/lang/Object;")
+	idx := b.method("Lcom/example/Hello;", "put", "V", "Ljava/lang/String;", "J", "[I")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if shorty, err := dex.Shorty(dex.Methods[idx].ProtoIdx); err != nil || shorty != "VLJL" {
+		t.Errorf("Test failed %s %s", shorty, "VLJL")
+	}
+
+	if _, err := dex.Shorty(uint16(len(dex.Prototypes))); err == nil {
+		t.Errorf("expected an error for an invalid proto index")
+	}
+
+	// a shorty index past the string pool
+	dex.Prototypes[0].ShortyIdx = uint32(dex.StringCount())
+	if _, err := dex.Shorty(0); err == nil {
+		t.Errorf("expected an error for an invalid shorty index")
+	}
+}
+
+func TestFindMethod(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/MainActivity;", "Landroid/app/Activity;")
+	onCreate := b.method("Lcom/example/MainActivity;", "onCreate", "V", "Landroid/os/Bundle;")
+	c.virtualMethods = []testMethod{
+		{idx: onCreate, flags: ACC_PUBLIC, code: &testCode{registers: 2, ins: 2, insns: []uint16{0x000e}}},
+	}
+	b.method("Lcom/example/MainActivity;", "onCreate", "V")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if idx, ok := dex.FindMethod("Lcom/example/MainActivity;", "onCreate", "(Landroid/os/Bundle;)V"); !ok || idx != int(onCreate) {
+		t.Errorf("Test failed %d %d", idx, onCreate)
+	}
+
+	if _, ok := dex.FindMethod("Lcom/example/MainActivity;", "onCreate", "(I)V"); ok {
+		t.Errorf("Test failed %v %v", ok, false)
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	dex, err := ParseAt(testManyClassesDEX(20), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range dex.Types {
+				dex.Types[j].JavaName()
+			}
+
+			if _, ok := dex.FindMethod("Lcom/example/C0007;", "run", "()V"); !ok {
+				t.Errorf("Test failed %v %v", ok, true)
+			}
+
+			if _, ok := dex.StringIndex("run"); !ok {
+				t.Errorf("Test failed %v %v", ok, true)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSectionOffset(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	off, size, ok := dex.SectionOffset(TYPE_CODE_ITEM)
+	if !ok || size != 1 {
+		t.Fatalf("Test failed %v %d", ok, size)
+	}
+
+	if off != uint32(dex.Classes[0].ClassData.DirectMethods[0].CodeOffset) {
+		t.Errorf("Test failed %x %x", off, dex.Classes[0].ClassData.DirectMethods[0].CodeOffset)
+	}
+
+	if _, _, ok := dex.SectionOffset(TYPE_CALL_SITE_ID_ITEM); ok {
+		t.Errorf("Test failed %v %v", ok, false)
+	}
+}
+
+func TestAccessFlagsHas(t *testing.T) {
+	af := AccessFlags(ACC_PUBLIC | ACC_STATIC | ACC_FINAL)
+
+	if !af.Has(ACC_STATIC) || !af.Has(ACC_PUBLIC|ACC_FINAL) {
+		t.Errorf("Test failed %s", af)
+	}
+
+	if af.Has(ACC_PRIVATE) || af.Has(ACC_STATIC|ACC_NATIVE) {
+		t.Errorf("Test failed %s", af)
+	}
+
+	if s := af.String(); s != "public static final " {
+		t.Errorf("Test failed %q %q", s, "public static final ")
+	}
+}
+
+func TestDumpStaticValues(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Limits;", "Ljava/lang/Object;")
+	c.staticFields = []testField{
+		{idx: b.field("Lcom/example/Limits;", "I", "MAX"), flags: ACC_PUBLIC | ACC_STATIC | ACC_FINAL},
+		{idx: b.field("Lcom/example/Limits;", "Ljava/lang/String;", "NAME"), flags: ACC_PUBLIC | ACC_STATIC | ACC_FINAL},
+		{idx: b.field("Lcom/example/Limits;", "I", "count"), flags: ACC_STATIC},
+	}
+	c.staticValues = []byte{0x02, VALUE_INT, 100, VALUE_STRING, byte(b.str("limits \"v1\""))}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dex.DumpTo(&buf, []string{"classes"}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "Classes:\n" +
+		"public  Test.java\n" +
+		"public static final  I Lcom/example/Limits; MAX=100\n" +
+		"public static final  Ljava/lang/String; Lcom/example/Limits; NAME=\"limits \\\"v1\\\"\"\n" +
+		"static  I Lcom/example/Limits; count=\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+}
+
+func TestDefinedField(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Limits;", "Ljava/lang/Object;")
+	max := b.field("Lcom/example/Limits;", "I", "MAX")
+	c.staticFields = []testField{
+		{idx: max, flags: ACC_PUBLIC | ACC_STATIC | ACC_FINAL},
+	}
+	c.staticValues = []byte{0x01, VALUE_INT, 100}
+	external := b.field("Ljava/lang/System;", "Ljava/io/PrintStream;", "out")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	f, ok := dex.DefinedField(int(max))
+	if !ok {
+		t.Fatalf("Test failed, field %d not defined", max)
+	}
+
+	if want := AccessFlags(ACC_PUBLIC | ACC_STATIC | ACC_FINAL); f.AccessFlags != want {
+		t.Errorf("Test failed %v %v", f.AccessFlags, want)
+	}
+
+	ev, ok := f.StaticValue()
+	if v, err := ev.Decode(); !ok || err != nil || v != int64(100) {
+		t.Errorf("Test failed %v %v", v, 100)
+	}
+
+	if _, ok := dex.DefinedField(int(external)); ok {
+		t.Errorf("Test failed, field %d defined", external)
+	}
+}
+
+func TestParseInvalidStaticValues(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Deep;", "Ljava/lang/Object;")
+	c.staticFields = []testField{
+		{idx: b.field("Lcom/example/Deep;", "[Ljava/lang/Object;", "DEEP"), flags: ACC_STATIC},
+	}
+	c.staticValues = append([]byte{0x01}, nestedArray(100)...)
+	raw := b.build()
+
+	if _, err := ParseAt(raw, 0); err != ErrMaxDepth {
+		t.Errorf("Test failed %v %v", err, ErrMaxDepth)
+	}
+
+	if _, err := NewDEX(raw).ParseClass("Lcom/example/Deep;"); err != ErrMaxDepth {
+		t.Errorf("Test failed %v %v", err, ErrMaxDepth)
+	}
+}
+
+func TestParseInvalidFieldId(t *testing.T) {
+	for _, corrupt := range []func(f *testFieldId){
+		func(f *testFieldId) { f.class = 999 },
+		func(f *testFieldId) { f.typ = 999 },
+		func(f *testFieldId) { f.name = 999 },
+	} {
+		b := &testDex{}
+		c := b.class("Lcom/example/Counter;", "Ljava/lang/Object;")
+		c.instanceFields = []testField{
+			{idx: b.field("Lcom/example/Counter;", "I", "count"), flags: ACC_PRIVATE},
+		}
+		corrupt(&b.fields[0])
+
+		if _, err := ParseAt(b.build(), 0); err == nil || err.Error() != "Invalid field id 0" {
+			t.Errorf("Test failed %v %s", err, "Invalid field id 0")
+		}
+	}
+}
+
+func TestFieldFlags(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Counter;", "Ljava/lang/Object;")
+	c.instanceFields = []testField{
+		{idx: b.field("Lcom/example/Counter;", "I", "count"), flags: ACC_PRIVATE | ACC_VOLATILE},
+		{idx: b.field("Lcom/example/Counter;", "Ljava/lang/Object;", "lock"), flags: ACC_PRIVATE | ACC_FINAL | ACC_TRANSIENT},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	fields := dex.Classes[0].ClassData.InstanceFields
+
+	count := &fields[0]
+	if !count.IsVolatile() || count.IsTransient() || count.IsStatic() || count.IsFinal() {
+		t.Errorf("Test failed %s", count.AccessFlags)
+	}
+
+	if s := count.String(); s != "private volatile int count" {
+		t.Errorf("Test failed %s %s", s, "private volatile int count")
+	}
+
+	lock := &fields[1]
+	if lock.IsVolatile() || !lock.IsTransient() || !lock.IsFinal() {
+		t.Errorf("Test failed %s", lock.AccessFlags)
+	}
+
+	if s := lock.String(); s != "private final transient java.lang.Object lock" {
+		t.Errorf("Test failed %s %s", s, "private final transient java.lang.Object lock")
+	}
+}
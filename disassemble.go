@@ -0,0 +1,248 @@
+package godex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DEFAULT_MAX_INSTRUCTIONS is the default limit on the instructions
+// decoded per method.
+const DEFAULT_MAX_INSTRUCTIONS = 1 << 20
+
+var ErrMaxInstructions = errors.New("Maximum instruction count exceeded")
+
+type DisassembleOptions struct {
+	// SmaliRegisters names the incoming parameter registers p0, p1, ...
+	// and the locals v0, v1, ..., as smali does.
+	SmaliRegisters bool
+	// BestEffort continues past invalid opcodes, writing them as raw
+	// code units. The first DisassembleError is still returned.
+	BestEffort bool
+	// Rewriter, if set, is called with every decoded instruction and
+	// the instruction it returns is written instead, eg. to resolve
+	// indices in a Comment.
+	Rewriter func(DecodedInstruction) DecodedInstruction
+	// MaxInstructions stops decoding with ErrMaxInstructions after that
+	// many instructions, a crafted insns_size could otherwise keep the
+	// disassembler busy. Defaults to DEFAULT_MAX_INSTRUCTIONS.
+	MaxInstructions int
+	// Format is the style of the lines written:
+	//
+	//	"default"  offset and instruction, "0000: const/4 v0, 0"
+	//	"smali"    instruction as in a smali file, with labels and
+	//	           resolved indices, "const-string v0, \"hello\""
+	//	"raw"      offset, code units and mnemonic, "0000: 1200 const/4"
+	//
+	// Defaults to "default".
+	Format string
+}
+
+func (o DisassembleOptions) maxInstructions() int {
+	if o.MaxInstructions <= 0 {
+		return DEFAULT_MAX_INSTRUCTIONS
+	}
+	return o.MaxInstructions
+}
+
+// DisassembleTo writes the method's instructions to w, one per line,
+// prefixed by their offset in code units unless opts.Format is "smali".
+// Decoding stops at the first invalid opcode with a *DisassembleError,
+// unless opts.BestEffort is set.
+func (m *EncodedMethod) DisassembleTo(w io.Writer, opts DisassembleOptions) error {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return err
+	}
+	return m.dex.disassemble(w, code, 0, len(code.Insns), opts)
+}
+
+// DumpMethod writes the method with the given signature, eg.
+// "Lcom/example/Main;->onCreate(Landroid/os/Bundle;)V", to w: its access
+// flags and code sizes followed by its disassembly.
+func (d *DEX) DumpMethod(signature string, w io.Writer) error {
+	i := strings.Index(signature, "->")
+	j := strings.Index(signature, "(")
+	if i == -1 || j < i {
+		return fmt.Errorf("Invalid method signature %s", signature)
+	}
+
+	idx, ok := d.FindMethod(signature[:i], signature[i+2:j], signature[j:])
+	if !ok {
+		return fmt.Errorf("Method %s not found", signature)
+	}
+
+	refs := d.FindMethods(func(_ *ClassDefItem, m *EncodedMethod) bool {
+		return m.MethodIdx == uint32(idx)
+	})
+	if len(refs) == 0 {
+		return fmt.Errorf("Method %s is not defined in this dex", signature)
+	}
+	m := refs[0].Method
+
+	if _, err := fmt.Fprintf(w, "%s\naccess: %s\n", signature, strings.TrimSpace(m.AccessFlags.methodString())); err != nil {
+		return err
+	}
+
+	code, err := m.Code()
+	if err != nil {
+		return err
+	}
+
+	if code == nil {
+		_, err := fmt.Fprintln(w, "no code")
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "registers: %d, ins: %d, outs: %d, tries: %d, insns: %d\n", code.RegistersSize, code.InsSize, code.OutsSize, code.TriesSize, code.InsnsSize); err != nil {
+		return err
+	}
+	return m.DisassembleTo(w, DisassembleOptions{})
+}
+
+// DisassembleRange is DisassembleTo for the instructions starting within
+// the byte offsets [start, end) of the method's code only. The range is
+// clamped to the code.
+func (m *EncodedMethod) DisassembleRange(start, end uint32, w io.Writer) error {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return err
+	}
+
+	if end > uint32(len(code.Insns)) {
+		end = uint32(len(code.Insns))
+	}
+	return m.dex.disassemble(w, code, int(start), int(end), DisassembleOptions{})
+}
+
+// disassemble writes the instructions starting within [start, end).
+// Decoding begins at the start of the code, as instruction boundaries are
+// only known from there.
+func (d *DEX) disassemble(w io.Writer, code *CodeItem, start, end int, opts DisassembleOptions) error {
+	var smali *smaliFormatter
+	var cases map[uint32][]SwitchCase
+	switch opts.Format {
+	case "", "default", "raw":
+	case "smali":
+		// labels need all branches, up to the first invalid opcode
+		insns := []DecodedInstruction{}
+		for offset := 0; offset < len(code.Insns) && len(insns) < opts.maxInstructions(); {
+			di, err := d.decodeInstruction(code.Insns, offset)
+			if err != nil {
+				break
+			}
+
+			insns = append(insns, di)
+			offset += di.Length
+		}
+
+		labels, switchCases, err := smaliLabels(code, insns)
+		if err != nil {
+			return err
+		}
+
+		smali = &smaliFormatter{dex: d, code: code, labels: labels}
+		cases = switchCases
+	default:
+		return fmt.Errorf("Unsupported format %s", opts.Format)
+	}
+
+	writeLine := func(offset int, line string) error {
+		if smali == nil {
+			_, err := fmt.Fprintf(w, "%04x: %s\n", offset/2, line)
+			return err
+		}
+
+		if label, ok := smali.labels[uint32(offset)]; ok {
+			if _, err := fmt.Fprintf(w, "    %s\n", label); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "    %s\n", strings.Replace(line, "\n", "\n    ", -1))
+		return err
+	}
+
+	var decodeErr error
+	for offset, count := 0, 0; offset < end; count++ {
+		if count == opts.maxInstructions() {
+			return ErrMaxInstructions
+		}
+
+		di, err := d.decodeInstruction(code.Insns, offset)
+		if err != nil {
+			if !opts.BestEffort {
+				return err
+			}
+
+			if decodeErr == nil {
+				decodeErr = err
+			}
+
+			if offset >= start {
+				if err := writeLine(offset, fmt.Sprintf(".word 0x%02x%02x", code.Insns[offset+1], code.Insns[offset])); err != nil {
+					return err
+				}
+			}
+			offset += 2
+			continue
+		}
+
+		// the rewritten instruction is only written, decoding continues
+		// after the original
+		length := di.Length
+		if offset >= start {
+			if opts.Rewriter != nil {
+				di = opts.Rewriter(di)
+			}
+
+			var line string
+			switch {
+			case smali != nil:
+				if line, err = smali.instruction(di, cases[di.Offset]); err != nil {
+					return err
+				}
+			case opts.Format == "raw":
+				line = rawInstruction(di)
+			default:
+				line = formatInstruction(di, code, opts)
+			}
+
+			if di.Comment != "" {
+				line += " # " + di.Comment
+			}
+
+			if err := writeLine(int(di.Offset), line); err != nil {
+				return err
+			}
+		}
+		offset += length
+	}
+	return decodeErr
+}
+
+// rawInstruction formats the code units of di, as stored, followed by
+// its mnemonic.
+func rawInstruction(di DecodedInstruction) string {
+	units := []string{}
+	for i := 0; i+1 < len(di.Raw); i += 2 {
+		units = append(units, fmt.Sprintf("%02x%02x", di.Raw[i], di.Raw[i+1]))
+	}
+	return strings.Join(units, " ") + " " + di.Name
+}
+
+func formatInstruction(di DecodedInstruction, code *CodeItem, opts DisassembleOptions) string {
+	if len(di.Operands) == 0 {
+		return di.Name
+	}
+
+	operands := make([]string, len(di.Operands))
+	for i, operand := range di.Operands {
+		if r, ok := operand.(RegisterOperand); ok && opts.SmaliRegisters {
+			operands[i] = code.smaliRegister(r)
+			continue
+		}
+		operands[i] = operand.String()
+	}
+	return di.Name + " " + strings.Join(operands, ", ")
+}
@@ -0,0 +1,334 @@
+package godex
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDisassembleSmaliRegisters(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Self;", "Ljava/lang/Object;")
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Self;", "self", "Lcom/example/Self;"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x1007, // move-object v0, v1
+				0x0111, // return-object v1
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.VirtualMethods[0]
+
+	var buf bytes.Buffer
+	if err := m.DisassembleTo(&buf, DisassembleOptions{SmaliRegisters: true}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "0000: move-object v0, p0\n0001: return-object p0\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := m.DisassembleTo(&buf, DisassembleOptions{}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want = "0000: move-object v0, v1\n0001: return-object v1\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+}
+
+func TestDisassembleError(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Bad;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Bad;", "bad", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 1, insns: []uint16{
+				0x0012, // const/4 v0, 0
+				0x003e, // unused opcode
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+
+	var buf bytes.Buffer
+	err = m.DisassembleTo(&buf, DisassembleOptions{})
+
+	var de *DisassembleError
+	if !errors.As(err, &de) {
+		t.Fatalf("Test failed %v %T", err, de)
+	}
+
+	if err := dex.DumpTo(ioutil.Discard, []string{"classes"}); !errors.As(err, &de) {
+		t.Errorf("Test failed %v %T", err, de)
+	}
+
+	if de.Offset != 2 || de.Opcode != 0x3e {
+		t.Errorf("Test failed %d/%x %d/%x", de.Offset, de.Opcode, 2, 0x3e)
+	}
+
+	if buf.String() != "0000: const/4 v0, #0\n" {
+		t.Errorf("Test failed %q %q", buf.String(), "0000: const/4 v0, #0\n")
+	}
+
+	buf.Reset()
+	if err := m.DisassembleTo(&buf, DisassembleOptions{BestEffort: true}); !errors.As(err, &de) {
+		t.Errorf("Test failed %v %T", err, de)
+	}
+
+	want := "0000: const/4 v0, #0\n0001: .word 0x003e\n0002: return-void\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+}
+
+func TestDisassembleRange(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Range;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Range;", "sum", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, insns: []uint16{
+				0x1012,         // const/4 v0, 1
+				0x0113, 0x0002, // const/16 v1, 2
+				0x10b0, // add-int/2addr v0, v1
+				0x000f, // return v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+
+	var buf bytes.Buffer
+	if err := m.DisassembleRange(0, 4, &buf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "0000: const/4 v0, #1\n0001: const/16 v1, #2\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := m.DisassembleRange(6, 1000, &buf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want = "0003: add-int/2addr v0, v1\n0004: return v0\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+}
+
+func TestRegisterOpcodeHandler(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/VM;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/VM;", "run", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, insns: []uint16{
+				0x013e, 0x002a, // reserved opcode 0x3e
+				0x000e, // return-void
+			}},
+		},
+	}
+	buf := b.build()
+
+	dex, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	dex.RegisterOpcodeHandler(0x3e, func(insn []byte) (DecodedInstruction, error) {
+		return DecodedInstruction{
+			Name:     "vm-push",
+			Length:   4,
+			Operands: []Operand{RegisterOperand{Register: uint16(insn[1])}, LiteralOperand{Value: int64(insn[2])}},
+		}, nil
+	})
+
+	var out bytes.Buffer
+	if err := dex.Classes[0].ClassData.DirectMethods[0].DisassembleTo(&out, DisassembleOptions{}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "0000: vm-push v1, #42\n0002: return-void\n"
+	if out.String() != want {
+		t.Errorf("Test failed %q %q", out.String(), want)
+	}
+
+	// handlers are registered per dex
+	other, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var disassembleErr *DisassembleError
+	if _, err := other.Classes[0].ClassData.DirectMethods[0].Instructions(); !errors.As(err, &disassembleErr) {
+		t.Errorf("Test failed %v %v", err, &DisassembleError{})
+	}
+}
+
+func TestDisassembleRewriter(t *testing.T) {
+	b := testHelloDEX()
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+
+	// resolve method indices to names
+	rewriter := func(di DecodedInstruction) DecodedInstruction {
+		for _, operand := range di.Operands {
+			if idx, ok := operand.(MethodIndexOperand); ok {
+				di.Comment = dex.Methods[idx.Index].Class() + "->" + dex.Methods[idx.Index].Name()
+			}
+		}
+		return di
+	}
+
+	var buf bytes.Buffer
+	if err := m.DisassembleTo(&buf, DisassembleOptions{Rewriter: rewriter}); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "0000: invoke-direct v0, method@1 # Ljava/lang/Object;-><init>\n0003: return-void\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+}
+
+func TestDisassembleMaxInstructions(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Long;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Long;", "spin", "V"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code:  &testCode{registers: 1, insns: append(make([]uint16, 9), 0x000e)},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+
+	var buf bytes.Buffer
+	if err := m.DisassembleTo(&buf, DisassembleOptions{MaxInstructions: 4}); err != ErrMaxInstructions {
+		t.Errorf("Test failed %v %v", err, ErrMaxInstructions)
+	}
+
+	want := "0000: nop\n0001: nop\n0002: nop\n0003: nop\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := m.DisassembleTo(&buf, DisassembleOptions{}); err != nil {
+		t.Errorf("Test failed %v %v", err, nil)
+	}
+}
+
+func TestDumpMethod(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dex.DumpMethod("Lcom/example/Hello;-><init>()V", &buf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := "Lcom/example/Hello;-><init>()V\n" +
+		"access: public constructor\n" +
+		"registers: 1, ins: 1, outs: 1, tries: 0, insns: 4\n" +
+		"0000: invoke-direct v0, method@1\n" +
+		"0003: return-void\n"
+	if buf.String() != want {
+		t.Errorf("Test failed %q %q", buf.String(), want)
+	}
+
+	for _, signature := range []string{"Lcom/example/Hello;->missing()V", "Ljava/lang/Object;-><init>()V", "<init>"} {
+		if err := dex.DumpMethod(signature, &buf); err == nil {
+			t.Errorf("expected error dumping %s", signature)
+		}
+	}
+}
+
+func TestDisassembleFormat(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Hello;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Hello;", "hello", "Ljava/lang/String;", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0138, 0x0002, // if-eqz v1, +2
+				0x001a, uint16(b.str("hello")), // const-string v0, "hello"
+				0x0011, // return-object v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m := &dex.Classes[0].ClassData.DirectMethods[0]
+	for _, test := range []struct {
+		format string
+		want   string
+	}{
+		{"", "0000: if-eqz v1, +2\n0002: const-string v0, string@6\n0004: return-object v0\n"},
+		{"default", "0000: if-eqz v1, +2\n0002: const-string v0, string@6\n0004: return-object v0\n"},
+		{"smali", "    if-eqz p0, :L0\n    :L0\n    const-string v0, \"hello\"\n    return-object v0\n"},
+		{"raw", "0000: 3801 0200 if-eqz\n0002: 1a00 0600 const-string\n0004: 1100 return-object\n"},
+	} {
+		var buf bytes.Buffer
+		if err := m.DisassembleTo(&buf, DisassembleOptions{Format: test.format}); err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if buf.String() != test.want {
+			t.Errorf("Test failed %q %q", buf.String(), test.want)
+		}
+	}
+
+	if err := m.DisassembleTo(&bytes.Buffer{}, DisassembleOptions{Format: "json"}); err == nil {
+		t.Errorf("expected an error for an unsupported format")
+	}
+}
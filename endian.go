@@ -0,0 +1,208 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ParseWithOrder parses a dex file whose fixed size fields are stored in
+// order, whatever its endian tag says. Big endian files are converted to
+// a little endian copy first, which the DEX then refers to. Items made of
+// bytes and LEB128 values, eg. strings, class data and encoded values,
+// have no byte order and are copied as is.
+func ParseWithOrder(b []byte, order binary.ByteOrder) (*DEX, error) {
+	switch order {
+	case binary.LittleEndian:
+		return ParseAt(b, 0)
+	case binary.BigEndian:
+		swapped, err := swapByteOrder(b, order)
+		if err != nil {
+			return nil, err
+		}
+		return ParseAt(swapped, 0)
+	}
+	return nil, fmt.Errorf("Unsupported byte order %s", order)
+}
+
+// swapper reverses the bytes of fields of src in a copy, reading their
+// values in order. The first error sticks, later reads return 0.
+type swapper struct {
+	src   []byte
+	out   []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (s *swapper) field(off uint64, size int) bool {
+	if s.err != nil {
+		return false
+	}
+
+	if off+uint64(size) > uint64(len(s.src)) {
+		s.err = fmt.Errorf("Invalid offset %x", off)
+		return false
+	}
+
+	for i := 0; i < size; i++ {
+		s.out[off+uint64(i)] = s.src[off+uint64(size-1-i)]
+	}
+	return true
+}
+
+func (s *swapper) u16(off uint64) uint16 {
+	if !s.field(off, 2) {
+		return 0
+	}
+	return s.order.Uint16(s.src[off:])
+}
+
+func (s *swapper) u32(off uint64) uint32 {
+	if !s.field(off, 4) {
+		return 0
+	}
+	return s.order.Uint32(s.src[off:])
+}
+
+// list swaps a uint size followed by size entries of the given widths,
+// returning the offset after them.
+func (s *swapper) list(off uint64, widths ...int) uint64 {
+	size := uint64(s.u32(off))
+	off += 4
+	for i := uint64(0); i < size && s.err == nil; i++ {
+		for _, width := range widths {
+			s.field(off, width)
+			off += uint64(width)
+		}
+	}
+	return off
+}
+
+// swapByteOrder returns a copy of the dex in b, stored in order, with its
+// fixed size fields in the other byte order.
+func swapByteOrder(b []byte, order binary.ByteOrder) ([]byte, error) {
+	if len(b) < 0x70 {
+		return nil, fmt.Errorf("Invalid dex size %d", len(b))
+	}
+
+	s := &swapper{src: b, out: append([]byte{}, b...), order: order}
+
+	// checksum, then file size up to the data offset
+	s.u32(8)
+	for off := uint64(32); off < 0x70; off += 4 {
+		s.u32(off)
+	}
+
+	section := func(sizeOff, offOff uint64) (uint64, uint64) {
+		return uint64(order.Uint32(b[sizeOff:])), uint64(order.Uint32(b[offOff:]))
+	}
+
+	ids := []struct {
+		sizeOff uint64
+		widths  []int
+	}{
+		{56, []int{4}},                      // string_ids
+		{64, []int{4}},                      // type_ids
+		{72, []int{4, 4, 4}},                // proto_ids
+		{80, []int{2, 2, 4}},                // field_ids
+		{88, []int{2, 2, 4}},                // method_ids
+		{96, []int{4, 4, 4, 4, 4, 4, 4, 4}}, // class_defs
+	}
+	for _, id := range ids {
+		size, off := section(id.sizeOff, id.sizeOff+4)
+		for i := uint64(0); i < size && s.err == nil; i++ {
+			for _, width := range id.widths {
+				s.field(off, width)
+				off += uint64(width)
+			}
+		}
+	}
+
+	mapOff := uint64(order.Uint32(b[52:]))
+	if mapOff == 0 {
+		return s.out, s.err
+	}
+
+	items := uint64(s.u32(mapOff))
+	for i := uint64(0); i < items && s.err == nil; i++ {
+		item := mapOff + 4 + i*12
+		itemType := s.u16(item)
+		s.u16(item + 2)
+		size := uint64(s.u32(item + 4))
+		off := uint64(s.u32(item + 8))
+
+		for j := uint64(0); j < size && s.err == nil; j++ {
+			switch itemType {
+			case TYPE_TYPE_LIST:
+				off = s.list((off+3)&^3, 2)
+			case TYPE_ANNOTATION_SET_REF_LIST, TYPE_ANNOTATION_SET_ITEM:
+				off = s.list((off+3)&^3, 4)
+			case TYPE_ANNOTATIONS_DIRECTORY_ITEM:
+				off = (off + 3) &^ 3
+				s.u32(off)
+				members := uint64(s.u32(off+4)) + uint64(s.u32(off+8)) + uint64(s.u32(off+12))
+				off += 16
+				for k := uint64(0); k < members*2 && s.err == nil; k++ {
+					s.u32(off)
+					off += 4
+				}
+			case TYPE_CODE_ITEM:
+				off = s.codeItem((off + 3) &^ 3)
+			case TYPE_CALL_SITE_ID_ITEM:
+				s.u32(off)
+				off += 4
+			case TYPE_METHOD_HANDLE_ITEM:
+				for k := uint64(0); k < 4; k++ {
+					s.u16(off + k*2)
+				}
+				off += 8
+			case TYPE_HIDDENAPI_CLASS_DATA_ITEM:
+				s.u32(off)
+				classes := uint64(order.Uint32(b[100:]))
+				for k := uint64(0); k < classes && s.err == nil; k++ {
+					s.u32(off + 4 + k*4)
+				}
+			}
+		}
+	}
+	return s.out, s.err
+}
+
+// codeItem swaps the code_item at off and returns the offset after it.
+// Instructions are swapped unit by unit, wider operands are stored as
+// units in little endian order either way.
+func (s *swapper) codeItem(off uint64) uint64 {
+	s.u16(off)
+	s.u16(off + 2)
+	s.u16(off + 4)
+	tries := uint64(s.u16(off + 6))
+	s.u32(off + 8)
+	insns := uint64(s.u32(off + 12))
+
+	off += 16
+	for i := uint64(0); i < insns && s.err == nil; i++ {
+		s.u16(off)
+		off += 2
+	}
+
+	if tries == 0 || s.err != nil {
+		return off
+	}
+
+	off = (off + 3) &^ 3
+	for i := uint64(0); i < tries && s.err == nil; i++ {
+		s.u32(off)
+		s.u16(off + 4)
+		s.u16(off + 6)
+		off += 8
+	}
+
+	if s.err != nil || off > uint64(len(s.src)) {
+		return off
+	}
+
+	_, length, err := readCatchHandlers(s.src[off:])
+	if err != nil {
+		s.err = err
+	}
+	return off + uint64(length)
+}
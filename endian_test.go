@@ -0,0 +1,47 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseWithOrder(t *testing.T) {
+	b := testUnsortedDEX().build()
+
+	// the fixture with all its fixed size fields byte swapped
+	swapped, err := swapByteOrder(b, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if binary.BigEndian.Uint32(swapped[40:]) != ENDIAN_CONSTANT {
+		t.Fatalf("Test failed %x %x", binary.BigEndian.Uint32(swapped[40:]), ENDIAN_CONSTANT)
+	}
+
+	if _, err := ParseWithOrder(swapped, binary.LittleEndian); err == nil {
+		t.Errorf("expected error parsing a big endian dex as little endian")
+	}
+
+	dex, err := ParseWithOrder(swapped, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !bytes.Equal(dex.Bytes(), b) {
+		t.Errorf("expected the converted dex to match the fixture")
+	}
+
+	if name := dex.Types[dex.Classes[0].ClassIdx].String(); name != "Lcom/example/Z;" {
+		t.Errorf("Test failed %s %s", name, "Lcom/example/Z;")
+	}
+
+	code, err := dex.Classes[0].ClassData.VirtualMethods[0].Code()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(code.Tries) != 1 || code.Tries[0].InsnCount != 2 {
+		t.Errorf("Test failed %v", code.Tries)
+	}
+}
@@ -0,0 +1,164 @@
+package godex
+
+// Implementors returns the classes that directly implement the interface
+// with the given descriptor, eg. Landroid/os/Parcelable;.
+func (d *DEX) Implementors(interfaceDescriptor string) []*ClassDefItem {
+	classes := []*ClassDefItem{}
+	for i := range d.Classes {
+		interfaces, err := d.Classes[i].Interfaces()
+		if err != nil {
+			continue
+		}
+
+		for _, descriptor := range interfaces {
+			if descriptor == interfaceDescriptor {
+				classes = append(classes, &d.Classes[i])
+				break
+			}
+		}
+	}
+	return classes
+}
+
+// Subclasses returns the classes whose superclass is the class with the
+// given descriptor.
+func (d *DEX) Subclasses(classDescriptor string) []*ClassDefItem {
+	classes := []*ClassDefItem{}
+	for i := range d.Classes {
+		c := &d.Classes[i]
+		if c.SuperclassIdx == NO_INDEX || int(c.SuperclassIdx) >= len(d.Types) {
+			continue
+		}
+
+		if d.Types[c.SuperclassIdx].String() == classDescriptor {
+			classes = append(classes, c)
+		}
+	}
+	return classes
+}
+
+// DescendantsOf returns all classes that directly or indirectly extend the
+// class with the given descriptor, nearest first.
+func (d *DEX) DescendantsOf(classDescriptor string) []*ClassDefItem {
+	descendants := []*ClassDefItem{}
+
+	seen := map[string]bool{classDescriptor: true}
+	queue := []string{classDescriptor}
+	for len(queue) > 0 {
+		subclasses := d.Subclasses(queue[0])
+		queue = queue[1:]
+
+		for _, c := range subclasses {
+			t, err := d.TypeAt(c.ClassIdx)
+			if err != nil {
+				continue
+			}
+
+			descriptor := t.String()
+			if seen[descriptor] {
+				continue
+			}
+
+			seen[descriptor] = true
+			descendants = append(descendants, c)
+			queue = append(queue, descriptor)
+		}
+	}
+	return descendants
+}
+
+// Hierarchy is the graph of the classes defined in a dex and the types
+// they extend or implement. Superclasses and interfaces defined elsewhere
+// are leaf nodes without parents.
+type Hierarchy struct {
+	defined  map[string]bool
+	parents  map[string][]string
+	children map[string][]string
+}
+
+// TypeHierarchy builds the hierarchy of the classes in the dex from their
+// superclasses and interfaces.
+func (d *DEX) TypeHierarchy() *Hierarchy {
+	h := &Hierarchy{
+		defined:  map[string]bool{},
+		parents:  map[string][]string{},
+		children: map[string][]string{},
+	}
+
+	for i := range d.Classes {
+		c := &d.Classes[i]
+		if int(c.ClassIdx) >= len(d.Types) {
+			continue
+		}
+
+		descriptor := d.Types[c.ClassIdx].String()
+		h.defined[descriptor] = true
+
+		parents := []string{}
+		if c.SuperclassIdx != NO_INDEX && int(c.SuperclassIdx) < len(d.Types) {
+			parents = append(parents, d.Types[c.SuperclassIdx].String())
+		}
+
+		interfaces, _ := c.Interfaces()
+		parents = append(parents, interfaces...)
+
+		for _, parent := range parents {
+			h.parents[descriptor] = append(h.parents[descriptor], parent)
+			h.children[parent] = append(h.children[parent], descriptor)
+		}
+	}
+	return h
+}
+
+// Defined reports whether the class is defined in the dex, rather than
+// only referenced as a superclass or interface.
+func (h *Hierarchy) Defined(descriptor string) bool {
+	return h.defined[descriptor]
+}
+
+// Parents returns the superclass, followed by the interfaces, of the class.
+func (h *Hierarchy) Parents(descriptor string) []string {
+	return h.parents[descriptor]
+}
+
+// Children returns the classes that directly extend or implement the
+// class.
+func (h *Hierarchy) Children(descriptor string) []string {
+	return h.children[descriptor]
+}
+
+// Ancestors returns all superclasses and interfaces of the class, directly
+// or indirectly, nearest first.
+func (h *Hierarchy) Ancestors(descriptor string) []string {
+	return walk(descriptor, h.parents)
+}
+
+// Descendants returns all classes that directly or indirectly extend or
+// implement the class, nearest first.
+func (h *Hierarchy) Descendants(descriptor string) []string {
+	return walk(descriptor, h.children)
+}
+
+// walk returns the nodes reachable from start through edges, breadth
+// first.
+func walk(start string, edges map[string][]string) []string {
+	nodes := []string{}
+
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		next := edges[queue[0]]
+		queue = queue[1:]
+
+		for _, node := range next {
+			if seen[node] {
+				continue
+			}
+
+			seen[node] = true
+			nodes = append(nodes, node)
+			queue = append(queue, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,112 @@
+package godex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImplementors(t *testing.T) {
+	b := &testDex{}
+	parcelable := b.typ("Landroid/os/Parcelable;")
+	runnable := b.typ("Ljava/lang/Runnable;")
+
+	b.class("Lcom/example/A;", "Ljava/lang/Object;").interfaces = []uint16{parcelable}
+	b.class("Lcom/example/B;", "Ljava/lang/Object;").interfaces = []uint16{runnable, parcelable}
+	b.class("Lcom/example/C;", "Ljava/lang/Object;").interfaces = []uint16{runnable}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	classes := dex.Implementors("Landroid/os/Parcelable;")
+	if len(classes) != 2 {
+		t.Fatalf("Test failed %d %d", len(classes), 2)
+	}
+
+	for i, want := range []string{"Lcom/example/A;", "Lcom/example/B;"} {
+		if name := dex.Types[classes[i].ClassIdx].String(); name != want {
+			t.Errorf("Test failed %s %s", name, want)
+		}
+	}
+}
+
+func TestSubclasses(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Animal;", "Ljava/lang/Object;")
+	b.class("Lcom/example/Dog;", "Lcom/example/Animal;")
+	b.class("Lcom/example/Puppy;", "Lcom/example/Dog;")
+	b.class("Lcom/example/Cat;", "Lcom/example/Animal;")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	names := func(classes []*ClassDefItem) []string {
+		s := []string{}
+		for _, c := range classes {
+			s = append(s, dex.Types[c.ClassIdx].String())
+		}
+		return s
+	}
+
+	want := []string{"Lcom/example/Dog;", "Lcom/example/Cat;"}
+	if classes := names(dex.Subclasses("Lcom/example/Animal;")); !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+
+	want = []string{"Lcom/example/Dog;", "Lcom/example/Cat;", "Lcom/example/Puppy;"}
+	if classes := names(dex.DescendantsOf("Lcom/example/Animal;")); !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+
+	if classes := dex.DescendantsOf("Lcom/example/Puppy;"); len(classes) != 0 {
+		t.Errorf("Test failed %d %d", len(classes), 0)
+	}
+
+	// a class with an invalid class_idx is skipped
+	dex.Classes[3].ClassIdx = 999
+	want = []string{"Lcom/example/Dog;", "Lcom/example/Puppy;"}
+	if classes := names(dex.DescendantsOf("Lcom/example/Animal;")); !reflect.DeepEqual(classes, want) {
+		t.Errorf("Test failed %v %v", classes, want)
+	}
+}
+
+func TestTypeHierarchy(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Animal;", "Ljava/lang/Object;")
+	b.class("Lcom/example/Dog;", "Lcom/example/Animal;").interfaces = []uint16{b.typ("Ljava/lang/Runnable;")}
+	b.class("Lcom/example/Puppy;", "Lcom/example/Dog;")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	h := dex.TypeHierarchy()
+
+	want := []string{"Lcom/example/Dog;", "Lcom/example/Animal;", "Ljava/lang/Runnable;", "Ljava/lang/Object;"}
+	if ancestors := h.Ancestors("Lcom/example/Puppy;"); !reflect.DeepEqual(ancestors, want) {
+		t.Errorf("Test failed %v %v", ancestors, want)
+	}
+
+	want = []string{"Lcom/example/Animal;", "Lcom/example/Dog;", "Lcom/example/Puppy;"}
+	if descendants := h.Descendants("Ljava/lang/Object;"); !reflect.DeepEqual(descendants, want) {
+		t.Errorf("Test failed %v %v", descendants, want)
+	}
+
+	want = []string{"Lcom/example/Dog;", "Lcom/example/Puppy;"}
+	if descendants := h.Descendants("Ljava/lang/Runnable;"); !reflect.DeepEqual(descendants, want) {
+		t.Errorf("Test failed %v %v", descendants, want)
+	}
+
+	// external ancestors are leaves
+	if h.Defined("Ljava/lang/Object;") || len(h.Parents("Ljava/lang/Object;")) != 0 || len(h.Ancestors("Ljava/lang/Object;")) != 0 {
+		t.Errorf("Test failed %v %v", h.Parents("Ljava/lang/Object;"), []string{})
+	}
+
+	if !h.Defined("Lcom/example/Puppy;") || len(h.Descendants("Lcom/example/Puppy;")) != 0 {
+		t.Errorf("Test failed %v %v", h.Descendants("Lcom/example/Puppy;"), []string{})
+	}
+}
@@ -0,0 +1,112 @@
+package godex
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// IndexError is returned when an index into one of the id pools is out of
+// range, Max is the size of the pool.
+type IndexError struct {
+	Kind  string
+	Index uint32
+	Max   int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("Invalid %s index %d, max %d", e.Kind, e.Index, e.Max)
+}
+
+// StringAt returns string idx of the string pool. Strings not decoded by
+// DecodeStrings are decoded on first access and cached.
+func (d *DEX) StringAt(idx uint32) (string, error) {
+	if int64(idx) >= int64(d.StringCount()) {
+		return "", &IndexError{Kind: "string", Index: idx, Max: d.StringCount()}
+	}
+
+	if d.Strings != nil {
+		return d.Strings[idx], nil
+	}
+
+	d.stringsMu.Lock()
+	defer d.stringsMu.Unlock()
+
+	if d.lazyDecoded[idx] {
+		return d.lazyStrings[idx], nil
+	}
+
+	s, err := d.decodeString(idx)
+	if err != nil {
+		return "", err
+	}
+
+	d.lazyStrings[idx] = s
+	d.lazyDecoded[idx] = true
+	return s, nil
+}
+
+// searchString returns the index of s in the string pool by a binary
+// search, decoding only the strings it compares. The pool must be sorted
+// by UTF-16 code units, as the format requires.
+func (d *DEX) searchString(s string) (int, bool) {
+	units := utf16.Encode([]rune(s))
+
+	lo, hi := 0, d.StringCount()
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		v, err := d.StringAt(uint32(mid))
+		if err != nil {
+			return 0, false
+		}
+
+		switch c := compareUint16s(utf16.Encode([]rune(v)), units); {
+		case c == 0:
+			return mid, true
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+// StringCount returns the size of the string pool.
+func (d *DEX) StringCount() int {
+	if d.Strings != nil {
+		return len(d.Strings)
+	}
+	return len(d.lazyStrings)
+}
+
+// TypeAt returns type idx of the type pool.
+func (d *DEX) TypeAt(idx uint32) (*TypeId, error) {
+	if int64(idx) >= int64(len(d.Types)) {
+		return nil, &IndexError{Kind: "type", Index: idx, Max: len(d.Types)}
+	}
+	return &d.Types[idx], nil
+}
+
+// ProtoAt returns prototype idx of the proto pool.
+func (d *DEX) ProtoAt(idx uint32) (*ProtoIdItem, error) {
+	if int64(idx) >= int64(len(d.Prototypes)) {
+		return nil, &IndexError{Kind: "proto", Index: idx, Max: len(d.Prototypes)}
+	}
+	return &d.Prototypes[idx], nil
+}
+
+// FieldAt returns field idx of the field pool.
+func (d *DEX) FieldAt(idx uint32) (*FieldIdItem, error) {
+	if int64(idx) >= int64(len(d.Fields)) {
+		return nil, &IndexError{Kind: "field", Index: idx, Max: len(d.Fields)}
+	}
+	return &d.Fields[idx], nil
+}
+
+// MethodAt returns method idx of the method pool.
+func (d *DEX) MethodAt(idx uint32) (*MethodIdItem, error) {
+	if int64(idx) >= int64(len(d.Methods)) {
+		return nil, &IndexError{Kind: "method", Index: idx, Max: len(d.Methods)}
+	}
+	return &d.Methods[idx], nil
+}
@@ -0,0 +1,135 @@
+package godex
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestIndexError(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if s, err := dex.StringAt(0); err != nil || s != "Lcom/example/Hello;" {
+		t.Errorf("Test failed %s %v", s, err)
+	}
+
+	_, err = dex.MethodAt(1000)
+
+	var indexErr *IndexError
+	if !errors.As(err, &indexErr) {
+		t.Fatalf("Test failed %v %v", err, &IndexError{})
+	}
+
+	if indexErr.Kind != "method" || indexErr.Index != 1000 || indexErr.Max != len(dex.Methods) {
+		t.Errorf("Test failed %v %v", indexErr, &IndexError{Kind: "method", Index: 1000, Max: len(dex.Methods)})
+	}
+
+	for _, err := range []error{
+		func() error { _, err := dex.StringAt(uint32(dex.StringCount())); return err }(),
+		func() error { _, err := dex.TypeAt(uint32(len(dex.Types))); return err }(),
+		func() error { _, err := dex.ProtoAt(uint32(len(dex.Prototypes))); return err }(),
+		func() error { _, err := dex.FieldAt(uint32(len(dex.Fields))); return err }(),
+	} {
+		if !errors.As(err, &indexErr) {
+			t.Errorf("Test failed %v %v", err, &IndexError{})
+		}
+	}
+}
+
+// testManyStringsDEX returns a dex with a string pool of more than n
+// strings.
+func testManyStringsDEX(n int) []byte {
+	t := testHelloDEX()
+	for i := 0; i < n; i++ {
+		// appended directly, str searches the pool for duplicates
+		t.strings = append(t.strings, fmt.Sprintf("string %d ünïcode", i))
+	}
+	return t.build()
+}
+
+func TestLazyStrings(t *testing.T) {
+	buf := testManyStringsDEX(100)
+
+	eager, err := ParseAtWith(buf, 0, ParseOptions{EagerStrings: true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	lazy, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if lazy.Strings != nil {
+		t.Errorf("Test failed %d %d", len(lazy.Strings), 0)
+	}
+
+	if lazy.StringCount() != len(eager.Strings) {
+		t.Fatalf("Test failed %d %d", lazy.StringCount(), len(eager.Strings))
+	}
+
+	// decode backwards, so the cache is filled out of order
+	for i := len(eager.Strings) - 1; i >= 0; i-- {
+		s, err := lazy.StringAt(uint32(i))
+		if err != nil || s != eager.Strings[i] {
+			t.Errorf("Test failed %q %q", s, eager.Strings[i])
+		}
+	}
+
+	if err := lazy.DecodeStrings(); err != nil || !reflect.DeepEqual(lazy.Strings, eager.Strings) {
+		t.Errorf("Test failed %v %v", lazy.Strings, eager.Strings)
+	}
+}
+
+func TestLazyMethodIndex(t *testing.T) {
+	dex, err := ParseAt(testManyClassesDEX(100), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	decoded := func() int {
+		n := 0
+		for _, ok := range dex.lazyDecoded {
+			if ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := decoded(); n != 0 || dex.methodIndex != nil {
+		t.Errorf("Test failed %d %d", n, 0)
+	}
+
+	if idx, ok := dex.FindMethod("Lcom/example/C0042;", "run", "()V"); !ok || dex.Methods[idx].Class() != "Lcom/example/C0042;" {
+		t.Errorf("Test failed %d %v", idx, ok)
+	}
+
+	if n := decoded(); n == 0 {
+		t.Errorf("expected FindMethod to decode the method names")
+	}
+}
+
+func BenchmarkParseLazyStrings(b *testing.B) {
+	buf := testManyClassesDEX(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseAt(buf, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseEagerStrings(b *testing.B) {
+	buf := testManyClassesDEX(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseAtWith(buf, 0, ParseOptions{EagerStrings: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package godex
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	urlPattern    = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'<>]+`)
+	ipPattern     = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\b`)
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:com|net|org|info|biz|io|co|me|ru|cn|su|tk|top|xyz|onion)\b`)
+	base64Pattern = regexp.MustCompile(`^[A-Za-z0-9+/]{20,}={0,2}$`)
+)
+
+// Indicators are the network indicators and encoded blobs found in the
+// string pool, each list sorted and without duplicates.
+type Indicators struct {
+	URLs    []string
+	IPs     []string
+	Domains []string
+	Base64  []string
+	// Custom holds the matches of IndicatorOptions.Patterns by name
+	Custom map[string][]string
+}
+
+type IndicatorOptions struct {
+	// Patterns are matched against every string in addition to the
+	// built-in ones.
+	Patterns map[string]*regexp.Regexp
+}
+
+// ExtractIndicators scans the string pool for URLs, IP addresses, domain
+// names and base64 looking strings, see ExtractIndicatorsWith.
+func (d *DEX) ExtractIndicators() Indicators {
+	return d.ExtractIndicatorsWith(IndicatorOptions{})
+}
+
+// ExtractIndicatorsWith is ExtractIndicators with extra patterns. Domains
+// are only recognized for a small set of common top level domains, as
+// java class names look like domains too, and names of packages or
+// classes of the dex, eg. java.io, are left out.
+func (d *DEX) ExtractIndicatorsWith(opts IndicatorOptions) Indicators {
+	packages := d.packageNames()
+
+	found := map[string]map[string]bool{}
+	add := func(kind string, matches []string) {
+		if found[kind] == nil {
+			found[kind] = map[string]bool{}
+		}
+		for _, match := range matches {
+			found[kind][match] = true
+		}
+	}
+
+	for i := 0; i < d.StringCount(); i++ {
+		s, err := d.StringAt(uint32(i))
+		if err != nil {
+			continue
+		}
+
+		add("url", urlPattern.FindAllString(s, -1))
+		add("ip", ipPattern.FindAllString(s, -1))
+		for _, match := range domainPattern.FindAllString(s, -1) {
+			if !packages[match] {
+				add("domain", []string{match})
+			}
+		}
+
+		if len(s)%4 == 0 && base64Pattern.MatchString(s) {
+			if _, err := base64.StdEncoding.DecodeString(s); err == nil {
+				add("base64", []string{s})
+			}
+		}
+
+		for name, pattern := range opts.Patterns {
+			add("custom:"+name, pattern.FindAllString(s, -1))
+		}
+	}
+
+	indicators := Indicators{
+		URLs:    sortedKeys(found["url"]),
+		IPs:     sortedKeys(found["ip"]),
+		Domains: sortedKeys(found["domain"]),
+		Base64:  sortedKeys(found["base64"]),
+		Custom:  map[string][]string{},
+	}
+
+	for name := range opts.Patterns {
+		indicators.Custom[name] = sortedKeys(found["custom:"+name])
+	}
+	return indicators
+}
+
+// packageNames returns the java names of the types of the dex and of
+// their packages, eg. java, java.io and java.io.File for Ljava/io/File;.
+func (d *DEX) packageNames() map[string]bool {
+	names := map[string]bool{}
+	for i := range d.Types {
+		descriptor := strings.TrimLeft(d.Types[i].String(), "[")
+		if !strings.HasPrefix(descriptor, "L") {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSuffix(descriptor[1:], ";"), "/")
+		for j := range parts {
+			names[strings.Join(parts[:j+1], ".")] = true
+		}
+	}
+	return names
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
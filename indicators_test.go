@@ -0,0 +1,47 @@
+package godex
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestExtractIndicators(t *testing.T) {
+	b := testHelloDEX()
+	b.str("http://evil.example.com/gate.php?id=1")
+	b.str("connect 192.168.13.37:4444")
+	b.str("aGVsbG8gd29ybGQsIGhlbGxvIGdvZGV4")
+	b.str("bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT")
+	// a class name for reflection, not a domain
+	b.str("java.io.File")
+	b.typ("Ljava/io/File;")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	indicators := dex.ExtractIndicatorsWith(IndicatorOptions{
+		Patterns: map[string]*regexp.Regexp{"bitcoin": regexp.MustCompile(`\b[13][a-km-zA-HJ-NP-Z1-9]{25,34}\b`)},
+	})
+
+	if want := []string{"http://evil.example.com/gate.php?id=1"}; !reflect.DeepEqual(indicators.URLs, want) {
+		t.Errorf("Test failed %v %v", indicators.URLs, want)
+	}
+
+	if want := []string{"192.168.13.37"}; !reflect.DeepEqual(indicators.IPs, want) {
+		t.Errorf("Test failed %v %v", indicators.IPs, want)
+	}
+
+	if want := []string{"evil.example.com"}; !reflect.DeepEqual(indicators.Domains, want) {
+		t.Errorf("Test failed %v %v", indicators.Domains, want)
+	}
+
+	if want := []string{"aGVsbG8gd29ybGQsIGhlbGxvIGdvZGV4"}; !reflect.DeepEqual(indicators.Base64, want) {
+		t.Errorf("Test failed %v %v", indicators.Base64, want)
+	}
+
+	if want := []string{"1BoatSLRHtKNngkdXEeobR76b53LETtpyT"}; !reflect.DeepEqual(indicators.Custom["bitcoin"], want) {
+		t.Errorf("Test failed %v %v", indicators.Custom["bitcoin"], want)
+	}
+}
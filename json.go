@@ -0,0 +1,133 @@
+package godex
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonMember struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	AccessFlags uint32 `json:"access_flags"`
+}
+
+type jsonClass struct {
+	Name        string       `json:"name"`
+	Superclass  string       `json:"superclass,omitempty"`
+	AccessFlags uint32       `json:"access_flags"`
+	Interfaces  []string     `json:"interfaces"`
+	Fields      []jsonMember `json:"fields"`
+	Methods     []jsonMember `json:"methods"`
+}
+
+// EncodeJSON writes the dex as a json object with its header, strings and
+// classes to w. The strings and classes are encoded one at a time, so the
+// whole document is never held in memory.
+func (d *DEX) EncodeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, `{"header":`); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(d.header); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `,"strings":[`); err != nil {
+		return err
+	}
+
+	for i := 0; i < d.StringCount(); i++ {
+		s, err := d.StringAt(uint32(i))
+		if err != nil {
+			return err
+		}
+
+		if err := encodeElement(w, enc, i, s); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, `],"classes":[`); err != nil {
+		return err
+	}
+
+	for i := range d.Classes {
+		class, err := d.jsonClass(&d.Classes[i])
+		if err != nil {
+			return err
+		}
+
+		if err := encodeElement(w, enc, i, class); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+// encodeElement writes the i'th element of a json array.
+func encodeElement(w io.Writer, enc *json.Encoder, i int, v interface{}) error {
+	if i > 0 {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	return enc.Encode(v)
+}
+
+func (d *DEX) jsonClass(c *ClassDefItem) (*jsonClass, error) {
+	interfaces, err := c.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := d.TypeAt(c.ClassIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	class := &jsonClass{
+		Name:        name.String(),
+		AccessFlags: uint32(c.AccessFlags),
+		Interfaces:  append([]string{}, interfaces...),
+		Fields:      []jsonMember{},
+		Methods:     []jsonMember{},
+	}
+
+	if c.SuperclassIdx != NO_INDEX {
+		super, err := d.TypeAt(c.SuperclassIdx)
+		if err != nil {
+			return nil, err
+		}
+		class.Superclass = super.String()
+	}
+
+	for _, fields := range [][]EncodedField{c.ClassData.StaticFields, c.ClassData.InstanceFields} {
+		for _, f := range fields {
+			class.Fields = append(class.Fields, jsonMember{
+				Name:        f.Field.String(),
+				Type:        f.Field.Type(),
+				AccessFlags: uint32(f.AccessFlags),
+			})
+		}
+	}
+
+	for _, methods := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+		for _, m := range methods {
+			descriptor, err := d.Prototypes[m.Method.ProtoIdx].descriptor()
+			if err != nil {
+				return nil, err
+			}
+
+			class.Methods = append(class.Methods, jsonMember{
+				Name:        m.Method.Name(),
+				Type:        descriptor,
+				AccessFlags: uint32(m.AccessFlags),
+			})
+		}
+	}
+	return class, nil
+}
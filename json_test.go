@@ -0,0 +1,44 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	dex, err := ParseAt(testHelloDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dex.EncodeJSON(&buf); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var v struct {
+		Header  Header
+		Strings []string
+		Classes []jsonClass
+	}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if v.Header != dex.header {
+		t.Errorf("Test failed %v %v", v.Header, dex.header)
+	}
+
+	if len(v.Strings) != dex.StringCount() {
+		t.Errorf("Test failed %d %d", len(v.Strings), dex.StringCount())
+	}
+
+	if len(v.Classes) != 1 || v.Classes[0].Name != "Lcom/example/Hello;" {
+		t.Fatalf("Test failed %v %v", v.Classes, "Lcom/example/Hello;")
+	}
+
+	if m := v.Classes[0].Methods[0]; m.Name != "<init>" || m.Type != "()V" {
+		t.Errorf("Test failed %v %v", m, jsonMember{Name: "<init>", Type: "()V"})
+	}
+}
@@ -0,0 +1,77 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Item types of the map_list.
+const (
+	TYPE_HEADER_ITEM                = 0x0000
+	TYPE_STRING_ID_ITEM             = 0x0001
+	TYPE_TYPE_ID_ITEM               = 0x0002
+	TYPE_PROTO_ID_ITEM              = 0x0003
+	TYPE_FIELD_ID_ITEM              = 0x0004
+	TYPE_METHOD_ID_ITEM             = 0x0005
+	TYPE_CLASS_DEF_ITEM             = 0x0006
+	TYPE_CALL_SITE_ID_ITEM          = 0x0007
+	TYPE_METHOD_HANDLE_ITEM         = 0x0008
+	TYPE_MAP_LIST                   = 0x1000
+	TYPE_TYPE_LIST                  = 0x1001
+	TYPE_ANNOTATION_SET_REF_LIST    = 0x1002
+	TYPE_ANNOTATION_SET_ITEM        = 0x1003
+	TYPE_CLASS_DATA_ITEM            = 0x2000
+	TYPE_CODE_ITEM                  = 0x2001
+	TYPE_STRING_DATA_ITEM           = 0x2002
+	TYPE_DEBUG_INFO_ITEM            = 0x2003
+	TYPE_ANNOTATION_ITEM            = 0x2004
+	TYPE_ENCODED_ARRAY_ITEM         = 0x2005
+	TYPE_ANNOTATIONS_DIRECTORY_ITEM = 0x2006
+	TYPE_HIDDENAPI_CLASS_DATA_ITEM  = 0xF000
+)
+
+type MapItem struct {
+	Type   uint16 `pack:"ushort"`
+	Unused uint16 `pack:"ushort"`
+	// Size is the number of items in the section
+	Size   uint32 `pack:"uint"`
+	Offset uint32 `pack:"uint"`
+}
+
+func (d *DEX) readMapList() error {
+	d.Map = nil
+
+	off := d.header.MapOff
+	if off == 0 {
+		return nil
+	}
+
+	if uint64(off)+4 > uint64(len(d.b)) {
+		return fmt.Errorf("Invalid map offset %x", off)
+	}
+
+	size := binary.LittleEndian.Uint32(d.b[off:])
+	if err := d.checkSection("map", off+4, size, 12); err != nil {
+		return err
+	}
+
+	d.Map = make([]MapItem, size)
+	for i := range d.Map {
+		if _, err := Unpack(d.b[uint64(off)+4+uint64(i)*12:], &d.Map[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SectionOffset returns the offset and number of items of the section of
+// itemType, eg. TYPE_CODE_ITEM, as declared by the map list. Many data
+// sections are only found through the map.
+func (d *DEX) SectionOffset(itemType uint16) (uint32, uint32, bool) {
+	for _, item := range d.Map {
+		if item.Type == itemType {
+			return item.Offset, item.Size, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,77 @@
+package godex
+
+import (
+	"fmt"
+	"strings"
+)
+
+type NativeMethod struct {
+	Class  string
+	Name   string
+	Method *EncodedMethod
+	// Symbol is the short JNI symbol, eg. Java_com_foo_Bar_baz
+	Symbol string
+	// OverloadedSymbol is the JNI symbol including the argument
+	// signature, used when a native method is overloaded.
+	OverloadedSymbol string
+}
+
+// NativeMethods returns all methods declared native, together with the
+// JNI symbols the runtime will look for in native libraries. Methods whose
+// prototype cannot be read are left out.
+func (d *DEX) NativeMethods() []NativeMethod {
+	natives := []NativeMethod{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		if !m.AccessFlags.Has(ACC_NATIVE) {
+			return nil
+		}
+
+		descriptor, err := d.Prototypes[m.Method.ProtoIdx].descriptor()
+		if err != nil {
+			return nil
+		}
+
+		// the argument signature is the descriptor without its return type
+		signature := descriptor[1:strings.LastIndex(descriptor, ")")]
+
+		class := m.Method.Class()
+		name := m.Method.Name()
+		symbol := "Java_" + jniMangle(strings.TrimSuffix(strings.TrimPrefix(class, "L"), ";")) + "_" + jniMangle(name)
+
+		natives = append(natives, NativeMethod{
+			Class:            class,
+			Name:             name,
+			Method:           m,
+			Symbol:           symbol,
+			OverloadedSymbol: symbol + "__" + jniMangle(signature),
+		})
+		return nil
+	})
+	return natives
+}
+
+// jniMangle escapes a name following the JNI symbol mangling rules.
+func jniMangle(name string) string {
+	mangled := ""
+	for _, r := range name {
+		switch {
+		case r == '/':
+			mangled += "_"
+		case r == '_':
+			mangled += "_1"
+		case r == ';':
+			mangled += "_2"
+		case r == '[':
+			mangled += "_3"
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			mangled += string(r)
+		case r > 0xffff:
+			// encoded as a utf-16 surrogate pair
+			r -= 0x10000
+			mangled += fmt.Sprintf("_0%04x_0%04x", 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		default:
+			mangled += fmt.Sprintf("_0%04x", r)
+		}
+	}
+	return mangled
+}
@@ -0,0 +1,50 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestNativeMethods(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/foo/Bar;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{idx: b.method("Lcom/foo/Bar;", "native_init", "V", "I", "Ljava/lang/String;"), flags: ACC_PRIVATE | ACC_STATIC | ACC_NATIVE},
+		{idx: b.method("Lcom/foo/Bar;", "helper", "V"), flags: ACC_PRIVATE | ACC_STATIC, code: &testCode{insns: []uint16{0x000e}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	natives := dex.NativeMethods()
+	if len(natives) != 1 {
+		t.Fatalf("Test failed %d %d", len(natives), 1)
+	}
+
+	if natives[0].Symbol != "Java_com_foo_Bar_native_1init" {
+		t.Errorf("Test failed %s %s", natives[0].Symbol, "Java_com_foo_Bar_native_1init")
+	}
+
+	if natives[0].OverloadedSymbol != "Java_com_foo_Bar_native_1init__ILjava_lang_String_2" {
+		t.Errorf("Test failed %s %s", natives[0].OverloadedSymbol, "Java_com_foo_Bar_native_1init__ILjava_lang_String_2")
+	}
+}
+
+func TestNativeMethodsInvalidProto(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/foo/Bar;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{idx: b.method("Lcom/foo/Bar;", "native_init", "V", "I"), flags: ACC_PRIVATE | ACC_STATIC | ACC_NATIVE},
+	}
+	b.protos[0].params[0] = 999
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if natives := dex.NativeMethods(); len(natives) != 0 {
+		t.Errorf("Test failed %d %d", len(natives), 0)
+	}
+}
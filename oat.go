@@ -0,0 +1,93 @@
+package godex
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+var oatMagic = []byte("oat\n")
+
+// OpenOAT parses the dex files embedded in the OAT file at path. An OAT
+// file is an ELF shared object whose oatdata symbol marks the OAT header,
+// followed by the original dex files and the compiled code. Since Android
+// 8 the dex files are stored in a separate vdex file instead, open that
+// with Open or ScanForDex.
+func OpenOAT(path string) ([]*DEX, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	symbols, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, symbol := range symbols {
+		if symbol.Name != "oatdata" {
+			continue
+		}
+
+		if int(symbol.Section) >= len(f.Sections) {
+			return nil, fmt.Errorf("Invalid oatdata section %d", symbol.Section)
+		}
+
+		section := f.Sections[symbol.Section]
+		if symbol.Value < section.Addr || symbol.Value-section.Addr > section.Size {
+			return nil, fmt.Errorf("Invalid oatdata address %x", symbol.Value)
+		}
+
+		start := section.Offset + (symbol.Value - section.Addr)
+		end := section.Offset + section.Size
+		if symbol.Size != 0 && start+symbol.Size < end {
+			end = start + symbol.Size
+		}
+
+		if end > uint64(len(b)) {
+			return nil, fmt.Errorf("Invalid oatdata size %d", end-start)
+		}
+		return parseOATData(b[start:end])
+	}
+	return nil, fmt.Errorf("No oatdata symbol")
+}
+
+// parseOATData parses the dex files following the OAT header in b. The
+// layout of the header and of the dex file entries changes with every
+// version, so the dex files are found by their magic and only the dex
+// file count, which has stayed in place, is read.
+func parseOATData(b []byte) ([]*DEX, error) {
+	if len(b) < 24 || !bytes.HasPrefix(b, oatMagic) {
+		return nil, fmt.Errorf("Invalid OAT header")
+	}
+
+	count := int(binary.LittleEndian.Uint32(b[20:24]))
+
+	dexes := []*DEX{}
+	next := 0
+	for _, off := range ScanForDex(b) {
+		// the magic may appear within a dex, eg. in its strings
+		if len(dexes) == count || off < next {
+			continue
+		}
+
+		dex, err := ParseAt(b, off)
+		if err != nil {
+			continue
+		}
+		dexes = append(dexes, dex)
+		next = off + int(dex.header.FileSize)
+	}
+
+	if len(dexes) == 0 && count > 0 {
+		return nil, fmt.Errorf("No dex files in OAT version %s, they may be in a vdex file", bytes.TrimRight(b[4:8], "\x00"))
+	}
+	return dexes, nil
+}
@@ -0,0 +1,57 @@
+package godex
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOATData(t *testing.T) {
+	dex := testHelloDEX().build()
+
+	header := make([]byte, 0x40)
+	copy(header, "oat\n124\x00")
+	binary.LittleEndian.PutUint32(header[20:], 2)
+
+	b := append(header, dex...)
+	b = append(b, dex...)
+	b = append(b, make([]byte, 0x10)...)
+
+	dexes, err := parseOATData(b)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(dexes) != 2 {
+		t.Fatalf("Test failed %d %d", len(dexes), 2)
+	}
+
+	for _, dex := range dexes {
+		if len(dex.Classes) != 1 {
+			t.Errorf("Test failed %d %d", len(dex.Classes), 1)
+		}
+	}
+
+	// the dex files of newer versions are in the vdex
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	if _, err := parseOATData(header); err == nil {
+		t.Errorf("expected an error for an OAT without dex files")
+	}
+}
+
+func TestOpenOAT(t *testing.T) {
+	path := filepath.Join("testdata", "boot.oat")
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("fixture %s not available", path)
+	}
+
+	dexes, err := OpenOAT(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(dexes) == 0 {
+		t.Errorf("Test failed %d", len(dexes))
+	}
+}
@@ -1,10 +1,13 @@
 package godex
 
 import (
-	_ "bytes"
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"unicode/utf16"
 )
 
 var (
@@ -13,6 +16,9 @@ var (
 	UbytePack   = RegisterPack("ubyte", PackFunc(unpackUbyte))
 	UshortPack  = RegisterPack("ushort", PackFunc(unpackUshort))
 	BytePack    = RegisterPack("byte", PackFunc(unpackByteArray))
+
+	UshortArrayPack = RegisterPack("ushortarray", PackFunc(unpackUshortArray))
+	UintArrayPack   = RegisterPack("uintarray", PackFunc(unpackUintArray))
 )
 
 type Pack struct {
@@ -33,18 +39,13 @@ func RegisterPack(name string, fn PackFunc) PackFunc {
 }
 
 func unpackUleb128(data []byte, val reflect.Value) (uint, error) {
-	i := uint32(0)
-
-	value := uint32(0)
-	for ; i < 5 && data[i]&0x80 == 0x80; i++ {
-		value += (uint32(data[i]&0x7F) << (7 * i))
+	value, length, err := readUleb128(data)
+	if err != nil {
+		return 0, err
 	}
 
-	value += (uint32(data[i]) << (7 * i))
-	i++
-
 	val.SetUint(uint64(value))
-	return uint(i), nil
+	return uint(length), nil
 }
 
 func unpackUint(data []byte, val reflect.Value) (uint, error) {
@@ -71,6 +72,35 @@ func unpackByteArray(data []byte, val reflect.Value) (uint, error) {
 	return 0, errors.New("Invalid field")
 }
 
+// unpackUshortArray reads a [N]uint16 of little endian elements.
+func unpackUshortArray(data []byte, val reflect.Value) (uint, error) {
+	return unpackArray(data, val, 2, func(b []byte) uint64 {
+		return uint64(binary.LittleEndian.Uint16(b))
+	})
+}
+
+// unpackUintArray reads a [N]uint32 of little endian elements.
+func unpackUintArray(data []byte, val reflect.Value) (uint, error) {
+	return unpackArray(data, val, 4, func(b []byte) uint64 {
+		return uint64(binary.LittleEndian.Uint32(b))
+	})
+}
+
+func unpackArray(data []byte, val reflect.Value, size int, read func([]byte) uint64) (uint, error) {
+	if val.Kind() != reflect.Array {
+		return 0, errors.New("Invalid field")
+	}
+
+	if len(data) < val.Len()*size {
+		return 0, errors.New("Invalid array length")
+	}
+
+	for i := 0; i < val.Len(); i++ {
+		val.Index(i).SetUint(read(data[i*size:]))
+	}
+	return uint(val.Len() * size), nil
+}
+
 func Unpack(b []byte, o interface{}) (int, error) {
 	offset := int(0)
 	st := reflect.ValueOf(o).Elem()
@@ -84,8 +114,11 @@ func Unpack(b []byte, o interface{}) (int, error) {
 		}
 
 		if p, ok := packs[tag]; ok {
-			length, _ := p(b[offset:], field)
-			// switch (retval.(type) or field.Kind())
+			length, err := p(b[offset:], field)
+			if err != nil {
+				return offset, err
+			}
+
 			offset += int(length)
 			continue
 		}
@@ -99,29 +132,266 @@ func Unpack(b []byte, o interface{}) (int, error) {
 	return offset, nil
 }
 
+var (
+	Uleb128ReaderPack = RegisterReaderPack("uleb128", ReaderPackFunc(readerUnpackUleb128))
+	UintReaderPack    = RegisterReaderPack("uint", fixedReaderPack(4, unpackUint))
+	UbyteReaderPack   = RegisterReaderPack("ubyte", fixedReaderPack(1, unpackUbyte))
+	UshortReaderPack  = RegisterReaderPack("ushort", fixedReaderPack(2, unpackUshort))
+	ByteReaderPack    = RegisterReaderPack("byte", ReaderPackFunc(readerUnpackByteArray))
+
+	UshortArrayReaderPack = RegisterReaderPack("ushortarray", arrayReaderPack(2, unpackUshortArray))
+	UintArrayReaderPack   = RegisterReaderPack("uintarray", arrayReaderPack(4, unpackUintArray))
+)
+
+var readerPacks = map[string]ReaderPackFunc{}
+
+// ReaderPackFunc is the streaming counterpart of PackFunc, it reads
+// exactly the bytes of one field from r.
+type ReaderPackFunc func(r io.Reader, val reflect.Value) (uint, error)
+
+func RegisterReaderPack(name string, fn ReaderPackFunc) ReaderPackFunc {
+	readerPacks[name] = fn
+	return fn
+}
+
+// fixedReaderPack adapts a PackFunc of a fixed size field for streaming.
+func fixedReaderPack(size int, fn PackFunc) ReaderPackFunc {
+	return func(r io.Reader, val reflect.Value) (uint, error) {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+		return fn(data, val)
+	}
+}
+
+func readerUnpackUleb128(r io.Reader, val reflect.Value) (uint, error) {
+	data := make([]byte, 0, 5)
+	b := make([]byte, 1)
+	for len(data) < 5 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return uint(len(data)), err
+		}
+
+		data = append(data, b[0])
+		if b[0]&0x80 == 0 {
+			return unpackUleb128(data, val)
+		}
+	}
+	return uint(len(data)), errors.New("Invalid uleb128")
+}
+
+func readerUnpackByteArray(r io.Reader, val reflect.Value) (uint, error) {
+	if val.Kind() != reflect.Array {
+		return 0, errors.New("Invalid field")
+	}
+
+	data := make([]byte, val.Len())
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, err
+	}
+	return unpackByteArray(data, val)
+}
+
+// arrayReaderPack adapts a PackFunc of a fixed array of size byte
+// elements for streaming.
+func arrayReaderPack(size int, fn PackFunc) ReaderPackFunc {
+	return func(r io.Reader, val reflect.Value) (uint, error) {
+		if val.Kind() != reflect.Array {
+			return 0, errors.New("Invalid field")
+		}
+		return fixedReaderPack(val.Len()*size, fn)(r, val)
+	}
+}
+
+// UnpackReader is Unpack for streams, it reads only the bytes needed for
+// the fields of o from r.
+func UnpackReader(r io.Reader, o interface{}) (int, error) {
+	offset := int(0)
+	st := reflect.ValueOf(o).Elem()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		fieldType := reflect.TypeOf(o).Elem().Field(i)
+		tag := fieldType.Tag.Get("pack")
+
+		if tag == "-" {
+			continue
+		}
+
+		p, ok := readerPacks[tag]
+		if !ok {
+			return offset, fmt.Errorf("Not implemented type %s", tag)
+		}
+
+		length, err := p(r, field)
+		offset += int(length)
+		if err != nil {
+			return offset, err
+		}
+	}
+
+	return offset, nil
+}
+
 func _uint(b []byte) (uint64, uint32) {
 	offset := 0
 	val := uint64(binary.LittleEndian.Uint32(b[offset : offset+4]))
 	return val, 4
 }
 
-func str(b []byte) (string, uint32) {
-	i := uint32(0)
-	length, offset := uleb128(b[0:])
-	i += offset
-	return string(b[i : i+length]), i
+// str reads a string_data_item. Its length prefix counts UTF-16 code
+// units, not bytes, so the data is read up to the NUL terminator and the
+// length only validates the decoded string. The data is MUTF-8: NUL is
+// encoded in two bytes and supplementary characters as two encoded
+// surrogates.
+func str(b []byte) (string, uint32, error) {
+	if len(b) == 0 {
+		return "", 0, errors.New("Invalid string data")
+	}
+
+	length, offset, err := readUleb128(b)
+	if err != nil {
+		return "", 0, err
+	}
+
+	end := bytes.IndexByte(b[offset:], 0x00)
+	if end == -1 {
+		return "", offset, fmt.Errorf("Invalid string length %d exceeds buffer", length)
+	}
+
+	units, err := decodeMUTF8(b[offset : int(offset)+end])
+	if err != nil {
+		return "", offset, err
+	}
+
+	if uint64(len(units)) != uint64(length) {
+		return "", offset, fmt.Errorf("Invalid string length %d, decoded %d code units", length, len(units))
+	}
+	return string(utf16.Decode(units)), offset, nil
+}
+
+// decodeMUTF8 decodes modified UTF-8 into UTF-16 code units.
+func decodeMUTF8(b []byte) ([]uint16, error) {
+	units := make([]uint16, 0, len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xe0 == 0xc0 && i+1 < len(b) && b[i+1]&0xc0 == 0x80:
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0 && i+2 < len(b) && b[i+1]&0xc0 == 0x80 && b[i+2]&0xc0 == 0x80:
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			return nil, fmt.Errorf("Invalid MUTF-8 byte %x at %d", c, i)
+		}
+	}
+	return units, nil
 }
 
+// uleb128 decodes a LEB128 value of at most 5 bytes as the ART reader
+// does, the fifth byte is the last one whatever its continuation bit.
 func uleb128(data []byte) (uint32, uint32) {
+	value := uint32(0)
+
 	i := uint32(0)
+	for ; i < 4 && data[i]&0x80 == 0x80; i++ {
+		value |= uint32(data[i]&0x7f) << (7 * i)
+	}
 
-	value := uint32(0)
-	for ; i < 5 && data[i]&0x80 == 0x80; i++ {
-		value += (uint32(data[i]&0x7F) << (7 * i))
+	value |= uint32(data[i]) << (7 * i)
+	return value, i + 1
+}
+
+// leb128Length returns the length of the LEB128 value at the start of
+// data, which may take up to 5 bytes.
+func leb128Length(data []byte) (uint32, error) {
+	for i := 0; i < len(data) && i < 5; i++ {
+		if data[i]&0x80 == 0 {
+			return uint32(i + 1), nil
+		}
+	}
+	return 0, errors.New("Invalid uleb128")
+}
+
+// readUleb128 is uleb128 for untrusted input, it fails instead of reading
+// past the end of data or past 32 bits.
+func readUleb128(data []byte) (uint32, uint32, error) {
+	length, err := leb128Length(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the fifth byte holds the top 4 bits only
+	if length == 5 && data[4] > 0x0f {
+		return 0, 0, errors.New("Invalid uleb128, value exceeds 32 bits")
+	}
+
+	value, _ := uleb128(data)
+	return value, length, nil
+}
+
+// readSleb128 reads a signed LEB128 value, failing instead of reading past
+// the end of data or past 32 bits.
+func readSleb128(data []byte) (int32, uint32, error) {
+	length, err := leb128Length(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the bits of the fifth byte above 32 bits repeat the sign
+	if length == 5 && data[4]&0x78 != 0 && data[4]&0x78 != 0x78 {
+		return 0, 0, errors.New("Invalid sleb128, value exceeds 32 bits")
 	}
 
-	value += (uint32(data[i]) << (7 * i))
-	i++
+	value, _ := uleb128(data)
 
-	return value, i
+	// sign extend from the last bit read
+	if bits := 7 * length; bits < 32 && value&(1<<(bits-1)) != 0 {
+		value |= ^uint32(0) << bits
+	}
+	return int32(value), length, nil
+}
+
+// appendUleb128 appends the unsigned LEB128 encoding of v to b.
+func appendUleb128(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendSleb128 appends the signed LEB128 encoding of v to b.
+func appendSleb128(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// appendStringData appends the string_data_item of s to b: its length in
+// UTF-16 code units, its MUTF-8 encoding and a NUL terminator.
+func appendStringData(b []byte, s string) []byte {
+	units := utf16.Encode([]rune(s))
+
+	b = appendUleb128(b, uint64(len(units)))
+	for _, u := range units {
+		switch {
+		case u != 0 && u < 0x80:
+			b = append(b, byte(u))
+		case u < 0x800:
+			b = append(b, 0xc0|byte(u>>6), 0x80|byte(u&0x3f))
+		default:
+			b = append(b, 0xe0|byte(u>>12), 0x80|byte(u>>6&0x3f), 0x80|byte(u&0x3f))
+		}
+	}
+	return append(b, 0x00)
 }
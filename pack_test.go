@@ -0,0 +1,150 @@
+package godex
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+)
+
+func TestUnpackReader(t *testing.T) {
+	b := testHelloDEX().build()
+
+	want := Header{}
+	if _, err := Unpack(b, &want); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	got := Header{}
+	r := bytes.NewReader(b)
+	length, err := UnpackReader(iotest.OneByteReader(r), &got)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if length != 0x70 || r.Len() != len(b)-0x70 {
+		t.Errorf("Test failed %d %d", length, 0x70)
+	}
+
+	if got != want {
+		t.Errorf("Test failed %v %v", got, want)
+	}
+
+	if _, err := UnpackReader(bytes.NewReader(b[:0x20]), &got); err == nil {
+		t.Errorf("expected error unpacking truncated header")
+	}
+}
+
+func TestUnpackArrays(t *testing.T) {
+	type item struct {
+		Shorts [4]uint16 `pack:"ushortarray"`
+		Uints  [2]uint32 `pack:"uintarray"`
+		Tail   uint16    `pack:"ushort"`
+	}
+
+	b := []byte{
+		0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0xff, 0xff,
+		0x04, 0x03, 0x02, 0x01, 0x00, 0x00, 0x00, 0x80,
+		0x2a, 0x00,
+	}
+	want := item{Shorts: [4]uint16{1, 2, 3, 0xffff}, Uints: [2]uint32{0x01020304, 0x80000000}, Tail: 42}
+
+	got := item{}
+	if length, err := Unpack(b, &got); err != nil || length != len(b) {
+		t.Fatalf("Test failed %d %v", length, err)
+	}
+
+	if got != want {
+		t.Errorf("Test failed %v %v", got, want)
+	}
+
+	got = item{}
+	if length, err := UnpackReader(bytes.NewReader(b), &got); err != nil || length != len(b) {
+		t.Fatalf("Test failed %d %v", length, err)
+	}
+
+	if got != want {
+		t.Errorf("Test failed %v %v", got, want)
+	}
+}
+
+func TestReadUleb128(t *testing.T) {
+	for _, test := range []struct {
+		data   []byte
+		value  uint32
+		length uint32
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f, 0xff}, 0x7f, 1},
+		{[]byte{0x80, 0x7f}, 0x3f80, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0xffffffff, 5},
+		// padded with a redundant continuation byte
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x00}, 0, 5},
+	} {
+		value, length, err := readUleb128(test.data)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if value != test.value || length != test.length {
+			t.Errorf("Test failed %x %d %x %d", value, length, test.value, test.length)
+		}
+	}
+
+	for _, data := range [][]byte{
+		// bits beyond 32 bits in the fifth byte
+		{0xff, 0xff, 0xff, 0xff, 0x1f},
+		// over long, the fifth byte continues
+		{0xff, 0xff, 0xff, 0xff, 0x8f, 0x00},
+		// truncated
+		{0x80, 0x80},
+	} {
+		if _, _, err := readUleb128(data); err == nil {
+			t.Errorf("expected error reading %x", data)
+		}
+	}
+}
+
+func TestReadSleb128(t *testing.T) {
+	for _, test := range []struct {
+		data  []byte
+		value int32
+	}{
+		{[]byte{0x7f}, -1},
+		{[]byte{0x80, 0x7f}, -128},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x07}, 0x7fffffff},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x78}, -0x80000000},
+	} {
+		value, _, err := readSleb128(test.data)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if value != test.value {
+			t.Errorf("Test failed %d %d", value, test.value)
+		}
+	}
+
+	for _, data := range [][]byte{{0xff, 0xff, 0xff, 0xff, 0x0f}, {0x80, 0x80, 0x80, 0x80, 0x70}} {
+		if _, _, err := readSleb128(data); err == nil {
+			t.Errorf("expected error reading %x", data)
+		}
+	}
+}
+
+func TestUnpackError(t *testing.T) {
+	// a truncated uleb128 in the second field
+	var em EncodedMethod
+	if _, err := Unpack([]byte{0x01, 0x80}, &em); err == nil {
+		t.Errorf("expected an error for a truncated uleb128")
+	}
+
+	// the fifth byte of a uleb128 holds 4 bits only
+	if _, err := Unpack([]byte{0x01, 0x01, 0x80, 0x80, 0x80, 0x80, 0x10}, &em); err == nil {
+		t.Errorf("expected an error for an over-long uleb128")
+	}
+
+	n, err := Unpack([]byte{0x01, 0x01, 0x00}, &em)
+	if err != nil || n != 3 || em.MethodIdxDiff != 1 || em.AccessFlags != ACC_PUBLIC {
+		t.Errorf("Test failed %d %v %#v", n, err, em)
+	}
+}
@@ -0,0 +1,118 @@
+package godex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizedOpcodes returns the opcodes of the method's instructions with
+// their operands, and so the register allocation, stripped. Payloads are
+// left out. Decoding stops at the first invalid instruction.
+func NormalizedOpcodes(m *EncodedMethod) []byte {
+	code, err := m.Code()
+	if err != nil || code == nil {
+		return nil
+	}
+
+	opcodes := make([]byte, 0, len(code.Insns)/4)
+	for offset := 0; offset < len(code.Insns); {
+		length, err := m.dex.instructionLength(code.Insns, offset)
+		if err != nil {
+			break
+		}
+
+		if code.Insns[offset] != 0x00 || code.Insns[offset+1] == 0x00 {
+			opcodes = append(opcodes, code.Insns[offset])
+		}
+		offset += length
+	}
+	return opcodes
+}
+
+// LevenshteinDistance returns the number of single opcode insertions,
+// deletions and substitutions that turn a into b.
+func LevenshteinDistance(a, b []byte) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+
+	// two rows of the distance matrix, sized by the shorter sequence
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// Fingerprint returns a sha256 hash, in hex, of the structure of the dex:
+// its classes with their super class, interfaces, access flags, fields and
+// methods, and the normalized opcodes of each method. Pool and class
+// order, debug info and register allocation do not affect it, so dex
+// files that differ only in those fingerprint the same.
+func (d *DEX) Fingerprint() string {
+	classes := []string{}
+	for i := range d.Classes {
+		c := &d.Classes[i]
+
+		lines := []string{}
+		for _, fields := range [][]EncodedField{c.ClassData.StaticFields, c.ClassData.InstanceFields} {
+			for j := range fields {
+				f := &fields[j]
+				lines = append(lines, fmt.Sprintf("field %s:%s %x", f.Field.String(), f.Field.Type(), uint32(f.AccessFlags)))
+			}
+		}
+
+		for _, methods := range [][]EncodedMethod{c.ClassData.DirectMethods, c.ClassData.VirtualMethods} {
+			for j := range methods {
+				m := &methods[j]
+				descriptor, _ := d.Prototypes[m.Method.ProtoIdx].descriptor()
+				lines = append(lines, fmt.Sprintf("method %s%s %x %x", m.Method.Name(), descriptor, uint32(m.AccessFlags), NormalizedOpcodes(m)))
+			}
+		}
+		sort.Strings(lines)
+
+		interfaces, _ := c.Interfaces()
+		interfaces = append([]string{}, interfaces...)
+		sort.Strings(interfaces)
+
+		name, super := "", ""
+		if t, err := d.TypeAt(c.ClassIdx); err == nil {
+			name = t.String()
+		}
+		if c.SuperclassIdx != NO_INDEX {
+			if t, err := d.TypeAt(c.SuperclassIdx); err == nil {
+				super = t.String()
+			}
+		}
+
+		header := fmt.Sprintf("class %s %s %x %s", name, super, uint32(c.AccessFlags), strings.Join(interfaces, ","))
+		classes = append(classes, header+"\n"+strings.Join(lines, "\n"))
+	}
+	sort.Strings(classes)
+
+	sum := sha256.Sum256([]byte(strings.Join(classes, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package godex
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLevenshteinDistance(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Variant;", "Ljava/lang/Object;")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Variant;", "a", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x0112,         // const/4 v1, 0
+				0x01d8, 0x0101, // add-int/lit8 v1, v1, 1
+				0x010f, // return v1
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Variant;", "b", "I", "I"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 1, insns: []uint16{
+				0x0012,         // const/4 v0, 0
+				0x0000,         // nop
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0x000f, // return v0
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	a := NormalizedOpcodes(&dex.Classes[0].ClassData.DirectMethods[0])
+	if want := []byte{0x12, 0xd8, 0x0f}; !bytes.Equal(a, want) {
+		t.Errorf("Test failed %x %x", a, want)
+	}
+
+	v := NormalizedOpcodes(&dex.Classes[0].ClassData.DirectMethods[1])
+	if d := LevenshteinDistance(a, v); d != 1 {
+		t.Errorf("Test failed %d %d", d, 1)
+	}
+
+	if d := LevenshteinDistance(a, a); d != 0 {
+		t.Errorf("Test failed %d %d", d, 0)
+	}
+
+	if d := LevenshteinDistance(nil, a); d != len(a) {
+		t.Errorf("Test failed %d %d", d, len(a))
+	}
+}
+
+// testFingerprintDEX returns a dex with two classes, built in the given
+// order, and a method returning value.
+func testFingerprintDEX(names []string, value uint16) *testDex {
+	b := &testDex{}
+	for _, name := range names {
+		c := b.class(name, "Ljava/lang/Object;")
+		c.instanceFields = []testField{
+			{idx: b.field(name, "I", "count"), flags: ACC_PRIVATE},
+		}
+		c.virtualMethods = []testMethod{
+			{
+				idx:   b.method(name, "get", "I"),
+				flags: ACC_PUBLIC,
+				code: &testCode{registers: 2, ins: 1, insns: []uint16{
+					value<<12 | 0x0012, // const/4 v0, value
+					0x000f,             // return v0
+				}},
+			},
+		}
+	}
+	return b
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(b *testDex) string {
+		dex, err := ParseAt(b.build(), 0)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		return dex.Fingerprint()
+	}
+
+	a := fingerprint(testFingerprintDEX([]string{"Lcom/example/A;", "Lcom/example/B;"}, 1))
+	b := fingerprint(testFingerprintDEX([]string{"Lcom/example/B;", "Lcom/example/A;"}, 1))
+	if a != b {
+		t.Errorf("Test failed %s %s", a, b)
+	}
+
+	// operands are not part of the fingerprint, opcodes are
+	if c := fingerprint(testFingerprintDEX([]string{"Lcom/example/A;", "Lcom/example/B;"}, 2)); c != a {
+		t.Errorf("Test failed %s %s", c, a)
+	}
+
+	other := testFingerprintDEX([]string{"Lcom/example/A;", "Lcom/example/B;"}, 1)
+	other.classes[1].virtualMethods[0].code.insns = []uint16{0x0000, 0x0012, 0x000f}
+	if c := fingerprint(other); c == a {
+		t.Errorf("expected a different fingerprint for different opcodes")
+	}
+}
@@ -0,0 +1,393 @@
+package godex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Smali returns the class as a smali file: its .class, .super, .source and
+// .implements directives followed by its fields and methods. Annotations
+// and debug info are left out.
+func (c *ClassDefItem) Smali() (string, error) {
+	d := c.dex
+
+	class, err := d.TypeAt(c.ClassIdx)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".class %s%s\n", c.AccessFlags, class.String())
+	if c.SuperclassIdx != NO_INDEX {
+		super, err := d.TypeAt(c.SuperclassIdx)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, ".super %s\n", super.String())
+	}
+	if c.SourceFileIdx != NO_INDEX {
+		fmt.Fprintf(&b, ".source %s\n", strconv.Quote(d.string(c.SourceFileIdx)))
+	}
+
+	interfaces, err := c.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	if len(interfaces) > 0 {
+		b.WriteString("\n# interfaces\n")
+	}
+	for _, iface := range interfaces {
+		fmt.Fprintf(&b, ".implements %s\n", iface)
+	}
+
+	for _, section := range []struct {
+		name   string
+		fields []EncodedField
+	}{
+		{"static fields", c.ClassData.StaticFields},
+		{"instance fields", c.ClassData.InstanceFields},
+	} {
+		if len(section.fields) > 0 {
+			fmt.Fprintf(&b, "\n# %s\n", section.name)
+		}
+
+		for i := range section.fields {
+			f := &section.fields[i]
+			fmt.Fprintf(&b, ".field %s%s:%s", f.AccessFlags.fieldString(), f.Field.String(), f.Field.Type())
+			if ev, ok := f.StaticValue(); ok {
+				value, err := smaliValue(&ev)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(" = " + value)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for _, section := range []struct {
+		name    string
+		methods []EncodedMethod
+	}{
+		{"direct methods", c.ClassData.DirectMethods},
+		{"virtual methods", c.ClassData.VirtualMethods},
+	} {
+		if len(section.methods) > 0 {
+			fmt.Fprintf(&b, "\n# %s\n", section.name)
+		}
+
+		for i := range section.methods {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+
+			method, err := section.methods[i].Smali()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(method)
+		}
+	}
+	return b.String(), nil
+}
+
+// Smali returns the method as a smali .method block, with the parameter
+// registers named p0, p1, ... and branch targets, switch cases and catch
+// handlers labeled :L0, :L1, ... in address order.
+func (m *EncodedMethod) Smali() (string, error) {
+	d := m.dex
+
+	descriptor, err := d.Prototypes[m.Method.ProtoIdx].descriptor()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".method %s%s%s\n", m.AccessFlags.methodString(), m.Method.Name(), descriptor)
+
+	code, err := m.Code()
+	if err != nil {
+		return "", err
+	}
+
+	if code == nil {
+		b.WriteString(".end method\n")
+		return b.String(), nil
+	}
+
+	insns, err := m.Instructions()
+	if err != nil {
+		return "", err
+	}
+
+	labels, cases, err := smaliLabels(code, insns)
+	if err != nil {
+		return "", err
+	}
+
+	f := smaliFormatter{dex: d, code: code, labels: labels}
+
+	fmt.Fprintf(&b, "    .registers %d\n\n", code.RegistersSize)
+	for _, di := range insns {
+		if label, ok := labels[di.Offset]; ok {
+			fmt.Fprintf(&b, "    %s\n", label)
+		}
+
+		insn, err := f.instruction(di, cases[di.Offset])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "    %s\n", strings.Replace(insn, "\n", "\n    ", -1))
+	}
+
+	// a try may end with the code
+	if label, ok := labels[uint32(len(code.Insns))]; ok {
+		fmt.Fprintf(&b, "    %s\n", label)
+	}
+
+	if len(code.Tries) > 0 {
+		b.WriteString("\n")
+	}
+	for _, try := range code.Tries {
+		start, end := labels[try.StartAddr*2], labels[(try.StartAddr+uint32(try.InsnCount))*2]
+		for _, handler := range try.Handler.Handlers {
+			exception, err := d.TypeAt(handler.TypeIdx)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "    .catch %s {%s .. %s} %s\n", exception.String(), start, end, labels[handler.Addr*2])
+		}
+		if try.Handler.CatchAll != nil {
+			fmt.Fprintf(&b, "    .catchall {%s .. %s} %s\n", start, end, labels[*try.Handler.CatchAll*2])
+		}
+	}
+
+	b.WriteString(".end method\n")
+	return b.String(), nil
+}
+
+// smaliLabels labels the branch targets, switch cases and catch handlers
+// of code in address order, :L0, :L1, ... and returns the cases of each
+// switch payload by its offset.
+func smaliLabels(code *CodeItem, insns []DecodedInstruction) (map[uint32]string, map[uint32][]SwitchCase, error) {
+	// switch cases are relative to the switch, not to their payload
+	cases := map[uint32][]SwitchCase{}
+	targets := map[uint32]bool{}
+	for _, di := range insns {
+		target, ok := branchTarget(di)
+		if !ok {
+			continue
+		}
+		targets[target] = true
+
+		if di.Name != "packed-switch" && di.Name != "sparse-switch" {
+			continue
+		}
+
+		switchCases, err := switchCases(code.Insns, di)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cases[target] = switchCases
+		for _, c := range switchCases {
+			targets[c.Target] = true
+		}
+	}
+
+	for _, try := range code.Tries {
+		targets[try.StartAddr*2] = true
+		targets[(try.StartAddr+uint32(try.InsnCount))*2] = true
+		for _, handler := range try.Handler.Handlers {
+			targets[handler.Addr*2] = true
+		}
+		if try.Handler.CatchAll != nil {
+			targets[*try.Handler.CatchAll*2] = true
+		}
+	}
+
+	offsets := []uint32{}
+	for offset := range targets {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	labels := map[uint32]string{}
+	for i, offset := range offsets {
+		labels[offset] = fmt.Sprintf(":L%d", i)
+	}
+	return labels, cases, nil
+}
+
+type smaliFormatter struct {
+	dex    *DEX
+	code   *CodeItem
+	labels map[uint32]string
+}
+
+// instruction formats di, cases are the cases of a switch payload.
+func (f smaliFormatter) instruction(di DecodedInstruction, cases []SwitchCase) (string, error) {
+	switch di.Name {
+	case "packed-switch-payload":
+		lines := []string{".packed-switch " + smaliLiteral(0, "")}
+		if len(cases) > 0 {
+			lines[0] = ".packed-switch " + smaliLiteral(int64(cases[0].Key), "")
+		}
+		for _, c := range cases {
+			lines = append(lines, "    "+f.labels[c.Target])
+		}
+		return strings.Join(append(lines, ".end packed-switch"), "\n"), nil
+	case "sparse-switch-payload":
+		lines := []string{".sparse-switch"}
+		for _, c := range cases {
+			lines = append(lines, "    "+smaliLiteral(int64(c.Key), "")+" -> "+f.labels[c.Target])
+		}
+		return strings.Join(append(lines, ".end sparse-switch"), "\n"), nil
+	case "fill-array-data-payload":
+		return f.arrayData(di), nil
+	}
+
+	if len(di.Operands) == 0 {
+		return di.Name, nil
+	}
+
+	suffix := ""
+	if strings.HasPrefix(di.Name, "const-wide") {
+		suffix = "L"
+	}
+
+	// invokes and filled-new-array list their registers in braces
+	list := di.Format == "35c" || di.Format == "3rc" || di.Format == "45cc" || di.Format == "4rcc"
+
+	operands := []string{}
+	registers := []string{}
+	for _, operand := range di.Operands {
+		var s string
+		switch o := operand.(type) {
+		case RegisterOperand:
+			s = f.code.smaliRegister(o)
+			if list {
+				registers = append(registers, s)
+				continue
+			}
+		case LiteralOperand:
+			s = smaliLiteral(o.Value, suffix)
+		case StringIndexOperand:
+			str, err := f.dex.StringAt(o.Index)
+			if err != nil {
+				return "", err
+			}
+			s = strconv.Quote(str)
+		case TypeIndexOperand:
+			if int(o.Index) >= len(f.dex.Types) {
+				return "", &IndexError{Kind: "type", Index: o.Index, Max: len(f.dex.Types)}
+			}
+			s = f.dex.Types[o.Index].String()
+		case FieldIndexOperand:
+			if int(o.Index) >= len(f.dex.Fields) {
+				return "", &IndexError{Kind: "field", Index: o.Index, Max: len(f.dex.Fields)}
+			}
+			field := &f.dex.Fields[o.Index]
+			s = field.Class() + "->" + field.String() + ":" + field.Type()
+		case MethodIndexOperand:
+			if int(o.Index) >= len(f.dex.Methods) {
+				return "", &IndexError{Kind: "method", Index: o.Index, Max: len(f.dex.Methods)}
+			}
+			method := &f.dex.Methods[o.Index]
+			descriptor, err := f.dex.Prototypes[method.ProtoIdx].descriptor()
+			if err != nil {
+				return "", err
+			}
+			s = method.Class() + "->" + method.Name() + descriptor
+		case IndexOperand:
+			s = o.String()
+			if o.Kind == "proto" && int(o.Index) < len(f.dex.Prototypes) {
+				descriptor, err := f.dex.Prototypes[o.Index].descriptor()
+				if err != nil {
+					return "", err
+				}
+				s = descriptor
+			}
+		case BranchOperand:
+			target, _ := branchTarget(di)
+			s = f.labels[target]
+		default:
+			s = operand.String()
+		}
+
+		if len(operands) == 0 && list {
+			operands = append(operands, f.registerList(di, registers))
+		}
+		operands = append(operands, s)
+	}
+	return di.Name + " " + strings.Join(operands, ", "), nil
+}
+
+// registerList formats the argument registers of an invoke or
+// filled-new-array, ranges as {vC .. vN}.
+func (f smaliFormatter) registerList(di DecodedInstruction, registers []string) string {
+	if (di.Format == "3rc" || di.Format == "4rcc") && len(registers) > 1 {
+		return "{" + registers[0] + " .. " + registers[len(registers)-1] + "}"
+	}
+	return "{" + strings.Join(registers, ", ") + "}"
+}
+
+// arrayData formats a fill-array-data payload.
+func (f smaliFormatter) arrayData(di DecodedInstruction) string {
+	le := binary.LittleEndian
+	payload := f.code.Insns[di.Offset : di.Offset+uint32(di.Length)]
+
+	width := int(le.Uint16(payload[2:]))
+	size := int(le.Uint32(payload[4:]))
+
+	suffix := map[int]string{1: "t", 2: "s", 8: "L"}[width]
+
+	lines := []string{fmt.Sprintf(".array-data %d", width)}
+	for i := 0; i < size; i++ {
+		element := payload[8+i*width : 8+(i+1)*width]
+		lines = append(lines, "    "+smaliLiteral(signExtend(element), suffix))
+	}
+	return strings.Join(append(lines, ".end array-data"), "\n")
+}
+
+// smaliLiteral formats v in hex as smali does, eg. -0x1 or 0x10L.
+func smaliLiteral(v int64, suffix string) string {
+	if v < 0 {
+		return "-0x" + strconv.FormatUint(uint64(-v), 16) + suffix
+	}
+	return "0x" + strconv.FormatInt(v, 16) + suffix
+}
+
+// smaliValue formats the initial value of a static field.
+func smaliValue(ev *EncodedValue) (string, error) {
+	v, err := ev.Decode()
+	if err != nil {
+		return "", err
+	}
+
+	switch ev.ValueType {
+	case VALUE_BYTE:
+		return smaliLiteral(v.(int64), "t"), nil
+	case VALUE_SHORT:
+		return smaliLiteral(v.(int64), "s"), nil
+	case VALUE_INT:
+		return smaliLiteral(v.(int64), ""), nil
+	case VALUE_LONG:
+		return smaliLiteral(v.(int64), "L"), nil
+	case VALUE_CHAR:
+		return strconv.QuoteRune(rune(v.(uint16))), nil
+	case VALUE_FLOAT:
+		return strconv.FormatFloat(float64(v.(float32)), 'g', -1, 32) + "f", nil
+	case VALUE_DOUBLE:
+		return strconv.FormatFloat(v.(float64), 'g', -1, 64), nil
+	case VALUE_STRING:
+		return strconv.Quote(v.(string)), nil
+	case VALUE_NULL:
+		return "null", nil
+	}
+	return fmt.Sprintf("%v", v), nil
+}
@@ -0,0 +1,98 @@
+package godex
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func testCounterDEX() *testDex {
+	b := &testDex{}
+	c := b.class("Lcom/example/Counter;", "Ljava/lang/Object;")
+	c.interfaces = []uint16{b.typ("Ljava/lang/Runnable;")}
+
+	count := b.field("Lcom/example/Counter;", "I", "count")
+	c.staticFields = []testField{
+		{idx: b.field("Lcom/example/Counter;", "I", "MAX"), flags: ACC_PUBLIC | ACC_STATIC | ACC_FINAL},
+		{idx: b.field("Lcom/example/Counter;", "Ljava/lang/String;", "NAME"), flags: ACC_PUBLIC | ACC_STATIC | ACC_FINAL},
+	}
+	c.staticValues = []byte{0x02, VALUE_INT, 100, VALUE_STRING, byte(b.str("counter"))}
+	c.instanceFields = []testField{{idx: count, flags: ACC_PRIVATE | ACC_VOLATILE}}
+
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Counter;", "<init>", "V"),
+			flags: ACC_PUBLIC | ACC_CONSTRUCTOR,
+			code: &testCode{registers: 1, ins: 1, outs: 1, insns: []uint16{
+				0x1070, uint16(b.method("Ljava/lang/Object;", "<init>", "V")), 0x0000, // invoke-direct {v0}, Object.<init>
+				0x000e, // return-void
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Counter;", "sign", "I", "I"),
+			flags: ACC_PRIVATE | ACC_STATIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x013d, 0x0004, // if-lez p0, :L0
+				0x1012, // const/4 v0, 1
+				0x000f, // return v0
+				0xf012, // :L0 const/4 v0, -1
+				0x000f, // return v0
+			}},
+		},
+	}
+	c.virtualMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Counter;", "run", "V"),
+			flags: ACC_PUBLIC,
+			code: &testCode{registers: 2, ins: 1, insns: []uint16{
+				0x1052, uint16(count), // iget v0, p0, count
+				0x00d8, 0x0100, // add-int/lit8 v0, v0, 1
+				0x1059, uint16(count), // iput v0, p0, count
+				0x000e, // return-void
+				0x000d, // move-exception v0
+				0x0027, // throw v0
+			}, tries: []testTry{
+				{start: 0, count: 6, handler: 0},
+			}, handlers: []testHandler{
+				{catches: [][2]uint32{{uint32(b.typ("Ljava/lang/RuntimeException;")), 7}}},
+			}},
+		},
+	}
+	return b
+}
+
+func TestClassSmali(t *testing.T) {
+	dex, err := ParseAt(testCounterDEX().build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	smali, err := dex.Classes[0].Smali()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "Counter.smali"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if smali != string(want) {
+		t.Errorf("Test failed %q %q", smali, want)
+	}
+}
+
+func TestClassSmaliInvalidCatchType(t *testing.T) {
+	b := testCounterDEX()
+	b.classes[0].virtualMethods[0].code.handlers[0].catches[0][0] = 0xffff
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, err = dex.Classes[0].Smali()
+	if _, ok := err.(*IndexError); !ok {
+		t.Errorf("Test failed %v %s", err, "Invalid type index")
+	}
+}
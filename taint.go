@@ -0,0 +1,143 @@
+package godex
+
+import (
+	"strings"
+)
+
+// TaintPath is a flow within Method from the result of a call to Source to
+// an argument of a call to Sink.
+type TaintPath struct {
+	Method MethodRef
+	Source *MethodIdItem
+	Sink   *MethodIdItem
+	// byte offsets of the source and sink invokes
+	SourceOffset uint32
+	SinkOffset   uint32
+}
+
+// taint is the source call a register's value derives from.
+type taint struct {
+	method *MethodIdItem
+	offset uint32
+}
+
+// TaintScan returns the methods passing data from a call to one of
+// sources to a call to one of sinks, eg. from
+// "Landroid/telephony/TelephonyManager;->getDeviceId" to
+// "Landroid/util/Log;", see matchesAPI for the syntax. The scan is
+// intraprocedural and follows registers in code order, ignoring branches.
+// The result of a call taking a tainted argument is tainted, as are its
+// other arguments, which covers builders like StringBuilder. Fields are
+// not followed.
+func (d *DEX) TaintScan(sources, sinks []string) []TaintPath {
+	paths := []TaintPath{}
+	d.EachMethod(func(c *ClassDefItem, m *EncodedMethod) error {
+		insns, err := m.Instructions()
+		if err != nil {
+			return nil
+		}
+
+		ref := MethodRef{Class: c, Method: m}
+		seen := map[[2]uint32]bool{}
+
+		tainted := map[uint16]taint{}
+		var result *taint
+		for _, di := range insns {
+			registers := []uint16{}
+			for _, operand := range di.Operands {
+				if r, ok := operand.(RegisterOperand); ok {
+					registers = append(registers, r.Register)
+				}
+			}
+
+			// the result of the previous call, if any, is only available
+			// to a move-result following it directly
+			pending := result
+			result = nil
+
+			switch {
+			case strings.HasPrefix(di.Name, "invoke-"):
+				// invoke-custom calls a call site, not a method
+				var method *MethodIdItem
+				for _, operand := range di.Operands {
+					if o, ok := operand.(MethodIndexOperand); ok && int(o.Index) < len(d.Methods) {
+						method = &d.Methods[o.Index]
+					}
+				}
+
+				if method == nil {
+					continue
+				}
+
+				var arg *taint
+				for _, r := range registers {
+					if t, ok := tainted[r]; ok {
+						arg = &t
+						break
+					}
+				}
+
+				if arg != nil && matchesAPI(method, sinks) {
+					key := [2]uint32{arg.offset, di.Offset}
+					if !seen[key] {
+						seen[key] = true
+						paths = append(paths, TaintPath{Method: ref, Source: arg.method, Sink: method, SourceOffset: arg.offset, SinkOffset: di.Offset})
+					}
+				}
+
+				switch {
+				case matchesAPI(method, sources):
+					result = &taint{method: method, offset: di.Offset}
+				case arg != nil:
+					result = arg
+					for _, r := range registers {
+						tainted[r] = *arg
+					}
+				}
+			case strings.HasPrefix(di.Name, "filled-new-array"):
+				for _, r := range registers {
+					if t, ok := tainted[r]; ok {
+						result = &t
+						break
+					}
+				}
+			case strings.HasPrefix(di.Name, "move-result"):
+				if pending != nil {
+					tainted[registers[0]] = *pending
+				} else {
+					delete(tainted, registers[0])
+				}
+			case !writesFirstRegister(di) || len(registers) == 0:
+			default:
+				// the destination derives from the other registers read
+				var t *taint
+				for _, r := range registers[1:] {
+					if rt, ok := tainted[r]; ok {
+						t = &rt
+						break
+					}
+				}
+
+				if t != nil {
+					tainted[registers[0]] = *t
+				} else if di.Name != "check-cast" {
+					delete(tainted, registers[0])
+				}
+			}
+		}
+		return nil
+	})
+	return paths
+}
+
+// writesFirstRegister reports whether the first register operand of di is
+// written by it, which holds for all instructions but branches, stores,
+// returns and the like.
+func writesFirstRegister(di DecodedInstruction) bool {
+	for _, prefix := range []string{"if-", "return", "throw", "monitor-", "packed-switch", "sparse-switch", "fill-array-data", "iput", "sput", "aput", "goto", "nop"} {
+		if strings.HasPrefix(di.Name, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestTaintScan(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Spy;", "Ljava/lang/Object;")
+	getDeviceId := b.method("Landroid/telephony/TelephonyManager;", "getDeviceId", "Ljava/lang/String;")
+	logD := b.method("Landroid/util/Log;", "d", "I", "Ljava/lang/String;", "Ljava/lang/String;")
+	tag := b.str("imei")
+	c.directMethods = []testMethod{
+		{
+			idx:   b.method("Lcom/example/Spy;", "leak", "V", "Landroid/telephony/TelephonyManager;"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 1, outs: 2, insns: []uint16{
+				0x001a, uint16(tag), // const-string v0, "imei"
+				0x106e, uint16(getDeviceId), 0x0002, // invoke-virtual {v2}, TelephonyManager.getDeviceId
+				0x010c,                       // move-result-object v1
+				0x2071, uint16(logD), 0x0010, // invoke-static {v0, v1}, Log.d
+				0x000e, // return-void
+			}},
+		},
+		{
+			idx:   b.method("Lcom/example/Spy;", "overwrite", "V", "Landroid/telephony/TelephonyManager;"),
+			flags: ACC_PUBLIC | ACC_STATIC,
+			code: &testCode{registers: 3, ins: 1, outs: 2, insns: []uint16{
+				0x106e, uint16(getDeviceId), 0x0002, // invoke-virtual {v2}, TelephonyManager.getDeviceId
+				0x010c,              // move-result-object v1
+				0x011a, uint16(tag), // const-string v1, "imei"
+				0x001a, uint16(tag), // const-string v0, "imei"
+				0x2071, uint16(logD), 0x0010, // invoke-static {v0, v1}, Log.d
+				0x000e, // return-void
+			}},
+		},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	paths := dex.TaintScan([]string{"Landroid/telephony/TelephonyManager;->getDeviceId"}, []string{"Landroid/util/Log;->d(Ljava/lang/String;Ljava/lang/String;)I"})
+	if len(paths) != 1 {
+		t.Fatalf("Test failed %v %d", paths, 1)
+	}
+
+	path := paths[0]
+	if path.Method.Method.Method.Name() != "leak" || path.Source.Name() != "getDeviceId" || path.Sink.Name() != "d" {
+		t.Errorf("Test failed %v", path)
+	}
+
+	if path.SourceOffset != 4 || path.SinkOffset != 12 {
+		t.Errorf("Test failed %x %x", path.SourceOffset, path.SinkOffset)
+	}
+}
@@ -0,0 +1,258 @@
+package godex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DEFAULT_MAX_DEPTH is the default limit on nested encoded arrays and
+// annotations.
+const DEFAULT_MAX_DEPTH = 64
+
+var ErrMaxDepth = errors.New("Maximum encoded value depth exceeded")
+
+type DecodeOptions struct {
+	// MaxDepth limits how deep arrays and annotations may nest, crafted
+	// files could otherwise exhaust the stack. Defaults to
+	// DEFAULT_MAX_DEPTH.
+	MaxDepth int
+}
+
+func (o DecodeOptions) maxDepth() int {
+	if o.MaxDepth <= 0 {
+		return DEFAULT_MAX_DEPTH
+	}
+	return o.MaxDepth
+}
+
+// maximum payload size of each value type
+var valueSizes = map[ValueType]int{
+	VALUE_BYTE:          1,
+	VALUE_SHORT:         2,
+	VALUE_CHAR:          2,
+	VALUE_INT:           4,
+	VALUE_LONG:          8,
+	VALUE_FLOAT:         4,
+	VALUE_DOUBLE:        8,
+	VALUE_METHOD_TYPE:   4,
+	VALUE_METHOD_HANDLE: 4,
+	VALUE_STRING:        4,
+	VALUE_TYPE:          4,
+	VALUE_FIELD:         4,
+	VALUE_METHOD:        4,
+	VALUE_ENUM:          4,
+}
+
+// readEncodedValue reads the encoded_value at the start of b, returning
+// it and its length in bytes. For arrays and annotations Data holds the
+// complete nested encoded_array or encoded_annotation, which may nest at
+// most depth levels.
+func (d *DEX) readEncodedValue(b []byte, depth int) (EncodedValue, int, error) {
+	if len(b) == 0 {
+		return EncodedValue{}, 0, fmt.Errorf("Invalid encoded value")
+	}
+
+	ev := EncodedValue{
+		dex:       d,
+		ValueType: ValueType(b[0] & 0x1f),
+		Arg:       b[0] >> 5,
+	}
+
+	size := 0
+	switch ev.ValueType {
+	case VALUE_ARRAY, VALUE_ANNOTATION:
+		if depth <= 0 {
+			return ev, 0, ErrMaxDepth
+		}
+
+		var err error
+		if ev.ValueType == VALUE_ARRAY {
+			_, size, err = d.readEncodedArray(b[1:], depth-1)
+		} else {
+			_, size, err = d.readEncodedAnnotation(b[1:], depth-1)
+		}
+		if err != nil {
+			return ev, 0, err
+		}
+	case VALUE_NULL, VALUE_BOOLEAN:
+		// the value, if any, is in the value_arg, there is no payload
+		if ev.Arg > 1 || ev.ValueType == VALUE_NULL && ev.Arg != 0 {
+			return ev, 0, fmt.Errorf("Invalid encoded %s value arg %d", ev.ValueType, ev.Arg)
+		}
+	default:
+		max, ok := valueSizes[ev.ValueType]
+		if !ok {
+			return ev, 0, fmt.Errorf("Invalid encoded value type %x", b[0]&0x1f)
+		}
+
+		size = int(ev.Arg) + 1
+		if size > max {
+			return ev, 0, fmt.Errorf("Invalid encoded %s value size %d", ev.ValueType, size)
+		}
+	}
+
+	if 1+size > len(b) {
+		return ev, 0, fmt.Errorf("Truncated encoded %s value", ev.ValueType)
+	}
+
+	ev.Data = b[1 : 1+size]
+	return ev, 1 + size, nil
+}
+
+// readEncodedArray reads the encoded_array at the start of b.
+func (d *DEX) readEncodedArray(b []byte, depth int) ([]EncodedValue, int, error) {
+	size, offset, err := readUleb128(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values := []EncodedValue{}
+	for i := uint32(0); i < size; i++ {
+		ev, length, err := d.readEncodedValue(b[offset:], depth)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		values = append(values, ev)
+		offset += uint32(length)
+	}
+	return values, int(offset), nil
+}
+
+// Decode converts the value into a Go value, see DecodeWith.
+func (ev *EncodedValue) Decode() (interface{}, error) {
+	return ev.DecodeWith(DecodeOptions{})
+}
+
+// DecodeWith converts the value into a Go value: int64 for the integral
+// types, uint16 for char, float32 and float64, bool, nil, string for
+// strings and type descriptors, []interface{} for arrays and Annotation
+// for annotations. Field, method, enum, method type and method handle
+// values decode to their uint32 pool index.
+func (ev *EncodedValue) DecodeWith(opts DecodeOptions) (interface{}, error) {
+	return ev.decode(opts.maxDepth())
+}
+
+func (ev *EncodedValue) decode(depth int) (interface{}, error) {
+	switch ev.ValueType {
+	case VALUE_BYTE, VALUE_SHORT, VALUE_INT, VALUE_LONG:
+		return signExtend(ev.Data), nil
+	case VALUE_CHAR:
+		return uint16(zeroExtend(ev.Data)), nil
+	case VALUE_FLOAT:
+		return math.Float32frombits(uint32(rightZeroExtend(ev.Data, 4))), nil
+	case VALUE_DOUBLE:
+		return math.Float64frombits(rightZeroExtend(ev.Data, 8)), nil
+	case VALUE_STRING:
+		idx := zeroExtend(ev.Data)
+		if idx >= uint64(ev.dex.StringCount()) {
+			return nil, fmt.Errorf("Invalid string index %d", idx)
+		}
+		return ev.dex.StringAt(uint32(idx))
+	case VALUE_TYPE:
+		idx := zeroExtend(ev.Data)
+		if idx >= uint64(len(ev.dex.Types)) {
+			return nil, fmt.Errorf("Invalid type index %d", idx)
+		}
+		return ev.dex.Types[idx].String(), nil
+	case VALUE_FIELD, VALUE_METHOD, VALUE_ENUM, VALUE_METHOD_TYPE, VALUE_METHOD_HANDLE:
+		return uint32(zeroExtend(ev.Data)), nil
+	case VALUE_ARRAY:
+		if depth <= 0 {
+			return nil, ErrMaxDepth
+		}
+
+		values, _, err := ev.dex.readEncodedArray(ev.Data, depth-1)
+		if err != nil {
+			return nil, err
+		}
+
+		array := make([]interface{}, len(values))
+		for i := range values {
+			if array[i], err = values[i].decode(depth - 1); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case VALUE_ANNOTATION:
+		if depth <= 0 {
+			return nil, ErrMaxDepth
+		}
+
+		annotation, _, err := ev.dex.readEncodedAnnotation(ev.Data, depth-1)
+		return annotation, err
+	case VALUE_NULL:
+		return nil, nil
+	case VALUE_BOOLEAN:
+		return ev.Arg != 0, nil
+	}
+
+	return nil, fmt.Errorf("Invalid encoded value type %x", uint32(ev.ValueType))
+}
+
+// ResolveType returns the type referenced by a type value.
+func (ev *EncodedValue) ResolveType() (*TypeId, error) {
+	idx, err := ev.poolIndex("type", len(ev.dex.Types), VALUE_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	return &ev.dex.Types[idx], nil
+}
+
+// ResolveField returns the field referenced by a field or enum value.
+func (ev *EncodedValue) ResolveField() (*FieldIdItem, error) {
+	idx, err := ev.poolIndex("field", len(ev.dex.Fields), VALUE_FIELD, VALUE_ENUM)
+	if err != nil {
+		return nil, err
+	}
+	return &ev.dex.Fields[idx], nil
+}
+
+// ResolveMethod returns the method referenced by a method value.
+func (ev *EncodedValue) ResolveMethod() (*MethodIdItem, error) {
+	idx, err := ev.poolIndex("method", len(ev.dex.Methods), VALUE_METHOD)
+	if err != nil {
+		return nil, err
+	}
+	return &ev.dex.Methods[idx], nil
+}
+
+// poolIndex returns the pool index held by the value, which must be one
+// of types and below max.
+func (ev *EncodedValue) poolIndex(kind string, max int, types ...ValueType) (uint32, error) {
+	for _, vt := range types {
+		if ev.ValueType != vt {
+			continue
+		}
+
+		idx := zeroExtend(ev.Data)
+		if idx >= uint64(max) {
+			return 0, &IndexError{Kind: kind, Index: uint32(idx), Max: max}
+		}
+		return uint32(idx), nil
+	}
+	return 0, fmt.Errorf("Encoded %s value is not a %s reference", ev.ValueType, kind)
+}
+
+func zeroExtend(data []byte) uint64 {
+	buf := make([]byte, 8)
+	copy(buf, data)
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func signExtend(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	shift := uint(64 - 8*len(data))
+	return int64(zeroExtend(data)<<shift) >> shift
+}
+
+// rightZeroExtend places data in the high order bytes of a size byte
+// value, as used by float and double encoded values.
+func rightZeroExtend(data []byte, size int) uint64 {
+	return zeroExtend(data) << uint(8*(size-len(data)))
+}
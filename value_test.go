@@ -0,0 +1,133 @@
+package godex
+
+import (
+	"testing"
+)
+
+func nestedArray(depth int) []byte {
+	b := []byte{}
+	for i := 0; i < depth; i++ {
+		// VALUE_ARRAY holding a single element
+		b = append(b, VALUE_ARRAY, 0x01)
+	}
+	return append(b, VALUE_NULL)
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+	d := &DEX{}
+
+	if _, _, err := d.readEncodedValue(nestedArray(100), DEFAULT_MAX_DEPTH); err != ErrMaxDepth {
+		t.Errorf("Test failed %v %v", err, ErrMaxDepth)
+	}
+
+	ev, _, err := d.readEncodedValue(nestedArray(100), 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if _, err := ev.Decode(); err != ErrMaxDepth {
+		t.Errorf("Test failed %v %v", err, ErrMaxDepth)
+	}
+
+	v, err := ev.DecodeWith(DecodeOptions{MaxDepth: 100})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		array, ok := v.([]interface{})
+		if !ok || len(array) != 1 {
+			t.Fatalf("Test failed %v at depth %d", v, i)
+		}
+		v = array[0]
+	}
+
+	if v != nil {
+		t.Errorf("Test failed %v %v", v, nil)
+	}
+}
+
+func TestDecodeBooleanAndNull(t *testing.T) {
+	d := &DEX{}
+
+	// true, false and null carry no payload, the int after them is read
+	// from the next byte
+	b := []byte{0x04, 1<<5 | VALUE_BOOLEAN, VALUE_BOOLEAN, VALUE_NULL, VALUE_INT, 0x2a}
+	values, length, err := d.readEncodedArray(b, DEFAULT_MAX_DEPTH)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if length != len(b) {
+		t.Errorf("Test failed %d %d", length, len(b))
+	}
+
+	want := []interface{}{true, false, nil, int64(42)}
+	if len(values) != len(want) {
+		t.Fatalf("Test failed %d %d", len(values), len(want))
+	}
+
+	for i := range values {
+		v, err := values[i].Decode()
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if v != want[i] {
+			t.Errorf("Test failed %v %v", v, want[i])
+		}
+	}
+
+	for _, b := range [][]byte{{2<<5 | VALUE_BOOLEAN}, {1<<5 | VALUE_NULL}} {
+		if _, _, err := d.readEncodedValue(b, DEFAULT_MAX_DEPTH); err == nil {
+			t.Errorf("expected error decoding %x", b)
+		}
+	}
+}
+
+func TestResolveValues(t *testing.T) {
+	b := &testDex{}
+	b.class("Lcom/example/Colors;", "Ljava/lang/Object;")
+	typ := b.typ("Ljava/lang/String;")
+	field := b.field("Lcom/example/Colors;", "Lcom/example/Colors;", "RED")
+	method := b.method("Lcom/example/Colors;", "values", "[Lcom/example/Colors;")
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	value := func(vt ValueType, idx uint32) *EncodedValue {
+		ev, _, err := dex.readEncodedValue([]byte{byte(vt), byte(idx)}, DEFAULT_MAX_DEPTH)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		return &ev
+	}
+
+	if typeId, err := value(VALUE_TYPE, uint32(typ)).ResolveType(); err != nil || typeId.String() != "Ljava/lang/String;" {
+		t.Errorf("Test failed %v %v", typeId, err)
+	}
+
+	for _, vt := range []ValueType{VALUE_FIELD, VALUE_ENUM} {
+		if f, err := value(vt, field).ResolveField(); err != nil || f.String() != "RED" {
+			t.Errorf("Test failed %v %v", f, err)
+		}
+	}
+
+	if m, err := value(VALUE_METHOD, method).ResolveMethod(); err != nil || m.Name() != "values" {
+		t.Errorf("Test failed %v %v", m, err)
+	}
+
+	if _, err := value(VALUE_STRING, 0).ResolveType(); err == nil {
+		t.Errorf("expected error resolving a string value as a type")
+	}
+
+	if _, err := value(VALUE_METHOD, field).ResolveField(); err == nil {
+		t.Errorf("expected error resolving a method value as a field")
+	}
+
+	if _, err := value(VALUE_METHOD, 0x7f).ResolveMethod(); err == nil {
+		t.Errorf("expected error resolving a method index out of range")
+	}
+}
@@ -0,0 +1,207 @@
+package godex
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash/adler32"
+	"unicode/utf16"
+)
+
+// end returns the end of the dex file as declared by the header, clamped
+// to the available data.
+func (d *DEX) end() int {
+	if size := int(d.header.FileSize); size >= 0x70 && size <= len(d.b) {
+		return size
+	}
+	return len(d.b)
+}
+
+// ComputeChecksum returns the adler32 checksum of the file, everything
+// but the magic and checksum itself.
+func (d *DEX) ComputeChecksum() uint32 {
+	return adler32.Checksum(d.b[12:d.end()])
+}
+
+// ComputeSignature returns the SHA-1 signature of the file, everything but
+// the magic, checksum and signature itself.
+func (d *DEX) ComputeSignature() [20]byte {
+	return sha1.Sum(d.b[32:d.end()])
+}
+
+// VerifyChecksum checks the checksum in the header.
+func (d *DEX) VerifyChecksum() error {
+	if checksum := d.ComputeChecksum(); checksum != d.header.Checksum {
+		return fmt.Errorf("Invalid checksum %x, expected %x", d.header.Checksum, checksum)
+	}
+	return nil
+}
+
+// VerifySignature checks the signature in the header.
+func (d *DEX) VerifySignature() error {
+	if signature := d.ComputeSignature(); signature != d.header.Signature {
+		return fmt.Errorf("Invalid signature %x, expected %x", d.header.Signature, signature)
+	}
+	return nil
+}
+
+// Verify runs all integrity checks and returns every failure: the magic,
+// checksum, signature, section bounds and the ordering of the string and
+// id pools.
+func (d *DEX) Verify() []error {
+	errs := []error{}
+	for _, check := range []func() error{
+		d.VerifyMagic,
+		d.VerifyChecksum,
+		d.VerifySignature,
+		d.VerifySections,
+		d.VerifyStringOrder,
+		d.VerifyIdOrder,
+	} {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// VerifyMagic checks the magic, version and endian tag in the header.
+func (d *DEX) VerifyMagic() error {
+	if _, err := d.header.DexVersion(); err != nil {
+		return err
+	}
+
+	if d.header.EndianTag != ENDIAN_CONSTANT {
+		return fmt.Errorf("Invalid endian tag %x", d.header.EndianTag)
+	}
+	return nil
+}
+
+// VerifySections checks that the file is as large as declared, and that
+// every section of the header and map list lies within it.
+func (d *DEX) VerifySections() error {
+	h := d.header
+	if uint64(h.FileSize) > uint64(len(d.b)) {
+		return fmt.Errorf("Invalid file size %d, only %d bytes", h.FileSize, len(d.b))
+	}
+
+	sections := []struct {
+		name  string
+		off   uint32
+		count uint32
+		size  uint64
+	}{
+		{"string ids", h.StringIdsOffset, h.StringIdsSize, 4},
+		{"type ids", h.TypeIdsOffset, h.TypeIdsSize, 4},
+		{"proto ids", h.ProtosOffset, h.ProtosSize, 12},
+		{"field ids", h.FieldsOffset, h.FieldsSize, 8},
+		{"method ids", h.MethodIdsOffset, h.MethodIdsSize, 8},
+		{"class defs", h.ClassDefsOffset, h.ClassDefsSize, 32},
+		{"data", h.DataOffset, h.DataSize, 1},
+		{"link", h.LinkOff, h.LinkSize, 1},
+	}
+
+	for _, section := range sections {
+		if section.count == 0 && section.off != 0 {
+			return fmt.Errorf("Invalid %s section, empty at %x", section.name, section.off)
+		}
+
+		if uint64(section.off)+uint64(section.count)*section.size > uint64(d.end()) {
+			return fmt.Errorf("Invalid %s section, %d items at %x exceed the file", section.name, section.count, section.off)
+		}
+	}
+
+	for _, item := range d.Map {
+		if item.Offset >= uint32(d.end()) {
+			return fmt.Errorf("Invalid map item %x at %x", item.Type, item.Offset)
+		}
+	}
+	return nil
+}
+
+// VerifyStringOrder checks that the strings are unique and sorted by their
+// UTF-16 code units, as the format requires.
+func (d *DEX) VerifyStringOrder() error {
+	var prev []uint16
+	for i := 0; i < d.StringCount(); i++ {
+		s, err := d.StringAt(uint32(i))
+		if err != nil {
+			return err
+		}
+
+		units := utf16.Encode([]rune(s))
+		if i > 0 && compareUint16s(prev, units) >= 0 {
+			return fmt.Errorf("Invalid string order at %d, %q", i, s)
+		}
+		prev = units
+	}
+	return nil
+}
+
+// VerifyIdOrder checks that the type, proto, field and method ids are
+// unique and sorted as the format requires.
+func (d *DEX) VerifyIdOrder() error {
+	for i := 1; i < len(d.Types); i++ {
+		if d.Types[i-1].DescriptorIdx >= d.Types[i].DescriptorIdx {
+			return fmt.Errorf("Invalid type id order at %d", i)
+		}
+	}
+
+	var prev []uint32
+	for i, p := range d.Prototypes {
+		params, err := d.readTypeList(p.ParametersOffset)
+		if err != nil {
+			return err
+		}
+
+		key := []uint32{p.ReturnTypeIdx}
+		for _, param := range params {
+			key = append(key, uint32(param))
+		}
+
+		if i > 0 && compareUint32s(prev, key) >= 0 {
+			return fmt.Errorf("Invalid proto id order at %d", i)
+		}
+		prev = key
+	}
+
+	for i := 1; i < len(d.Fields); i++ {
+		a, b := d.Fields[i-1], d.Fields[i]
+		if compareUint32s([]uint32{uint32(a.ClassIdx), a.NameIdx, uint32(a.TypeIdx)}, []uint32{uint32(b.ClassIdx), b.NameIdx, uint32(b.TypeIdx)}) >= 0 {
+			return fmt.Errorf("Invalid field id order at %d", i)
+		}
+	}
+
+	for i := 1; i < len(d.Methods); i++ {
+		a, b := d.Methods[i-1], d.Methods[i]
+		if compareUint32s([]uint32{uint32(a.ClassIdx), a.NameIdx, uint32(a.ProtoIdx)}, []uint32{uint32(b.ClassIdx), b.NameIdx, uint32(b.ProtoIdx)}) >= 0 {
+			return fmt.Errorf("Invalid method id order at %d", i)
+		}
+	}
+	return nil
+}
+
+// compareUint16s compares a and b lexicographically, a prefix sorts first.
+func compareUint16s(a, b []uint16) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compareUint32s compares a and b lexicographically, a prefix sorts first.
+func compareUint32s(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,130 @@
+package godex
+
+import (
+	"testing"
+)
+
+func TestComputeChecksum(t *testing.T) {
+	b := testHelloDEX().build()
+
+	dex, err := ParseAt(b, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if checksum := dex.ComputeChecksum(); checksum != dex.header.Checksum {
+		t.Errorf("Test failed %x %x", checksum, dex.header.Checksum)
+	}
+
+	if signature := dex.ComputeSignature(); signature != dex.header.Signature {
+		t.Errorf("Test failed %x %x", signature, dex.header.Signature)
+	}
+
+	if err := dex.VerifyChecksum(); err != nil {
+		t.Errorf("%s", err)
+	}
+
+	if err := dex.VerifySignature(); err != nil {
+		t.Errorf("%s", err)
+	}
+
+	b[len(b)-1] ^= 0xff
+	if dex.VerifyChecksum() == nil || dex.VerifySignature() == nil {
+		t.Errorf("expected verification to fail after corrupting the file")
+	}
+}
+
+// testSortedDEX returns a dex with its pools in the order the format
+// requires, the builder keeps them in the order they are added.
+func testSortedDEX() *testDex {
+	b := &testDex{}
+	for _, s := range []string{"I", "Lcom/example/A;", "Ljava/lang/Object;", "Test.java", "V", "count", "run"} {
+		b.str(s)
+	}
+	for _, descriptor := range []string{"I", "Lcom/example/A;", "Ljava/lang/Object;", "V"} {
+		b.typ(descriptor)
+	}
+
+	c := b.class("Lcom/example/A;", "Ljava/lang/Object;")
+	c.instanceFields = []testField{{idx: b.field("Lcom/example/A;", "I", "count"), flags: ACC_PRIVATE}}
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/A;", "run", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+	return b
+}
+
+func TestVerify(t *testing.T) {
+	b := testSortedDEX().build()
+
+	dex, err := ParseAt(b, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if errs := dex.Verify(); len(errs) != 0 {
+		t.Errorf("Test failed %v %v", errs, []error{})
+	}
+
+	// an unknown version and the first two strings swapped
+	corrupted := append([]byte{}, b...)
+	corrupted[4] = 'x'
+	ids := dex.header.StringIdsOffset
+	copy(corrupted[ids:ids+8], append(append([]byte{}, b[ids+4:ids+8]...), b[ids:ids+4]...))
+
+	dex, err = ParseAt(corrupted, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if errs := dex.Verify(); len(errs) != 4 {
+		t.Errorf("Test failed %v %v", errs, 4)
+	}
+
+	for _, check := range []func() error{dex.VerifyMagic, dex.VerifyChecksum, dex.VerifySignature, dex.VerifyStringOrder} {
+		if err := check(); err == nil {
+			t.Errorf("Test failed %v", err)
+		}
+	}
+
+	for _, check := range []func() error{dex.VerifySections, dex.VerifyIdOrder} {
+		if err := check(); err != nil {
+			t.Errorf("Test failed %v", err)
+		}
+	}
+}
+
+func TestVerifyIdOrder(t *testing.T) {
+	b := testSortedDEX()
+	c := b.classes[0]
+	// "run" has a lower method id than "count", but sorts after it
+	c.virtualMethods = append(c.virtualMethods, testMethod{
+		idx: b.method("Lcom/example/A;", "count", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}},
+	})
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if err := dex.VerifyIdOrder(); err == nil {
+		t.Errorf("Test failed %v", err)
+	}
+
+	if err := dex.VerifySections(); err != nil {
+		t.Errorf("Test failed %v", err)
+	}
+}
+
+func TestVerifySections(t *testing.T) {
+	b := testSortedDEX().build()
+
+	dex, err := ParseAt(b, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	dex.header.DataSize += 4
+	if err := dex.VerifySections(); err == nil {
+		t.Errorf("Test failed %v", err)
+	}
+}
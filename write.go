@@ -0,0 +1,159 @@
+package godex
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/adler32"
+	"sort"
+)
+
+// Pack encodes the class_data_item. The counts are taken from the lists,
+// which are encoded in index order without reordering them, and the index
+// diffs are derived again from the resolved FieldIdx and MethodIdx, so
+// edited lists encode correctly.
+func (c *ClassDataItem) Pack() []byte {
+	c.StaticFieldSize = uint64(len(c.StaticFields))
+	c.InstanceFieldSize = uint64(len(c.InstanceFields))
+	c.DirectMethodsSize = uint64(len(c.DirectMethods))
+	c.VirtualMethodsSize = uint64(len(c.VirtualMethods))
+
+	b := []byte{}
+	for _, size := range []uint64{c.StaticFieldSize, c.InstanceFieldSize, c.DirectMethodsSize, c.VirtualMethodsSize} {
+		b = appendUleb128(b, size)
+	}
+
+	for _, fields := range [][]EncodedField{c.StaticFields, c.InstanceFields} {
+		b = packFields(b, fields)
+	}
+
+	for _, methods := range [][]EncodedMethod{c.DirectMethods, c.VirtualMethods} {
+		b = packMethods(b, methods)
+	}
+	return b
+}
+
+func packFields(b []byte, fields []EncodedField) []byte {
+	order := make([]int, len(fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return fields[order[i]].FieldIdx < fields[order[j]].FieldIdx })
+
+	prev := uint32(0)
+	for _, i := range order {
+		f := &fields[i]
+		f.FieldIdxDiff = uint64(f.FieldIdx - prev)
+		prev = f.FieldIdx
+
+		b = appendUleb128(b, f.FieldIdxDiff)
+		b = appendUleb128(b, uint64(f.AccessFlags))
+	}
+	return b
+}
+
+func packMethods(b []byte, methods []EncodedMethod) []byte {
+	order := make([]int, len(methods))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return methods[order[i]].MethodIdx < methods[order[j]].MethodIdx })
+
+	prev := uint32(0)
+	for _, i := range order {
+		m := &methods[i]
+		m.MethodIdxDiff = uint64(m.MethodIdx - prev)
+		prev = m.MethodIdx
+
+		b = appendUleb128(b, m.MethodIdxDiff)
+		b = appendUleb128(b, uint64(m.AccessFlags))
+		b = appendUleb128(b, m.CodeOffset)
+	}
+	return b
+}
+
+// Bytes returns the dex file, up to the size declared in its header.
+func (d *DEX) Bytes() []byte {
+	return d.b[:d.end()]
+}
+
+// RenameMethod points the name of method id methodIdx to newName and
+// updates the checksum and signature. A new name that is not yet in the
+// string pool is appended to it, for which the string ids are moved to
+// the end of the file. The pools are then no longer sorted as the format
+// requires, Canonicalize restores the order. The dex is parsed again, use
+// Bytes to get the rewritten file.
+func (d *DEX) RenameMethod(methodIdx int, newName string) error {
+	if methodIdx < 0 || methodIdx >= len(d.Methods) {
+		return &IndexError{Kind: "method", Index: uint32(methodIdx), Max: len(d.Methods)}
+	}
+
+	b := append([]byte{}, d.Bytes()...)
+
+	nameIdx, ok := d.StringIndex(newName)
+	if !ok {
+		var err error
+		if b, nameIdx, err = d.appendString(b, newName); err != nil {
+			return err
+		}
+	}
+
+	le := binary.LittleEndian
+	le.PutUint32(b[uint64(d.header.MethodIdsOffset)+uint64(methodIdx)*8+4:], uint32(nameIdx))
+
+	rehash(b)
+	return d.reparse(b)
+}
+
+// appendString adds s to the end of the string pool of the dex file in b.
+// The string ids are copied to the end of b with room for the new id,
+// followed by the new string data.
+func (d *DEX) appendString(b []byte, s string) ([]byte, int, error) {
+	le := binary.LittleEndian
+	h := d.header
+
+	for len(b)%4 != 0 {
+		b = append(b, 0x00)
+	}
+
+	idsOff := uint32(len(b))
+	b = append(b, d.b[h.StringIdsOffset:uint64(h.StringIdsOffset)+uint64(h.StringIdsSize)*4]...)
+	b = append(b, 0, 0, 0, 0)
+
+	dataOff := uint32(len(b))
+	b = appendStringData(b, s)
+	le.PutUint32(b[idsOff+h.StringIdsSize*4:], dataOff)
+
+	le.PutUint32(b[32:], uint32(len(b)))
+	le.PutUint32(b[56:], h.StringIdsSize+1)
+	le.PutUint32(b[60:], idsOff)
+	if h.DataOffset != 0 {
+		le.PutUint32(b[104:], uint32(len(b))-h.DataOffset)
+	}
+
+	for i, item := range d.Map {
+		entry := b[h.MapOff+4+uint32(i)*12:]
+		switch item.Type {
+		case TYPE_STRING_ID_ITEM:
+			le.PutUint32(entry[4:], item.Size+1)
+			le.PutUint32(entry[8:], idsOff)
+		case TYPE_STRING_DATA_ITEM:
+			le.PutUint32(entry[4:], item.Size+1)
+		}
+	}
+	return b, int(h.StringIdsSize), nil
+}
+
+// rehash updates the signature and then the checksum in the header of the
+// dex file b.
+func rehash(b []byte) {
+	signature := sha1.Sum(b[32:])
+	copy(b[12:32], signature[:])
+	binary.LittleEndian.PutUint32(b[8:], adler32.Checksum(b[12:]))
+}
+
+// reparse replaces the parsed dex with the file in b, keeping the
+// registered opcode handlers.
+func (d *DEX) reparse(b []byte) error {
+	*d = DEX{b: b, opcodeHandlers: d.opcodeHandlers}
+	return d.Parse()
+}
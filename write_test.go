@@ -0,0 +1,103 @@
+package godex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestClassDataPack(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Pair;", "Ljava/lang/Object;")
+	c.instanceFields = []testField{
+		{idx: b.field("Lcom/example/Pair;", "I", "first"), flags: ACC_PRIVATE},
+	}
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Pair;", "a", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+		{idx: b.method("Lcom/example/Pair;", "b", "V"), flags: ACC_PUBLIC | ACC_FINAL, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+
+	buf := b.build()
+	dex, err := ParseAt(buf, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	off := binary.LittleEndian.Uint32(buf[dex.header.ClassDefsOffset+24:])
+	length, err := dex.classDataLength(off)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	want := buf[off : off+uint32(length)]
+
+	data := dex.Classes[0].ClassData
+	if got := data.Pack(); !bytes.Equal(got, want) {
+		t.Errorf("Test failed %x %x", got, want)
+	}
+
+	// out of order methods are encoded sorted, their diffs derived again,
+	// and left in the caller's order
+	methods := data.VirtualMethods
+	methods[0], methods[1] = methods[1], methods[0]
+	methods[0].MethodIdxDiff, methods[1].MethodIdxDiff = 0, 0
+
+	if got := data.Pack(); !bytes.Equal(got, want) {
+		t.Errorf("Test failed %x %x", got, want)
+	}
+
+	if methods[0].MethodIdx < methods[1].MethodIdx {
+		t.Errorf("Test failed %d %d", methods[0].MethodIdx, methods[1].MethodIdx)
+	}
+}
+
+func TestRenameMethod(t *testing.T) {
+	b := &testDex{}
+	c := b.class("Lcom/example/Pair;", "Ljava/lang/Object;")
+	c.virtualMethods = []testMethod{
+		{idx: b.method("Lcom/example/Pair;", "a", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+		{idx: b.method("Lcom/example/Pair;", "b", "V"), flags: ACC_PUBLIC, code: &testCode{registers: 1, ins: 1, insns: []uint16{0x000e}}},
+	}
+
+	dex, err := ParseAt(b.build(), 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	strings := dex.StringCount()
+	for _, test := range []struct {
+		name    string
+		strings int
+	}{
+		{"renamedé\u0000", strings + 1},
+		{"b", strings + 1},
+	} {
+		if err := dex.RenameMethod(0, test.name); err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		parsed, err := ParseAt(dex.Bytes(), 0)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if got := parsed.Methods[0].Name(); got != test.name {
+			t.Errorf("Test failed %q %q", got, test.name)
+		}
+
+		if got := parsed.StringCount(); got != test.strings {
+			t.Errorf("Test failed %v %v", got, test.strings)
+		}
+
+		if err := parsed.VerifyChecksum(); err != nil {
+			t.Errorf("Test failed %v", err)
+		}
+
+		if err := parsed.VerifySignature(); err != nil {
+			t.Errorf("Test failed %v", err)
+		}
+	}
+
+	if err := dex.RenameMethod(len(dex.Methods), "c"); err == nil {
+		t.Errorf("Test failed %v", err)
+	}
+}